@@ -0,0 +1,276 @@
+package alerts
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// IPv4PrefixLength is the prefix length used to group IPv4 offenders (/24).
+	IPv4PrefixLength = 24
+	// IPv6PrefixLength is the prefix length used to group IPv6 offenders (/48).
+	IPv6PrefixLength = 48
+
+	defaultWindow        = time.Minute
+	defaultBatchInterval = 10 * time.Second
+	defaultMaxBatchSize  = 100
+	defaultMaxRetries    = 3
+	defaultTimeout       = 5 * time.Second
+	defaultForgetAfter   = 24 * time.Hour
+)
+
+// Alert types.
+const (
+	// TypeNewGroup is raised the first time a range group is matched.
+	TypeNewGroup = "new_group"
+	// TypeNewPrefix is raised the first time a prefix is matched.
+	TypeNewPrefix = "new_prefix"
+	// TypeGroupThreshold is raised when a range group exceeds the group threshold within the window.
+	TypeGroupThreshold = "group_threshold"
+	// TypePrefixThreshold is raised when a prefix exceeds the prefix threshold within the window.
+	TypePrefixThreshold = "prefix_threshold"
+)
+
+// Config is used for configuring alerting.
+type Config struct {
+	// Webhooks are the URLs alerts are POSTed to.
+	Webhooks []string `json:"webhooks,omitempty"`
+	// Secret is used to sign payloads with HMAC-SHA256. The signature is sent in the X-Defender-Signature header.
+	Secret string `json:"secret,omitempty"`
+	// Window is the duration of the sliding window that match rates are measured over.
+	// Default: 1m
+	Window time.Duration `json:"window,omitempty"`
+	// GroupThreshold is the number of matches per window for a single range group that raises an alert.
+	// Default: 0 (disabled)
+	GroupThreshold int `json:"group_threshold,omitempty"`
+	// PrefixThreshold is the number of matches per window for a single /24 (IPv4) or /48 (IPv6) that raises an alert.
+	// Default: 0 (disabled)
+	PrefixThreshold int `json:"prefix_threshold,omitempty"`
+	// NotifyNew raises an alert the first time a range group or prefix is matched.
+	// Default: false
+	NotifyNew bool `json:"notify_new,omitempty"`
+	// ForgetAfter is how long a group or prefix must be idle before it is forgotten and considered new again.
+	// Default: 24h
+	ForgetAfter time.Duration `json:"forget_after,omitempty"`
+	// BatchInterval is how often pending alerts are delivered.
+	// Default: 10s
+	BatchInterval time.Duration `json:"batch_interval,omitempty"`
+	// MaxBatchSize is the maximum number of alerts delivered in a single payload.
+	// Default: 100
+	MaxBatchSize int `json:"max_batch_size,omitempty"`
+	// MaxRetries is the number of times a failed delivery is retried, with 0 disabling retries.
+	// Default: 3
+	MaxRetries *int `json:"max_retries,omitempty"`
+	// Timeout is the timeout of a single webhook request.
+	// Default: 5s
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// Validate ensures the alerting configuration is valid.
+func (c *Config) Validate() error {
+	if len(c.Webhooks) == 0 {
+		return errors.New("alerts require at least one webhook")
+	}
+	for _, webhook := range c.Webhooks {
+		u, err := url.Parse(webhook)
+		if err != nil {
+			return fmt.Errorf("invalid alert webhook %q: %v", webhook, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid alert webhook %q: must be an absolute http(s) URL", webhook)
+		}
+	}
+	if c.GroupThreshold < 0 || c.PrefixThreshold < 0 {
+		return errors.New("alert thresholds must not be negative")
+	}
+	if c.GroupThreshold == 0 && c.PrefixThreshold == 0 && !c.NotifyNew {
+		return errors.New("alerts require a group_threshold, prefix_threshold or notify_new")
+	}
+	if c.Window < 0 || c.BatchInterval < 0 || c.Timeout < 0 || c.ForgetAfter < 0 {
+		return errors.New("alert durations must not be negative")
+	}
+	if c.MaxBatchSize < 0 || (c.MaxRetries != nil && *c.MaxRetries < 0) {
+		return errors.New("alert max_batch_size and max_retries must not be negative")
+	}
+	return nil
+}
+
+// setDefaults fills in unset configuration values.
+func (c *Config) setDefaults() {
+	if c.Window == 0 {
+		c.Window = defaultWindow
+	}
+	if c.BatchInterval == 0 {
+		c.BatchInterval = defaultBatchInterval
+	}
+	if c.MaxBatchSize == 0 {
+		c.MaxBatchSize = defaultMaxBatchSize
+	}
+	if c.MaxRetries == nil {
+		retries := defaultMaxRetries
+		c.MaxRetries = &retries
+	}
+	if c.Timeout == 0 {
+		c.Timeout = defaultTimeout
+	}
+	if c.ForgetAfter == 0 {
+		c.ForgetAfter = defaultForgetAfter
+	}
+}
+
+// Alert describes a single threshold crossing or new offender.
+type Alert struct {
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	Group     string    `json:"group,omitempty"`
+	Prefix    string    `json:"prefix,omitempty"`
+	Window    string    `json:"window,omitempty"`
+	Count     int       `json:"count"`
+	Threshold int       `json:"threshold,omitempty"`
+}
+
+// Alerter tracks match rates per range group and per prefix and delivers alerts to webhooks.
+type Alerter struct {
+	config     *Config
+	client     *http.Client
+	log        *zap.Logger
+	now        func() time.Time
+	groups     map[string]*window
+	prefixes   map[netip.Prefix]*window
+	pending    []Alert
+	flush      chan struct{}
+	done       chan struct{}
+	retryDelay time.Duration
+	wg         sync.WaitGroup
+	stopOnce   sync.Once
+	mu         sync.Mutex
+}
+
+// New returns a new Alerter. Start must be called before alerts are delivered.
+func New(c *Config, log *zap.Logger) *Alerter {
+	c.setDefaults()
+
+	return &Alerter{
+		config:     c,
+		client:     &http.Client{Timeout: c.Timeout},
+		log:        log,
+		now:        time.Now,
+		groups:     make(map[string]*window),
+		prefixes:   make(map[netip.Prefix]*window),
+		flush:      make(chan struct{}, 1),
+		done:       make(chan struct{}),
+		retryDelay: defaultRetryDelay,
+	}
+}
+
+// Observe records a match of ip within the range group.
+func (a *Alerter) Observe(group string, ip netip.Addr) {
+	now := a.now()
+	width := max(a.config.Window/numBuckets, 1)
+
+	prefix, err := offenderPrefix(ip)
+	if err != nil {
+		a.log.Debug("Unable to determine offender prefix", zap.String("ip", ip.String()), zap.Error(err))
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	groupWindow, seen := a.groups[group]
+	if !seen {
+		groupWindow = &window{}
+		a.groups[group] = groupWindow
+		if a.config.NotifyNew {
+			a.enqueue(Alert{Time: now, Type: TypeNewGroup, Group: group, Count: 1})
+		}
+	}
+	count := groupWindow.add(now, width)
+	if a.crossed(groupWindow, count, a.config.GroupThreshold, now) {
+		a.enqueue(Alert{
+			Time:      now,
+			Type:      TypeGroupThreshold,
+			Group:     group,
+			Window:    a.config.Window.String(),
+			Count:     count,
+			Threshold: a.config.GroupThreshold,
+		})
+	}
+
+	if !prefix.IsValid() {
+		return
+	}
+
+	prefixWindow, seen := a.prefixes[prefix]
+	if !seen {
+		prefixWindow = &window{}
+		a.prefixes[prefix] = prefixWindow
+		if a.config.NotifyNew {
+			a.enqueue(Alert{Time: now, Type: TypeNewPrefix, Group: group, Prefix: prefix.String(), Count: 1})
+		}
+	}
+	count = prefixWindow.add(now, width)
+	if a.crossed(prefixWindow, count, a.config.PrefixThreshold, now) {
+		a.enqueue(Alert{
+			Time:      now,
+			Type:      TypePrefixThreshold,
+			Group:     group,
+			Prefix:    prefix.String(),
+			Window:    a.config.Window.String(),
+			Count:     count,
+			Threshold: a.config.PrefixThreshold,
+		})
+	}
+}
+
+// crossed reports whether count crosses threshold, at most once per window for each key.
+func (a *Alerter) crossed(w *window, count, threshold int, now time.Time) bool {
+	if threshold == 0 || count < threshold {
+		return false
+	}
+	if !w.alerted.IsZero() && now.Sub(w.alerted) < a.config.Window {
+		return false
+	}
+	w.alerted = now
+	return true
+}
+
+// enqueue adds an alert to the pending batch. The caller must hold a.mu.
+func (a *Alerter) enqueue(alert Alert) {
+	a.pending = append(a.pending, alert)
+	if len(a.pending) >= a.config.MaxBatchSize {
+		select {
+		case a.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// forget removes groups and prefixes that have been idle longer than ForgetAfter. The caller must hold a.mu.
+func (a *Alerter) forget(now time.Time) {
+	for group, w := range a.groups {
+		if now.Sub(w.lastSeen) > a.config.ForgetAfter {
+			delete(a.groups, group)
+		}
+	}
+	for prefix, w := range a.prefixes {
+		if now.Sub(w.lastSeen) > a.config.ForgetAfter {
+			delete(a.prefixes, prefix)
+		}
+	}
+}
+
+// offenderPrefix returns the prefix used to group an offending IP.
+func offenderPrefix(ip netip.Addr) (netip.Prefix, error) {
+	ip = ip.Unmap()
+	if ip.Is4() {
+		return ip.Prefix(IPv4PrefixLength)
+	}
+	return ip.Prefix(IPv6PrefixLength)
+}
@@ -0,0 +1,333 @@
+package alerts
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// receiver is a local webhook endpoint that records delivered payloads.
+type receiver struct {
+	server   *httptest.Server
+	payloads []Payload
+	failures int32
+	mu       sync.Mutex
+}
+
+// newReceiver starts a webhook receiver that fails the first `failures` deliveries with a 500.
+func newReceiver(t *testing.T, secret string, failures int32) *receiver {
+	rcv := &receiver{failures: failures}
+	rcv.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&rcv.failures, -1) >= 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if secret != "" && r.Header.Get(SignatureHeader) != Sign(secret, body) {
+			t.Errorf("invalid signature %q", r.Header.Get(SignatureHeader))
+		}
+
+		var payload Payload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Error(err)
+			return
+		}
+		rcv.mu.Lock()
+		rcv.payloads = append(rcv.payloads, payload)
+		rcv.mu.Unlock()
+	}))
+	t.Cleanup(rcv.server.Close)
+	return rcv
+}
+
+func (rcv *receiver) alerts() []Alert {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	var alerts []Alert
+	for _, payload := range rcv.payloads {
+		alerts = append(alerts, payload.Alerts...)
+	}
+	return alerts
+}
+
+// fakeClock is a manually advanced clock for deterministic sliding windows.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func newTestAlerter(config *Config) (*Alerter, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	alerter := New(config, zap.NewNop())
+	alerter.now = clock.Now
+	alerter.retryDelay = time.Millisecond
+	return alerter, clock
+}
+
+func intPtr(v int) *int { return &v }
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      Config
+		errContains string
+	}{
+		{
+			name:   "valid",
+			config: Config{Webhooks: []string{"https://example.com/hook"}, GroupThreshold: 10},
+		},
+		{
+			name:        "missing webhook",
+			config:      Config{GroupThreshold: 10},
+			errContains: "at least one webhook",
+		},
+		{
+			name:        "relative webhook",
+			config:      Config{Webhooks: []string{"/hook"}, GroupThreshold: 10},
+			errContains: "absolute http(s) URL",
+		},
+		{
+			name:        "nothing to alert on",
+			config:      Config{Webhooks: []string{"https://example.com/hook"}},
+			errContains: "group_threshold, prefix_threshold or notify_new",
+		},
+		{
+			name:        "negative threshold",
+			config:      Config{Webhooks: []string{"https://example.com/hook"}, PrefixThreshold: -1},
+			errContains: "must not be negative",
+		},
+		{
+			name:        "negative retries",
+			config:      Config{Webhooks: []string{"https://example.com/hook"}, NotifyNew: true, MaxRetries: intPtr(-1)},
+			errContains: "must not be negative",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.errContains == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tt.errContains)
+		})
+	}
+}
+
+func TestGroupThreshold(t *testing.T) {
+	rcv := newReceiver(t, "s3cret", 0)
+	alerter, clock := newTestAlerter(&Config{
+		Webhooks:       []string{rcv.server.URL},
+		Secret:         "s3cret",
+		Window:         time.Minute,
+		GroupThreshold: 3,
+	})
+
+	ip := netip.MustParseAddr("203.0.113.10")
+	alerter.Observe("openai", ip)
+	alerter.Observe("openai", ip)
+	alerter.deliverPending()
+	require.Empty(t, rcv.alerts(), "threshold should not be crossed yet")
+
+	alerter.Observe("openai", ip)
+	// Crossing again within the same window must not raise a duplicate alert
+	alerter.Observe("openai", ip)
+	alerter.deliverPending()
+
+	alerts := rcv.alerts()
+	require.Len(t, alerts, 1)
+	require.Equal(t, TypeGroupThreshold, alerts[0].Type)
+	require.Equal(t, "openai", alerts[0].Group)
+	require.Equal(t, 3, alerts[0].Count)
+	require.Equal(t, 3, alerts[0].Threshold)
+
+	// Once the window has passed, the rate must cross the threshold again to alert
+	clock.now = clock.now.Add(2 * time.Minute)
+	alerter.Observe("openai", ip)
+	alerter.deliverPending()
+	require.Len(t, rcv.alerts(), 1)
+}
+
+func TestPrefixThreshold(t *testing.T) {
+	rcv := newReceiver(t, "", 0)
+	alerter, clock := newTestAlerter(&Config{
+		Webhooks:        []string{rcv.server.URL},
+		Window:          time.Minute,
+		PrefixThreshold: 3,
+	})
+
+	// Spread over the window, but all within one /24
+	for _, ip := range []string{"198.51.100.1", "198.51.100.2", "198.51.100.3"} {
+		alerter.Observe("aws", netip.MustParseAddr(ip))
+		clock.now = clock.now.Add(15 * time.Second)
+	}
+	// A different /24 must be tracked separately
+	alerter.Observe("aws", netip.MustParseAddr("198.51.101.1"))
+	alerter.deliverPending()
+
+	alerts := rcv.alerts()
+	require.Len(t, alerts, 1)
+	require.Equal(t, TypePrefixThreshold, alerts[0].Type)
+	require.Equal(t, "198.51.100.0/24", alerts[0].Prefix)
+	require.Equal(t, "aws", alerts[0].Group)
+}
+
+func TestSlidingWindowExpiry(t *testing.T) {
+	rcv := newReceiver(t, "", 0)
+	alerter, clock := newTestAlerter(&Config{
+		Webhooks:       []string{rcv.server.URL},
+		Window:         time.Minute,
+		GroupThreshold: 3,
+	})
+
+	ip := netip.MustParseAddr("203.0.113.10")
+	// Two matches per window never crosses a threshold of three
+	for i := 0; i < 6; i++ {
+		alerter.Observe("openai", ip)
+		clock.now = clock.now.Add(40 * time.Second)
+	}
+	alerter.deliverPending()
+	require.Empty(t, rcv.alerts())
+}
+
+func TestNotifyNew(t *testing.T) {
+	rcv := newReceiver(t, "", 0)
+	alerter, _ := newTestAlerter(&Config{
+		Webhooks:  []string{rcv.server.URL},
+		NotifyNew: true,
+	})
+
+	alerter.Observe("openai", netip.MustParseAddr("203.0.113.10"))
+	alerter.Observe("openai", netip.MustParseAddr("203.0.113.11"))
+	alerter.Observe("openai", netip.MustParseAddr("2001:db8:1::1"))
+	alerter.deliverPending()
+
+	alerts := rcv.alerts()
+	require.Len(t, alerts, 3)
+	require.Equal(t, TypeNewGroup, alerts[0].Type)
+	require.Equal(t, TypeNewPrefix, alerts[1].Type)
+	require.Equal(t, "203.0.113.0/24", alerts[1].Prefix)
+	require.Equal(t, TypeNewPrefix, alerts[2].Type)
+	require.Equal(t, "2001:db8:1::/48", alerts[2].Prefix)
+}
+
+func TestForgetAfter(t *testing.T) {
+	rcv := newReceiver(t, "", 0)
+	alerter, clock := newTestAlerter(&Config{
+		Webhooks:    []string{rcv.server.URL},
+		NotifyNew:   true,
+		ForgetAfter: time.Hour,
+	})
+
+	ip := netip.MustParseAddr("203.0.113.10")
+	alerter.Observe("openai", ip)
+	alerter.deliverPending()
+	require.Len(t, rcv.alerts(), 2)
+
+	clock.now = clock.now.Add(2 * time.Hour)
+	alerter.deliverPending()
+	alerter.Observe("openai", ip)
+	alerter.deliverPending()
+	require.Len(t, rcv.alerts(), 4, "idle offenders should be reported as new again")
+}
+
+func TestBatching(t *testing.T) {
+	rcv := newReceiver(t, "", 0)
+	alerter, _ := newTestAlerter(&Config{
+		Webhooks:     []string{rcv.server.URL},
+		NotifyNew:    true,
+		MaxBatchSize: 3,
+	})
+
+	for _, ip := range []string{"192.0.2.1", "198.51.100.1", "203.0.113.1"} {
+		alerter.Observe("custom", netip.MustParseAddr(ip))
+	}
+	alerter.deliverPending()
+
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	// One new group and three new prefixes split into batches of at most three
+	require.Len(t, rcv.payloads, 2)
+	require.Len(t, rcv.payloads[0].Alerts, 3)
+	require.Len(t, rcv.payloads[1].Alerts, 1)
+}
+
+func TestRetry(t *testing.T) {
+	t.Run("Succeeds after failures", func(t *testing.T) {
+		rcv := newReceiver(t, "", 2)
+		alerter, _ := newTestAlerter(&Config{
+			Webhooks:   []string{rcv.server.URL},
+			NotifyNew:  true,
+			MaxRetries: intPtr(2),
+		})
+
+		alerter.Observe("openai", netip.MustParseAddr("203.0.113.10"))
+		alerter.deliverPending()
+		require.Len(t, rcv.alerts(), 2)
+	})
+
+	t.Run("Gives up after max retries", func(t *testing.T) {
+		rcv := newReceiver(t, "", 3)
+		alerter, _ := newTestAlerter(&Config{
+			Webhooks:   []string{rcv.server.URL},
+			NotifyNew:  true,
+			MaxRetries: intPtr(2),
+		})
+
+		alerter.Observe("openai", netip.MustParseAddr("203.0.113.10"))
+		alerter.deliverPending()
+		require.Empty(t, rcv.alerts())
+	})
+
+	t.Run("Retries can be disabled", func(t *testing.T) {
+		rcv := newReceiver(t, "", 1)
+		alerter, _ := newTestAlerter(&Config{
+			Webhooks:   []string{rcv.server.URL},
+			NotifyNew:  true,
+			MaxRetries: intPtr(0),
+		})
+
+		alerter.Observe("openai", netip.MustParseAddr("203.0.113.10"))
+		alerter.deliverPending()
+		require.Empty(t, rcv.alerts())
+		require.Equal(t, int32(0), atomic.LoadInt32(&rcv.failures), "expected a single attempt")
+	})
+}
+
+func TestStartStop(t *testing.T) {
+	rcv := newReceiver(t, "", 0)
+	alerter, _ := newTestAlerter(&Config{
+		Webhooks:      []string{rcv.server.URL},
+		NotifyNew:     true,
+		BatchInterval: time.Hour,
+	})
+	alerter.Start()
+
+	alerter.Observe("openai", netip.MustParseAddr("203.0.113.10"))
+	// Pending alerts are flushed on stop
+	alerter.Stop()
+	require.Len(t, rcv.alerts(), 2)
+}
+
+func TestSign(t *testing.T) {
+	expected := "sha256=8b5f48702995c1598c573db1e21866a9b825d4a794d169d7060a03605796360b"
+	require.Equal(t, expected, Sign("secret", []byte("message")))
+}
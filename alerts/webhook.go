@@ -0,0 +1,148 @@
+package alerts
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// SignatureHeader is the header containing the HMAC-SHA256 signature of the payload.
+const SignatureHeader = "X-Defender-Signature"
+
+// defaultRetryDelay is the delay before the first retry of a failed delivery. It doubles on each retry.
+const defaultRetryDelay = 500 * time.Millisecond
+
+// Payload is the JSON body POSTed to webhooks.
+type Payload struct {
+	SentAt time.Time `json:"sent_at"`
+	Alerts []Alert   `json:"alerts"`
+}
+
+// Sign returns the signature of body using secret in the format "sha256=<hex digest>".
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Start begins delivering alerts in the background.
+func (a *Alerter) Start() {
+	a.wg.Add(1)
+	go a.run()
+}
+
+// Stop delivers any pending alerts and stops the background delivery.
+func (a *Alerter) Stop() {
+	a.stopOnce.Do(func() {
+		close(a.done)
+	})
+	a.wg.Wait()
+}
+
+func (a *Alerter) run() {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(a.config.BatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.deliverPending()
+		case <-a.flush:
+			a.deliverPending()
+		case <-a.done:
+			a.deliverPending()
+			return
+		}
+	}
+}
+
+// deliverPending sends all pending alerts in batches of at most MaxBatchSize.
+func (a *Alerter) deliverPending() {
+	a.mu.Lock()
+	pending := a.pending
+	a.pending = nil
+	a.forget(a.now())
+	a.mu.Unlock()
+
+	for len(pending) > 0 {
+		n := min(len(pending), a.config.MaxBatchSize)
+		batch := pending[:n]
+		pending = pending[n:]
+
+		body, err := json.Marshal(Payload{SentAt: a.now(), Alerts: batch})
+		if err != nil {
+			a.log.Error("Failed to encode alerts", zap.Error(err))
+			continue
+		}
+
+		for _, webhook := range a.config.Webhooks {
+			if err := a.send(webhook, body); err != nil {
+				a.log.Error("Failed to deliver alerts",
+					zap.String("webhook", webhook),
+					zap.Int("alerts", len(batch)),
+					zap.Error(err))
+			}
+		}
+	}
+}
+
+// send POSTs body to webhook, retrying failed deliveries with exponential backoff.
+func (a *Alerter) send(webhook string, body []byte) error {
+	delay := a.retryDelay
+	var err error
+	for attempt := 0; attempt <= *a.config.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(delay):
+				delay *= 2
+			case <-a.done:
+				// Shutting down, don't hold up the config reload with retries
+				return err
+			}
+		}
+
+		err = a.post(webhook, body)
+		if err == nil {
+			return nil
+		}
+		a.log.Debug("Alert delivery attempt failed",
+			zap.String("webhook", webhook),
+			zap.Int("attempt", attempt+1),
+			zap.Error(err))
+	}
+	return err
+}
+
+func (a *Alerter) post(webhook string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "caddy-defender")
+	if a.config.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(a.config.Secret, body))
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("bad status: %s", resp.Status)
+	}
+	return nil
+}
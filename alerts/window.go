@@ -0,0 +1,42 @@
+package alerts
+
+import "time"
+
+// numBuckets is the number of buckets a sliding window is split into.
+const numBuckets = 12
+
+// window is a bucketed sliding window counter.
+// It approximates the number of events seen over the last window duration by summing
+// fixed-width buckets, which keeps memory per tracked key constant.
+type window struct {
+	counts   [numBuckets]int
+	epochs   [numBuckets]int64
+	lastSeen time.Time
+	// alerted is the last time a threshold alert was raised for this key.
+	alerted time.Time
+}
+
+// add records an event at now and returns the number of events within the window.
+func (w *window) add(now time.Time, width time.Duration) int {
+	epoch := now.UnixNano() / int64(width)
+	i := epoch % numBuckets
+	if w.epochs[i] != epoch {
+		w.epochs[i] = epoch
+		w.counts[i] = 0
+	}
+	w.counts[i]++
+	w.lastSeen = now
+
+	return w.count(epoch)
+}
+
+// count sums every bucket that still falls within the window ending at epoch.
+func (w *window) count(epoch int64) int {
+	total := 0
+	for i := range w.counts {
+		if epoch-w.epochs[i] < numBuckets {
+			total += w.counts[i]
+		}
+	}
+	return total
+}
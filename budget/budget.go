@@ -0,0 +1,96 @@
+package budget
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jasonlovesdoggo/caddy-defender/pacing"
+	"golang.org/x/time/rate"
+)
+
+// ErrExceeded is returned by Acquire when no concurrency slot became free within the queue timeout.
+var ErrExceeded = errors.New("group budget exceeded")
+
+// Config is used for configuring the aggregate budget shared by all clients of a range group.
+type Config struct {
+	// MaxConcurrent is the maximum number of requests from the group served at once.
+	// Default: 0 (unlimited)
+	MaxConcurrent int `json:"max_concurrent,omitempty"`
+	// BytesPerSecond is the maximum bandwidth of all responses to the group combined.
+	// Default: 0 (unlimited)
+	BytesPerSecond int `json:"bytes_per_second,omitempty"`
+	// QueueTimeout is how long a request waits for a concurrency slot before the fallback responder is used.
+	// Default: 0 (use the fallback responder immediately)
+	QueueTimeout time.Duration `json:"queue_timeout,omitempty"`
+	// Fallback is the responder type used for requests exceeding the budget.
+	// Default: "" (respond with 503 Service Unavailable)
+	Fallback string `json:"fallback,omitempty"`
+}
+
+// Validate ensures the budget configuration is valid.
+func (c *Config) Validate() error {
+	if c.MaxConcurrent < 0 || c.BytesPerSecond < 0 || c.QueueTimeout < 0 {
+		return errors.New("budget max_concurrent, bytes_per_second and queue_timeout must not be negative")
+	}
+	if c.MaxConcurrent == 0 && c.BytesPerSecond == 0 {
+		return errors.New("budget requires max_concurrent or bytes_per_second")
+	}
+	return nil
+}
+
+// Budget enforces a Config across concurrent requests.
+type Budget struct {
+	config    *Config
+	slots     chan struct{}
+	bandwidth *rate.Limiter
+}
+
+// New returns a new Budget.
+func New(c *Config) *Budget {
+	b := &Budget{config: c}
+	if c.MaxConcurrent > 0 {
+		b.slots = make(chan struct{}, c.MaxConcurrent)
+	}
+	if c.BytesPerSecond > 0 {
+		b.bandwidth = pacing.NewLimiter(c.BytesPerSecond)
+	}
+	return b
+}
+
+// Acquire reserves a concurrency slot, waiting up to the queue timeout for one to become free.
+// The returned function must be called to release the slot once the request has been served.
+func (b *Budget) Acquire(ctx context.Context) (func(), error) {
+	if b.slots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case b.slots <- struct{}{}:
+		return b.release, nil
+	default:
+	}
+	if b.config.QueueTimeout == 0 {
+		return nil, ErrExceeded
+	}
+
+	timer := time.NewTimer(b.config.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case b.slots <- struct{}{}:
+		return b.release, nil
+	case <-timer.C:
+		return nil, ErrExceeded
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (b *Budget) release() {
+	<-b.slots
+}
+
+// InUse returns the number of concurrency slots currently held.
+func (b *Budget) InUse() int {
+	return len(b.slots)
+}
@@ -0,0 +1,146 @@
+package budget
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	require.NoError(t, (&Config{MaxConcurrent: 4}).Validate())
+	require.NoError(t, (&Config{BytesPerSecond: 1024}).Validate())
+	require.ErrorContains(t, (&Config{}).Validate(), "requires max_concurrent or bytes_per_second")
+	require.ErrorContains(t, (&Config{MaxConcurrent: -1}).Validate(), "must not be negative")
+	require.ErrorContains(t, (&Config{MaxConcurrent: 1, QueueTimeout: -time.Second}).Validate(), "must not be negative")
+}
+
+func TestAcquire(t *testing.T) {
+	t.Run("Rejects when full without queueing", func(t *testing.T) {
+		b := New(&Config{MaxConcurrent: 2})
+
+		release1, err := b.Acquire(context.Background())
+		require.NoError(t, err)
+		release2, err := b.Acquire(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 2, b.InUse())
+
+		_, err = b.Acquire(context.Background())
+		require.ErrorIs(t, err, ErrExceeded)
+
+		release1()
+		release3, err := b.Acquire(context.Background())
+		require.NoError(t, err)
+		release2()
+		release3()
+		require.Zero(t, b.InUse())
+	})
+
+	t.Run("Queued request gets a released slot", func(t *testing.T) {
+		b := New(&Config{MaxConcurrent: 1, QueueTimeout: time.Second})
+
+		release, err := b.Acquire(context.Background())
+		require.NoError(t, err)
+		time.AfterFunc(50*time.Millisecond, release)
+
+		start := time.Now()
+		release, err = b.Acquire(context.Background())
+		require.NoError(t, err)
+		require.Less(t, time.Since(start), time.Second)
+		release()
+	})
+
+	t.Run("Queued request times out", func(t *testing.T) {
+		b := New(&Config{MaxConcurrent: 1, QueueTimeout: 50 * time.Millisecond})
+
+		release, err := b.Acquire(context.Background())
+		require.NoError(t, err)
+		defer release()
+
+		_, err = b.Acquire(context.Background())
+		require.ErrorIs(t, err, ErrExceeded)
+	})
+
+	t.Run("Queued request is cancelled", func(t *testing.T) {
+		b := New(&Config{MaxConcurrent: 1, QueueTimeout: time.Minute})
+
+		release, err := b.Acquire(context.Background())
+		require.NoError(t, err)
+		defer release()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err = b.Acquire(ctx)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("Unlimited concurrency", func(t *testing.T) {
+		b := New(&Config{BytesPerSecond: 1024})
+		for i := 0; i < 100; i++ {
+			_, err := b.Acquire(context.Background())
+			require.NoError(t, err)
+		}
+	})
+}
+
+func TestWriter(t *testing.T) {
+	t.Run("Unlimited bandwidth returns the writer unchanged", func(t *testing.T) {
+		b := New(&Config{MaxConcurrent: 1})
+		rec := httptest.NewRecorder()
+		require.Same(t, rec, b.Writer(context.Background(), rec))
+	})
+
+	t.Run("Bandwidth is shared between writers", func(t *testing.T) {
+		const (
+			bytesPerSecond = 10000
+			clients        = 3
+			size           = 5000
+		)
+		b := New(&Config{BytesPerSecond: bytesPerSecond})
+
+		start := time.Now()
+		var wg sync.WaitGroup
+		recorders := make([]*httptest.ResponseRecorder, clients)
+		for i := range recorders {
+			recorders[i] = httptest.NewRecorder()
+			wg.Add(1)
+			go func(rec *httptest.ResponseRecorder) {
+				defer wg.Done()
+				n, err := b.Writer(context.Background(), rec).Write(make([]byte, size))
+				require.NoError(t, err)
+				require.Equal(t, size, n)
+			}(recorders[i])
+		}
+		wg.Wait()
+
+		// 15000 bytes at 10000 B/s with an initial burst of 1000 bytes
+		require.GreaterOrEqual(t, time.Since(start), 1300*time.Millisecond)
+		for _, rec := range recorders {
+			require.Equal(t, size, rec.Body.Len())
+		}
+	})
+
+	t.Run("Write stops when the request is cancelled", func(t *testing.T) {
+		b := New(&Config{BytesPerSecond: 10})
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		n, err := b.Writer(ctx, httptest.NewRecorder()).Write(make([]byte, 100))
+		require.Error(t, err)
+		require.Less(t, n, 100)
+	})
+
+	t.Run("Unwrap and Flush", func(t *testing.T) {
+		b := New(&Config{BytesPerSecond: 1024})
+		rec := httptest.NewRecorder()
+		w := b.Writer(context.Background(), rec)
+
+		require.NoError(t, http.NewResponseController(w).Flush())
+		require.True(t, rec.Flushed)
+		require.Same(t, rec, w.(interface{ Unwrap() http.ResponseWriter }).Unwrap())
+	})
+}
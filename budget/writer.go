@@ -0,0 +1,17 @@
+package budget
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/jasonlovesdoggo/caddy-defender/pacing"
+)
+
+// Writer returns w limited to the budget's bandwidth. Writes block until the group's shared bandwidth allows
+// them or ctx is done. If no bandwidth limit is configured, w is returned unchanged.
+func (b *Budget) Writer(ctx context.Context, w http.ResponseWriter) http.ResponseWriter {
+	if b.bandwidth == nil {
+		return w
+	}
+	return pacing.NewWriter(ctx, w, b.bandwidth)
+}
@@ -0,0 +1,66 @@
+package caddydefender
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/jasonlovesdoggo/caddy-defender/budget"
+	"github.com/jasonlovesdoggo/caddy-defender/responders"
+	"go.uber.org/zap"
+)
+
+// groupBudget is a provisioned group budget with its fallback responder.
+type groupBudget struct {
+	*budget.Budget
+	fallbackType string
+	// fallback is nil if requests exceeding the budget are rejected with 503 Service Unavailable.
+	fallback responders.Responder
+}
+
+// provisionBudgets sets up the group budgets and their fallback responders.
+func (m *Defender) provisionBudgets(ctx caddy.Context) error {
+	m.budgets = make(map[string]*groupBudget, len(m.Budgets))
+	for group, config := range m.Budgets {
+		b := &groupBudget{Budget: budget.New(config), fallbackType: config.Fallback}
+		if config.Fallback != "" {
+			fallback, err := m.newResponder(config.Fallback)
+			if err != nil {
+				return err
+			}
+			if provisioner, ok := fallback.(caddy.Provisioner); ok {
+				if err := provisioner.Provision(ctx); err != nil {
+					return err
+				}
+			}
+			b.fallback = fallback
+		}
+		m.budgets[group] = b
+	}
+	return nil
+}
+
+// serveMatched hands a matched request to the responder within its group's budget, if one is configured.
+func (m Defender) serveMatched(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler, ip, group string) error {
+	b, ok := m.budgets[group]
+	if !ok {
+		return m.respond(w, r, next, m.RawResponder, m.responder, ip, group)
+	}
+
+	release, err := b.Acquire(r.Context())
+	if err != nil {
+		m.log.Debug("Group budget exceeded", zap.String("ip", ip), zap.String("group", group), zap.Error(err))
+		if !errors.Is(err, budget.ErrExceeded) {
+			// The client went away while queued
+			return err
+		}
+		if b.fallback == nil {
+			return caddyhttp.Error(http.StatusServiceUnavailable, err)
+		}
+		return m.respond(w, r, next, b.fallbackType, b.fallback, ip, group)
+	}
+	defer release()
+
+	return m.respond(b.Writer(r.Context(), w), r, next, m.RawResponder, m.responder, ip, group)
+}
@@ -0,0 +1,145 @@
+package caddydefender
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/stretchr/testify/require"
+)
+
+// concurrencyTracker is a next handler that records the peak number of concurrent requests.
+type concurrencyTracker struct {
+	current int32
+	peak    int32
+	hold    time.Duration
+}
+
+func (c *concurrencyTracker) ServeHTTP(w http.ResponseWriter, _ *http.Request) error {
+	current := atomic.AddInt32(&c.current, 1)
+	defer atomic.AddInt32(&c.current, -1)
+	for {
+		peak := atomic.LoadInt32(&c.peak)
+		if current <= peak || atomic.CompareAndSwapInt32(&c.peak, peak, current) {
+			break
+		}
+	}
+	time.Sleep(c.hold)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// serveClients sends one request from each of n distinct clients of the private group at once
+// and returns the response codes.
+func serveClients(t *testing.T, def *Defender, next caddyhttp.Handler, n int) map[int]int {
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		codes = make(map[int]int)
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := newMatchedRequest()
+			req.RemoteAddr = fmt.Sprintf("10.%d.%d.1:1234", i/256, i%256)
+
+			rec := httptest.NewRecorder()
+			var code int
+			err := def.ServeHTTP(rec, req, next)
+			if handlerErr, ok := err.(caddyhttp.HandlerError); ok {
+				code = handlerErr.StatusCode
+			} else {
+				require.NoError(t, err)
+				code = rec.Code
+			}
+
+			mu.Lock()
+			codes[code]++
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+	return codes
+}
+
+func TestGroupBudget(t *testing.T) {
+	t.Run("Excess clients get the fallback responder", func(t *testing.T) {
+		def := newTestDefender(t, `{
+			"raw_responder": "ratelimit",
+			"ranges": ["private"],
+			"budgets": {"private": {"max_concurrent": 4, "fallback": "block"}}
+		}`)
+
+		next := &concurrencyTracker{hold: 200 * time.Millisecond}
+		codes := serveClients(t, def, next, 50)
+
+		require.EqualValues(t, 4, next.peak)
+		require.Equal(t, 4, codes[http.StatusOK])
+		require.Equal(t, 46, codes[http.StatusForbidden])
+	})
+
+	t.Run("Queued clients are served once slots free up", func(t *testing.T) {
+		def := newTestDefender(t, `{
+			"raw_responder": "ratelimit",
+			"ranges": ["private"],
+			"budgets": {"private": {"max_concurrent": 4, "queue_timeout": 5000000000}}
+		}`)
+
+		next := &concurrencyTracker{hold: 20 * time.Millisecond}
+		codes := serveClients(t, def, next, 40)
+
+		require.EqualValues(t, 4, next.peak)
+		require.Equal(t, map[int]int{http.StatusOK: 40}, codes)
+	})
+
+	t.Run("Queue deadline rejects with 503 without a fallback", func(t *testing.T) {
+		def := newTestDefender(t, `{
+			"raw_responder": "ratelimit",
+			"ranges": ["private"],
+			"budgets": {"private": {"max_concurrent": 2, "queue_timeout": 50000000}}
+		}`)
+
+		next := &concurrencyTracker{hold: 300 * time.Millisecond}
+		codes := serveClients(t, def, next, 10)
+
+		require.Equal(t, 2, codes[http.StatusOK])
+		require.Equal(t, 8, codes[http.StatusServiceUnavailable])
+	})
+
+	t.Run("Other groups are not limited", func(t *testing.T) {
+		def := newTestDefender(t, `{
+			"raw_responder": "ratelimit",
+			"ranges": ["private", "203.0.113.0/24"],
+			"budgets": {"203.0.113.0/24": {"max_concurrent": 1}}
+		}`)
+
+		next := &concurrencyTracker{hold: 100 * time.Millisecond}
+		codes := serveClients(t, def, next, 10)
+
+		require.EqualValues(t, 10, next.peak)
+		require.Equal(t, map[int]int{http.StatusOK: 10}, codes)
+	})
+
+	t.Run("Bandwidth is shared by the group", func(t *testing.T) {
+		def := newTestDefender(t, fmt.Sprintf(`{
+			"raw_responder": "custom",
+			"message": %q,
+			"ranges": ["private"],
+			"budgets": {"private": {"bytes_per_second": 2000}}
+		}`, strings.Repeat("x", 1000)))
+
+		start := time.Now()
+		codes := serveClients(t, def, &concurrencyTracker{}, 5)
+
+		require.Equal(t, map[int]int{http.StatusOK: 5}, codes)
+		// Five responses of 1000 bytes each at 2000 B/s, with an initial burst of 200 bytes
+		require.GreaterOrEqual(t, time.Since(start), 2*time.Second)
+	})
+}
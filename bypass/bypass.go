@@ -0,0 +1,231 @@
+package bypass
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultHeader     = "X-Defender-Bypass"
+	DefaultQueryParam = "defender_bypass"
+	// MinSecretLength is the minimum length of the secret tokens are signed with.
+	MinSecretLength = 16
+)
+
+var (
+	ErrMalformed = errors.New("malformed bypass token")
+	ErrSignature = errors.New("invalid bypass token signature")
+	ErrExpired   = errors.New("bypass token expired")
+)
+
+// Config is used for configuring bypass credentials, which let trusted clients through even if they are in the
+// configured ranges.
+type Config struct {
+	// Secret is the key bypass tokens are signed with. It must be at least 16 bytes long.
+	// Default: "" (tokens are not accepted)
+	Secret string `json:"secret,omitempty"`
+	// Header is the request header a token is read from.
+	// Default: "X-Defender-Bypass"
+	Header string `json:"header,omitempty"`
+	// QueryParam is the query parameter a token is read from if the header isn't set. Headers are preferred, as URLs
+	// are more widely logged.
+	// Default: "defender_bypass"
+	QueryParam string `json:"query_param,omitempty"`
+	// ClientCertSubjects are the subjects of TLS client certificates which are let through, given either as the
+	// common name or as the full distinguished name, such as "CN=monitoring,O=Example". Only certificates verified
+	// by the server's client_auth settings are considered.
+	// Default: [] (client certificates are not accepted)
+	ClientCertSubjects []string `json:"client_cert_subjects,omitempty"`
+}
+
+// Validate ensures the bypass configuration is valid.
+func (c *Config) Validate() error {
+	if c.Secret == "" && len(c.ClientCertSubjects) == 0 {
+		return errors.New("bypass requires a secret or client certificate subjects")
+	}
+	if c.Secret != "" && len(c.Secret) < MinSecretLength {
+		return fmt.Errorf("bypass secret must be at least %d bytes long", MinSecretLength)
+	}
+	return nil
+}
+
+// SetDefaults sets the defaults of unset options.
+func (c *Config) SetDefaults() {
+	if c.Header == "" {
+		c.Header = DefaultHeader
+	}
+	if c.QueryParam == "" {
+		c.QueryParam = DefaultQueryParam
+	}
+}
+
+// Claims are the contents of a bypass token.
+type Claims struct {
+	// Subject identifies who the token was issued to, for logging.
+	Subject string `json:"sub"`
+	// Expiry is the Unix time the token expires at.
+	Expiry int64 `json:"exp"`
+	// Paths are the path prefixes the token is valid for. A token without paths is valid for every path.
+	Paths []string `json:"paths,omitempty"`
+}
+
+// Allows reports whether the claims cover a request path. Prefixes match whole path segments, so "/api" covers
+// "/api" and "/api/status", but not "/apis".
+func (c *Claims) Allows(p string) bool {
+	if len(c.Paths) == 0 {
+		return true
+	}
+	// Cleaning the path keeps "/api/../admin" from matching "/api"
+	p = path.Clean("/" + p)
+	for _, prefix := range c.Paths {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if p == prefix || prefix == "" || strings.HasPrefix(p, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Mint returns a token of the form "<claims>.<signature>", where the claims are base64url encoded JSON and the
+// signature is their HMAC-SHA256.
+func Mint(secret []byte, claims Claims) (string, error) {
+	if claims.Expiry == 0 {
+		return "", errors.New("bypass tokens must expire")
+	}
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + mac(secret, payload), nil
+}
+
+// Verify checks a token's signature and expiry, and returns its claims.
+func Verify(secret []byte, token string, now time.Time) (*Claims, error) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrMalformed
+	}
+	if !hmac.Equal([]byte(signature), []byte(mac(secret, payload))) {
+		return nil, ErrSignature
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	var claims Claims
+	if err := json.Unmarshal(data, &claims); err != nil || claims.Expiry == 0 {
+		return nil, ErrMalformed
+	}
+	if !now.Before(time.Unix(claims.Expiry, 0)) {
+		return nil, ErrExpired
+	}
+	return &claims, nil
+}
+
+func mac(secret []byte, payload string) string {
+	h := hmac.New(sha256.New, secret)
+	_, _ = h.Write([]byte("bypass|" + payload))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// Checker checks requests for bypass credentials.
+type Checker struct {
+	config *Config
+	secret []byte
+	now    func() time.Time
+}
+
+// New returns a new Checker. The config must have its defaults set.
+func New(config *Config) *Checker {
+	return &Checker{config: config, secret: []byte(config.Secret), now: time.Now}
+}
+
+// Allow reports whether a request carries valid bypass credentials in scope of its path, and returns the subject
+// they were issued to. Tokens are removed from the request so they aren't passed on to upstreams, but Caddy's access
+// log still records the request as it was received.
+func (c *Checker) Allow(r *http.Request) (string, bool) {
+	if subject, ok := c.allowCertificate(r); ok {
+		return subject, true
+	}
+	if c.config.Secret == "" {
+		return "", false
+	}
+
+	token := r.Header.Get(c.config.Header)
+	if token != "" {
+		r.Header.Del(c.config.Header)
+	} else {
+		var query string
+		if token, query = cutQueryParam(r.URL.RawQuery, c.config.QueryParam); token == "" {
+			return "", false
+		}
+		r.URL.RawQuery = query
+	}
+
+	claims, err := Verify(c.secret, token, c.now())
+	if err != nil || !claims.Allows(r.URL.Path) {
+		return "", false
+	}
+	return claims.Subject, true
+}
+
+// cutQueryParam returns the first value of a parameter in a raw query, and the query without the parameter. The rest
+// of the query is left as it was rather than re-encoded, as upstreams may depend on its order or encoding.
+func cutQueryParam(rawQuery, name string) (string, string) {
+	var value string
+	found := false
+	pairs := strings.Split(rawQuery, "&")
+	kept := pairs[:0]
+	for _, pair := range pairs {
+		key, v, _ := strings.Cut(pair, "=")
+		if key, err := url.QueryUnescape(key); err != nil || key != name {
+			kept = append(kept, pair)
+			continue
+		}
+		if !found {
+			value, _ = url.QueryUnescape(v)
+			found = true
+		}
+	}
+	return value, strings.Join(kept, "&")
+}
+
+// allowCertificate checks the leaf of the request's verified client certificate chains.
+func (c *Checker) allowCertificate(r *http.Request) (string, bool) {
+	if len(c.config.ClientCertSubjects) == 0 || r.TLS == nil {
+		return "", false
+	}
+	for _, chain := range r.TLS.VerifiedChains {
+		if len(chain) == 0 {
+			continue
+		}
+		if subject, ok := c.matchSubject(chain[0]); ok {
+			return subject, true
+		}
+	}
+	return "", false
+}
+
+func (c *Checker) matchSubject(cert *x509.Certificate) (string, bool) {
+	name := cert.Subject.String()
+	if slices.Contains(c.config.ClientCertSubjects, name) {
+		return name, true
+	}
+	if cn := cert.Subject.CommonName; cn != "" && slices.Contains(c.config.ClientCertSubjects, cn) {
+		return cn, true
+	}
+	return "", false
+}
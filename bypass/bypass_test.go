@@ -0,0 +1,195 @@
+package bypass
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testSecret = []byte("a test secret of some length")
+
+func mint(t *testing.T, claims Claims) string {
+	token, err := Mint(testSecret, claims)
+	require.NoError(t, err)
+	return token
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	token := mint(t, Claims{Subject: "ci", Expiry: now.Add(time.Hour).Unix(), Paths: []string{"/api"}})
+
+	t.Run("Valid", func(t *testing.T) {
+		claims, err := Verify(testSecret, token, now)
+		require.NoError(t, err)
+		require.Equal(t, &Claims{Subject: "ci", Expiry: now.Add(time.Hour).Unix(), Paths: []string{"/api"}}, claims)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		_, err := Verify(testSecret, token, now.Add(time.Hour))
+		require.ErrorIs(t, err, ErrExpired)
+	})
+
+	t.Run("Tampered claims", func(t *testing.T) {
+		payload, signature, _ := strings.Cut(token, ".")
+		other, _, _ := strings.Cut(mint(t, Claims{Subject: "ci", Expiry: now.Add(time.Hour).Unix()}), ".")
+		require.NotEqual(t, payload, other)
+
+		_, err := Verify(testSecret, other+"."+signature, now)
+		require.ErrorIs(t, err, ErrSignature)
+	})
+
+	t.Run("Tampered signature", func(t *testing.T) {
+		tampered := []byte(token)
+		tampered[len(tampered)-1] ^= 1
+		_, err := Verify(testSecret, string(tampered), now)
+		require.ErrorIs(t, err, ErrSignature)
+	})
+
+	t.Run("Other secret", func(t *testing.T) {
+		_, err := Verify([]byte("another secret of some length"), token, now)
+		require.ErrorIs(t, err, ErrSignature)
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		_, err := Verify(testSecret, "garbage", now)
+		require.ErrorIs(t, err, ErrMalformed)
+	})
+
+	t.Run("Tokens must expire", func(t *testing.T) {
+		_, err := Mint(testSecret, Claims{Subject: "ci"})
+		require.Error(t, err)
+	})
+}
+
+func TestClaimsAllows(t *testing.T) {
+	tests := []struct {
+		paths   []string
+		path    string
+		allowed bool
+	}{
+		{nil, "/anything", true},
+		{[]string{"/api"}, "/api", true},
+		{[]string{"/api"}, "/api/status", true},
+		{[]string{"/api/"}, "/api/status", true},
+		{[]string{"/api"}, "/apis", false},
+		{[]string{"/api"}, "/", false},
+		{[]string{"/api"}, "/api/../admin", false},
+		{[]string{"/api"}, "/api/./status", true},
+		{[]string{"/health", "/api"}, "/api/v1", true},
+		{[]string{"/"}, "/admin", true},
+	}
+	for _, tt := range tests {
+		claims := &Claims{Paths: tt.paths}
+		require.Equal(t, tt.allowed, claims.Allows(tt.path), "paths %v, path %s", tt.paths, tt.path)
+	}
+}
+
+func newChecker(config *Config, now time.Time) *Checker {
+	config.SetDefaults()
+	c := New(config)
+	c.now = func() time.Time { return now }
+	return c
+}
+
+func TestCheckerAllow(t *testing.T) {
+	now := time.Now()
+	c := newChecker(&Config{Secret: string(testSecret)}, now)
+	token := mint(t, Claims{Subject: "monitoring", Expiry: now.Add(time.Hour).Unix(), Paths: []string{"/health"}})
+
+	t.Run("Header", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/health", nil)
+		r.Header.Set(DefaultHeader, token)
+
+		subject, ok := c.Allow(r)
+		require.True(t, ok)
+		require.Equal(t, "monitoring", subject)
+		require.Empty(t, r.Header.Get(DefaultHeader))
+	})
+
+	t.Run("Query", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/health?verbose=1&"+DefaultQueryParam+"="+token, nil)
+
+		_, ok := c.Allow(r)
+		require.True(t, ok)
+		require.Equal(t, "verbose=1", r.URL.RawQuery)
+	})
+
+	t.Run("Query is otherwise left as is", func(t *testing.T) {
+		query := "z=1&a=%2f&" + DefaultQueryParam + "=" + token + "&flag&a=b+c&" + DefaultQueryParam + "=other"
+		r := httptest.NewRequest(http.MethodGet, "/health?"+query, nil)
+
+		_, ok := c.Allow(r)
+		require.True(t, ok)
+		require.Equal(t, "z=1&a=%2f&flag&a=b+c", r.URL.RawQuery)
+	})
+
+	t.Run("Out of scope", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		r.Header.Set(DefaultHeader, token)
+
+		_, ok := c.Allow(r)
+		require.False(t, ok)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		c := newChecker(&Config{Secret: string(testSecret)}, now.Add(2*time.Hour))
+		r := httptest.NewRequest(http.MethodGet, "/health", nil)
+		r.Header.Set(DefaultHeader, token)
+
+		_, ok := c.Allow(r)
+		require.False(t, ok)
+	})
+
+	t.Run("No credentials", func(t *testing.T) {
+		_, ok := c.Allow(httptest.NewRequest(http.MethodGet, "/health", nil))
+		require.False(t, ok)
+	})
+}
+
+func TestCheckerAllowCertificate(t *testing.T) {
+	c := newChecker(&Config{ClientCertSubjects: []string{"monitoring", "CN=ci,O=Example"}}, time.Now())
+	request := func(subject pkix.Name, verified bool) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		cert := &x509.Certificate{Subject: subject}
+		r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+		if verified {
+			r.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+		}
+		return r
+	}
+
+	subject, ok := c.Allow(request(pkix.Name{CommonName: "monitoring", Organization: []string{"Other"}}, true))
+	require.True(t, ok)
+	require.Equal(t, "monitoring", subject)
+
+	subject, ok = c.Allow(request(pkix.Name{CommonName: "ci", Organization: []string{"Example"}}, true))
+	require.True(t, ok)
+	require.Equal(t, "CN=ci,O=Example", subject)
+
+	_, ok = c.Allow(request(pkix.Name{CommonName: "ci", Organization: []string{"Other"}}, true))
+	require.False(t, ok)
+
+	// Certificates which weren't verified are ignored
+	_, ok = c.Allow(request(pkix.Name{CommonName: "monitoring"}, false))
+	require.False(t, ok)
+
+	// Tokens aren't accepted without a secret
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(DefaultHeader, mint(t, Claims{Subject: "ci", Expiry: time.Now().Add(time.Hour).Unix()}))
+	_, ok = c.Allow(r)
+	require.False(t, ok)
+}
+
+func TestConfigValidate(t *testing.T) {
+	require.NoError(t, (&Config{Secret: string(testSecret)}).Validate())
+	require.NoError(t, (&Config{ClientCertSubjects: []string{"ci"}}).Validate())
+	require.ErrorContains(t, (&Config{}).Validate(), "requires a secret")
+	require.ErrorContains(t, (&Config{Secret: "short"}).Validate(), "at least 16 bytes")
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jasonlovesdoggo/caddy-defender/bypass"
+)
+
+type pathsFlag []string
+
+func (p *pathsFlag) String() string { return strings.Join(*p, ",") }
+
+func (p *pathsFlag) Set(value string) error {
+	if !strings.HasPrefix(value, "/") {
+		return fmt.Errorf("path prefix must start with '/': '%s'", value)
+	}
+	*p = append(*p, value)
+	return nil
+}
+
+func main() {
+	var (
+		subject string
+		ttl     time.Duration
+		paths   pathsFlag
+	)
+	flag.StringVar(&subject, "subject", "", "Who the token is issued to, for logging (required)")
+	flag.DurationVar(&ttl, "ttl", 24*time.Hour, "How long the token is valid")
+	flag.Var(&paths, "path", "Path prefix the token is valid for (repeatable, default all paths)")
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "Usage: %s -subject <name> [-ttl <duration>] [-path <prefix>...]\n\n", os.Args[0])
+		fmt.Fprintln(out, "Mints a bypass token signed with the secret in $DEFENDER_BYPASS_SECRET.")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	secret := os.Getenv("DEFENDER_BYPASS_SECRET")
+	if len(secret) < bypass.MinSecretLength {
+		fail(fmt.Errorf("DEFENDER_BYPASS_SECRET must be set to a secret of at least %d bytes", bypass.MinSecretLength))
+	}
+	if subject == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if ttl <= 0 {
+		fail(fmt.Errorf("ttl must be positive"))
+	}
+
+	token, err := bypass.Mint([]byte(secret), bypass.Claims{
+		Subject: subject,
+		Expiry:  time.Now().Add(ttl).Unix(),
+		Paths:   paths,
+	})
+	if err != nil {
+		fail(err)
+	}
+	fmt.Println(token)
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+	os.Exit(1)
+}
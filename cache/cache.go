@@ -5,70 +5,171 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"os"
 	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/certmagic"
+)
+
+const (
+	// BackendFileSystem keeps the cache in a directory on the local filesystem.
+	BackendFileSystem = "filesystem"
+	// BackendStorage keeps the cache in Caddy's configured storage, so it is shared by a cluster.
+	BackendStorage = "storage"
+)
+
+// Backends are the backends a cache can be kept in.
+var Backends = []string{BackendFileSystem, BackendStorage}
+
+var (
+	// ErrCorrupt is returned when a cached file doesn't match its checksum.
+	ErrCorrupt = errors.New("cached file doesn't match its checksum")
+	// ErrTooLarge is returned when a file is larger than the maximum size of the cache on its own.
+	ErrTooLarge = errors.New("file is larger than the cache's max_size")
 )
 
-// For caching sources on the filesystem.
-var cacheParentDir = filepath.Join(os.TempDir(), "caddy-defender")
+// DefaultRoot returns the directory caches are kept in by default, in Caddy's data directory.
+func DefaultRoot() string {
+	return filepath.Join(caddy.AppDataDir(), "caddy-defender")
+}
 
 // Config is used for configuring the cache.
 type Config struct {
-	Directory string
+	// Root is the directory the cache is kept in.
+	// Default: caddy-defender in Caddy's data directory
+	Root string `json:"root,omitempty"`
+	// Directory is the subdirectory of Root for the cache's user, such as "tarpit".
+	Directory string `json:"directory,omitempty"`
+	// MaxSize is the total size in bytes of the cached files, beyond which the least recently written are evicted.
+	// Larger files aren't cached.
+	// Default: 0 (unlimited)
+	MaxSize int64 `json:"max_size,omitempty"`
+	// MaxAge is how long a cached file is kept after it is written.
+	// Default: 0 (forever)
+	MaxAge time.Duration `json:"max_age,omitempty"`
+	// Backend is where the cache is kept: "filesystem", in Root, or "storage", in Caddy's configured storage.
+	// Default: filesystem
+	Backend string `json:"backend,omitempty"`
 }
 
-// Cache is a filesystem cache that that allows for caching large files.
+// Validate ensures the cache configuration is valid.
+func (c *Config) Validate() error {
+	if c.MaxSize < 0 || c.MaxAge < 0 {
+		return errors.New("cache max_size and max_age must not be negative")
+	}
+	if c.Backend != "" && !slices.Contains(Backends, c.Backend) {
+		return fmt.Errorf("unknown cache backend '%s'", c.Backend)
+	}
+	return nil
+}
+
+// Backend is where a cache keeps its files. Files are replaced at once, so a reader never sees one partially written,
+// and those which are expired or corrupt are missed.
+type Backend interface {
+	// Get reads a file, returning whether it is cached.
+	Get(key string) (io.ReadCloser, bool, error)
+	// Exists reports whether a file is cached without reading it, so it may still turn out to be corrupt.
+	Exists(key string) (bool, error)
+	// Set writes a file, leaving any previous version in place if writing fails.
+	Set(key string, i io.ReadCloser) error
+	// Delete removes a file, if it is cached.
+	Delete(key string) error
+	// Lock serializes filling the cache for a key, returning the function releasing the lock.
+	Lock(key string) (func(), error)
+}
+
+// Cache is a cache of files, kept in a Backend.
 type Cache struct {
-	Config    *Config
-	directory string
+	Config  *Config
+	Backend Backend
 }
 
-// New returns a new Cache instance.
+// New returns a new Cache instance kept on the local filesystem.
 func New(c *Config) *Cache {
-	return &Cache{
-		directory: filepath.Join(cacheParentDir, c.Directory),
-	}
+	return &Cache{Config: c, Backend: NewFileSystem(c)}
 }
 
-// Get reads a file from the local cache.
-func (c *Cache) Get(key string) (io.ReadCloser, bool, error) {
-	cacheKey := generateCacheKey(key)
-	file, err := os.Open(filepath.Join(c.directory, cacheKey))
-	if errors.Is(err, os.ErrNotExist) {
-		return nil, false, nil
+// Open returns a new Cache instance kept in the backend of a config. The storage is only used by the storage
+// backend.
+func Open(c *Config, storage certmagic.Storage) (*Cache, error) {
+	switch c.Backend {
+	case "", BackendFileSystem:
+		return New(c), nil
+	case BackendStorage:
+		if storage == nil {
+			return nil, errors.New("cache backend 'storage' requires Caddy's storage")
+		}
+		return &Cache{Config: c, Backend: NewStorage(storage, c)}, nil
+	default:
+		return nil, fmt.Errorf("unknown cache backend '%s'", c.Backend)
 	}
+}
 
-	if err != nil {
-		return nil, false, err
-	}
+// Get reads a file from the cache.
+func (c *Cache) Get(key string) (io.ReadCloser, bool, error) {
+	return c.Backend.Get(key)
+}
 
-	return file, true, nil
+// Exists reports whether a file is in the cache, without reading it.
+func (c *Cache) Exists(key string) (bool, error) {
+	return c.Backend.Exists(key)
 }
 
-// Set writes a file in the local cache.
+// Set writes a file in the cache. It replaces any previous version of the file at once, and leaves it in place if
+// writing fails.
 func (c *Cache) Set(key string, i io.ReadCloser) error {
-	var defaultPermissions os.FileMode = 0700
+	return c.Backend.Set(key, i)
+}
 
-	err := os.MkdirAll(c.directory, defaultPermissions)
-	if err != nil {
-		return err
-	}
+// Delete removes a file from the cache, if it is there.
+func (c *Cache) Delete(key string) error {
+	return c.Backend.Delete(key)
+}
 
-	cacheKey := generateCacheKey(key)
-	filepath.Join(c.directory, cacheKey)
+// Lock serializes filling the cache for a key, so concurrent misses fetch a file once: each holds the lock while
+// checking the cache and setting the file. It returns the function releasing the lock.
+func (c *Cache) Lock(key string) (func(), error) {
+	return c.Backend.Lock(key)
+}
 
-	out, err := os.Create(filepath.Join(c.directory, cacheKey))
-	if err != nil {
-		return err
-	}
-	defer out.Close()
+// keyedMutex is a set of mutexes by key, which only holds those in use.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
 
-	_, err = io.Copy(out, i)
-	if err != nil {
-		return err
+type keyLock struct {
+	sync.Mutex
+	waiters int
+}
+
+// lock locks the mutex of a key, returning the function unlocking it.
+func (k *keyedMutex) lock(key string) func() {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = map[string]*keyLock{}
+	}
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyLock{}
+		k.locks[key] = l
 	}
+	l.waiters++
+	k.mu.Unlock()
 
-	return i.Close()
+	l.Lock()
+	return func() {
+		l.Unlock()
+		k.mu.Lock()
+		l.waiters--
+		if l.waiters == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
 }
 
 // generateCacheKey takes a source and returns an md5 checksum as a string for caching files.
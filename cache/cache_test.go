@@ -2,134 +2,337 @@ package cache
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/certmagic"
 )
 
 // Helper function to create a temporary cache instance for testing
-func newTestCache() *Cache {
-	return New(&Config{Directory: "test_cache"})
+func newTestCache(t *testing.T) *Cache {
+	return New(&Config{Root: t.TempDir(), Directory: "test_cache"})
+}
+
+// fileSystem returns the filesystem backend of a cache.
+func fileSystem(cache *Cache) *FileSystem {
+	return cache.Backend.(*FileSystem)
 }
 
 func TestNew(t *testing.T) {
 	t.Run("Ensure cache directory configured", func(t *testing.T) {
+		root := t.TempDir()
 		cacheDir := "test"
-		expected := filepath.Join(cacheParentDir, cacheDir)
+		expected := filepath.Join(root, cacheDir)
 		config := &Config{
+			Root:      root,
 			Directory: cacheDir,
 		}
 
 		cache := New(config)
-		if cache.directory != expected {
-			t.Errorf("expected %s, but got %s", expected, cache.directory)
+		if fileSystem(cache).directory != expected {
+			t.Errorf("expected %s, but got %s", expected, fileSystem(cache).directory)
+		}
+	})
+
+	t.Run("Ensure cache defaults to the data directory", func(t *testing.T) {
+		cache := New(&Config{Directory: "test"})
+		expected := filepath.Join(caddy.AppDataDir(), "caddy-defender", "test")
+		if fileSystem(cache).directory != expected {
+			t.Errorf("expected %s, but got %s", expected, fileSystem(cache).directory)
 		}
 	})
 }
 
-func TestGet(t *testing.T) {
-	t.Run("Ensure cache hit", func(t *testing.T) {
-		cache := newTestCache()
-		key := "test_key"
-		data := []byte("Hello, Cache!")
+func TestGenerateCacheKey(t *testing.T) {
+	path := "test_path"
+	expectedKey := "5da6ae5928d4a1ce395878ae9c7ea1f6" // MD5 hash of "test_path"
+	cacheKey := generateCacheKey(path)
+	if cacheKey != expectedKey {
+		t.Errorf("Expected cache key %s, but got: %s", expectedKey, cacheKey)
+	}
+}
+
+// readKey returns the cached content of a key, failing the test if it isn't cached.
+func readKey(t *testing.T, cache *Cache, key string) string {
+	t.Helper()
+	file, found, err := cache.Get(key)
+	if err != nil || !found {
+		t.Fatalf("Expected %s to be cached, but got found=%v, err=%v", key, found, err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatalf("Expected no error reading file, but got: %v", err)
+	}
+	return string(data)
+}
 
-		t.Cleanup(func() {
-			os.RemoveAll(cache.directory)
-		})
+func setKey(t *testing.T, cache *Cache, key, data string) {
+	t.Helper()
+	if err := cache.Set(key, io.NopCloser(strings.NewReader(data))); err != nil {
+		t.Fatalf("Expected no error from Set, but got: %v", err)
+	}
+}
 
-		// Create an io.Reader from the data
-		r := io.NopCloser(bytes.NewReader(data))
+func TestAtomicWrites(t *testing.T) {
+	cache := newTestCache(t)
+	setKey(t, cache, "key", "previous")
 
-		err := cache.Set(key, r)
-		if err != nil {
-			t.Errorf("Expected no error from Set, but got: %v", err)
+	// A failed write leaves no temporary file
+	failing := io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(io.ErrUnexpectedEOF))
+	err := cache.Set("key", io.NopCloser(failing))
+	if err == nil {
+		t.Fatal("Expected an error from Set with a failing reader, but got none")
+	}
+	entries, _ := os.ReadDir(fileSystem(cache).directory)
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), tempPrefix) {
+			t.Errorf("Expected no temporary files, but found %s", entry.Name())
 		}
+	}
+}
+
+func TestLock(t *testing.T) {
+	cache := newTestCache(t)
+	var fills atomic.Int64
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock, err := cache.Lock("key")
+			if err != nil {
+				t.Errorf("Expected no error from Lock, but got: %v", err)
+				return
+			}
+			defer unlock()
+			if _, found, _ := cache.Get("key"); found {
+				return
+			}
+			fills.Add(1)
+			time.Sleep(10 * time.Millisecond)
+			setKey(t, cache, "key", "data")
+		}()
+	}
+	wg.Wait()
+	if fills.Load() != 1 {
+		t.Errorf("Expected the key to be filled once, but it was filled %d times", fills.Load())
+	}
+	if len(fileSystem(cache).fills.locks) != 0 {
+		t.Errorf("Expected no locks to be held, but %d are", len(fileSystem(cache).fills.locks))
+	}
+}
+
+func TestIntegrity(t *testing.T) {
+	cache := newTestCache(t)
+	setKey(t, cache, "key", "Hello, Cache!")
+	readKey(t, cache, "key")
+
+	// Corrupt the file on disk, keeping its size
+	path := filepath.Join(fileSystem(cache).directory, generateCacheKey("key"))
+	if err := os.WriteFile(path, []byte("Hello, Trash!"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, err := cache.Get("key"); found || err != nil {
+		t.Errorf("Expected a corrupt file to be missed, but got found=%v, err=%v", found, err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected a corrupt file to be removed, but got: %v", err)
+	}
 
-		// Test Get function
-		file, found, err := cache.Get(key)
-		if err != nil {
-			t.Errorf("Expected no error from Get, but got: %v", err)
+	// A file without a checksum, such as after a crash, is missed too
+	setKey(t, cache, "key", "data")
+	if err := os.Remove(path + sumSuffix); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := cache.Get("key"); found {
+		t.Error("Expected a file without checksum to be missed, but it was found")
+	}
+}
+
+func TestEviction(t *testing.T) {
+	t.Run("Ensure least recently written files are evicted over max size", func(t *testing.T) {
+		cache := New(&Config{Root: t.TempDir(), MaxSize: 25})
+		start := time.Now().Add(-time.Hour)
+		for i, key := range []string{"a", "b", "c"} {
+			setKey(t, cache, key, strings.Repeat(key, 10))
+			// Make the write order visible regardless of the file system's timestamp resolution
+			mtime := start.Add(time.Duration(i) * time.Minute)
+			if err := os.Chtimes(filepath.Join(fileSystem(cache).directory, generateCacheKey(key)), mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
 		}
-		if !found {
-			t.Error("Expected file to be found in cache, but it was not")
+		setKey(t, cache, "d", strings.Repeat("d", 10))
+
+		for key, expected := range map[string]bool{"a": false, "b": false, "c": true, "d": true} {
+			if _, found, _ := cache.Get(key); found != expected {
+				t.Errorf("Expected %s to be cached: %v, but got %v", key, expected, found)
+			}
 		}
+	})
 
-		// Read data from the file
-		readData, err := io.ReadAll(file)
-		if err != nil {
-			t.Fatalf("Expected no error reading file, but got: %v", err)
+	t.Run("Ensure files expire after max age", func(t *testing.T) {
+		cache := New(&Config{Root: t.TempDir(), MaxAge: time.Minute})
+		setKey(t, cache, "old", "old")
+		setKey(t, cache, "new", "new")
+		past := time.Now().Add(-2 * time.Minute)
+		path := filepath.Join(fileSystem(cache).directory, generateCacheKey("old"))
+		if err := os.Chtimes(path, past, past); err != nil {
+			t.Fatal(err)
 		}
 
-		// Check that the data matches what was written
-		if string(readData) != string(data) {
-			t.Fatalf("Expected data %s, but got: %s", data, readData)
+		if _, found, _ := cache.Get("old"); found {
+			t.Error("Expected an expired file to be missed, but it was found")
+		}
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected an expired file to be removed, but got: %v", err)
 		}
+		readKey(t, cache, "new")
 	})
 
-	t.Run("Ensure cache miss", func(t *testing.T) {
-		cache := newTestCache()
-		key := "nonexistent_key"
-
-		// Test Get function with a key that does not exist
-		file, found, err := cache.Get(key)
-		if err != nil {
-			t.Errorf("Expected no error from Get, but got: %v", err)
+	t.Run("Ensure leftover temporary files are removed", func(t *testing.T) {
+		cache := newTestCache(t)
+		setKey(t, cache, "key", "data")
+		leftover := filepath.Join(fileSystem(cache).directory, tempPrefix+"crashed")
+		if err := os.WriteFile(leftover, []byte("partial"), 0o600); err != nil {
+			t.Fatal(err)
 		}
-		if found {
-			t.Error("Expected file not to be found in cache, but it was")
+		past := time.Now().Add(-2 * staleTempAge)
+		if err := os.Chtimes(leftover, past, past); err != nil {
+			t.Fatal(err)
 		}
-		if file != nil {
-			t.Error("Expected file to be nil for nonexistent cache entry")
+
+		setKey(t, cache, "other", "data")
+		if _, err := os.Stat(leftover); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected a leftover temporary file to be removed, but got: %v", err)
 		}
 	})
 }
 
-func TestSet(t *testing.T) {
-	t.Run("Ensure data is written to cache", func(t *testing.T) {
-		cache := newTestCache()
-		key := "some_key"
-		data := []byte("") // Empty data
+func TestConfigValidate(t *testing.T) {
+	if err := (&Config{MaxSize: -1}).Validate(); err == nil {
+		t.Error("Expected an error for a negative max size, but got none")
+	}
+	if err := (&Config{Backend: "redis"}).Validate(); err == nil {
+		t.Error("Expected an error for an unknown backend, but got none")
+	}
+	if err := (&Config{MaxSize: 1, MaxAge: time.Hour, Backend: BackendStorage}).Validate(); err != nil {
+		t.Errorf("Expected no error, but got: %v", err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	storage := &certmagic.FileStorage{Path: t.TempDir()}
 
-		t.Cleanup(func() {
-			os.RemoveAll(cache.directory)
-		})
+	cache, err := Open(&Config{Root: t.TempDir()}, storage)
+	if err != nil {
+		t.Fatalf("Expected no error from Open, but got: %v", err)
+	}
+	if _, ok := cache.Backend.(*FileSystem); !ok {
+		t.Errorf("Expected the filesystem backend by default, but got %T", cache.Backend)
+	}
 
-		// Create an io.Reader from the empty data
-		r := io.NopCloser(bytes.NewReader(data))
+	cache, err = Open(&Config{Backend: BackendStorage}, storage)
+	if err != nil {
+		t.Fatalf("Expected no error from Open, but got: %v", err)
+	}
+	if _, ok := cache.Backend.(*Storage); !ok {
+		t.Errorf("Expected the storage backend, but got %T", cache.Backend)
+	}
 
-		// Test Set function with empty data
-		err := cache.Set(key, r)
-		if err != nil {
-			t.Errorf("Expected no error from Set, but got: %v", err)
-		}
+	if _, err := Open(&Config{Backend: BackendStorage}, nil); err == nil {
+		t.Error("Expected an error for the storage backend without storage, but got none")
+	}
+	if _, err := Open(&Config{Backend: "redis"}, storage); err == nil {
+		t.Error("Expected an error for an unknown backend, but got none")
+	}
+}
 
-		file, found, err := cache.Get(key)
-		if err != nil {
-			t.Errorf("Expected no error from Get, but got: %v", err)
-		}
-		if !found {
-			t.Error("Expected file to be found in cache, but it was not")
-		}
+func TestStorageIntegrity(t *testing.T) {
+	storage := &certmagic.FileStorage{Path: t.TempDir()}
+	cache := &Cache{Backend: NewStorage(storage, &Config{Directory: "test_cache"})}
+	setKey(t, cache, "key", "Hello, Cache!")
+	readKey(t, cache, "key")
 
-		// Read data from the file
-		readData, err := io.ReadAll(file)
-		if err != nil {
-			t.Fatalf("Expected no error reading file, but got: %v", err)
-		}
+	// Files are kept under the cache's prefix in the storage
+	key := storagePrefix + "/test_cache/" + generateCacheKey("key")
+	value, err := storage.Load(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Expected the file to be stored as %s, but got: %v", key, err)
+	}
 
-		// Check that the data matches the empty data
-		if string(readData) != string(data) {
-			t.Fatalf("Expected data %s, but got: %s", data, readData)
-		}
-	})
+	// Corrupt the stored object, keeping its size
+	corrupt := bytes.Replace(value, []byte("Cache"), []byte("Trash"), 1)
+	if err := storage.Store(context.Background(), key, corrupt); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, err := cache.Get("key"); found || err != nil {
+		t.Errorf("Expected a corrupt file to be missed, but got found=%v, err=%v", found, err)
+	}
+	if storage.Exists(context.Background(), key) {
+		t.Error("Expected a corrupt file to be removed, but it exists")
+	}
+
+	// An object without a checksum is missed too
+	if err := storage.Store(context.Background(), key, []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := cache.Get("key"); found {
+		t.Error("Expected a file without checksum to be missed, but it was found")
+	}
 }
 
-func TestGenerateCacheKey(t *testing.T) {
-	path := "test_path"
-	expectedKey := "5da6ae5928d4a1ce395878ae9c7ea1f6" // MD5 hash of "test_path"
-	cacheKey := generateCacheKey(path)
-	if cacheKey != expectedKey {
-		t.Errorf("Expected cache key %s, but got: %s", expectedKey, cacheKey)
+// countingStorage is a storage counting the objects loaded from it.
+type countingStorage struct {
+	*certmagic.FileStorage
+	loads atomic.Int64
+}
+
+func (c *countingStorage) Load(ctx context.Context, key string) ([]byte, error) {
+	c.loads.Add(1)
+	return c.FileStorage.Load(ctx, key)
+}
+
+func TestStorageLoads(t *testing.T) {
+	storage := &countingStorage{FileStorage: &certmagic.FileStorage{Path: t.TempDir()}}
+	cache := &Cache{Backend: NewStorage(storage, &Config{Directory: "test_cache"})}
+	setKey(t, cache, "key", "Hello, Cache!")
+
+	// Checking a file doesn't load it
+	if found, err := cache.Exists("key"); !found || err != nil {
+		t.Errorf("Expected the file to exist, but got found=%v, err=%v", found, err)
+	}
+	if found, err := cache.Exists("other"); found || err != nil {
+		t.Errorf("Expected a missing file not to exist, but got found=%v, err=%v", found, err)
+	}
+	if storage.loads.Load() != 0 {
+		t.Errorf("Expected no loads to check files, but got %d", storage.loads.Load())
+	}
+
+	// A version of a file is loaded once
+	for range 5 {
+		readKey(t, cache, "key")
+	}
+	if storage.loads.Load() != 1 {
+		t.Errorf("Expected a file to be loaded once, but it was loaded %d times", storage.loads.Load())
+	}
+
+	setKey(t, cache, "key", "Hello again!")
+	if got := readKey(t, cache, "key"); got != "Hello again!" {
+		t.Errorf("Expected the new version, but got %s", got)
+	}
+	readKey(t, cache, "key")
+	if storage.loads.Load() != 2 {
+		t.Errorf("Expected a new version to be loaded once, but files were loaded %d times", storage.loads.Load())
 	}
 }
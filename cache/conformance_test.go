@@ -0,0 +1,267 @@
+package cache
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/caddyserver/certmagic"
+)
+
+// newBackendFunc returns a backend for a config, in a new location, reading the time from now.
+type newBackendFunc func(t *testing.T, c *Config, now func() time.Time) Backend
+
+func TestFileSystemConformance(t *testing.T) {
+	testBackend(t, func(t *testing.T, c *Config, now func() time.Time) Backend {
+		c.Root = t.TempDir()
+		return newFileSystem(c, now)
+	})
+}
+
+func TestStorageConformance(t *testing.T) {
+	testBackend(t, func(t *testing.T, c *Config, now func() time.Time) Backend {
+		return newStorage(&certmagic.FileStorage{Path: t.TempDir()}, c, now)
+	})
+}
+
+// closeRecorder is a file to cache which records whether it was closed.
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+// testClock is a clock for backends which only moves when advanced.
+type testClock struct {
+	now atomic.Int64
+}
+
+func newTestClock() *testClock {
+	clock := &testClock{}
+	clock.now.Store(time.Now().UnixNano())
+	return clock
+}
+
+func (c *testClock) Now() time.Time {
+	return time.Unix(0, c.now.Load())
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.now.Add(int64(d))
+}
+
+// testBackend runs the tests every Backend must pass.
+func testBackend(t *testing.T, newBackend newBackendFunc) {
+	open := func(t *testing.T, c *Config) *Cache {
+		c.Directory = "test_cache"
+		return &Cache{Config: c, Backend: newBackend(t, c, time.Now)}
+	}
+
+	t.Run("Ensure cache miss", func(t *testing.T) {
+		cache := open(t, &Config{})
+		file, found, err := cache.Get("nonexistent_key")
+		if err != nil {
+			t.Errorf("Expected no error from Get, but got: %v", err)
+		}
+		if found || file != nil {
+			t.Error("Expected file not to be found in cache, but it was")
+		}
+	})
+
+	t.Run("Ensure existence is checked", func(t *testing.T) {
+		clock := newTestClock()
+		config := &Config{Directory: "test_cache", MaxAge: time.Minute}
+		cache := &Cache{Config: config, Backend: newBackend(t, config, clock.Now)}
+		if found, err := cache.Exists("key"); found || err != nil {
+			t.Errorf("Expected a missing file not to exist, but got found=%v, err=%v", found, err)
+		}
+		setKey(t, cache, "key", "data")
+		if found, err := cache.Exists("key"); !found || err != nil {
+			t.Errorf("Expected the file to exist, but got found=%v, err=%v", found, err)
+		}
+
+		clock.Advance(2 * time.Minute)
+		if found, err := cache.Exists("key"); found || err != nil {
+			t.Errorf("Expected an expired file not to exist, but got found=%v, err=%v", found, err)
+		}
+	})
+
+	t.Run("Ensure data is written and replaced", func(t *testing.T) {
+		cache := open(t, &Config{})
+		for _, data := range []string{"Hello, Cache!", "", strings.Repeat("large", 1<<18), "replaced"} {
+			setKey(t, cache, "key", data)
+			if got := readKey(t, cache, "key"); got != data {
+				t.Errorf("Expected %d bytes, but got %d", len(data), len(got))
+			}
+		}
+	})
+
+	t.Run("Ensure keys are kept apart", func(t *testing.T) {
+		cache := open(t, &Config{})
+		setKey(t, cache, "a", "first")
+		setKey(t, cache, "b", "second")
+		if got := readKey(t, cache, "a"); got != "first" {
+			t.Errorf("Expected first, but got %s", got)
+		}
+		if got := readKey(t, cache, "b"); got != "second" {
+			t.Errorf("Expected second, but got %s", got)
+		}
+	})
+
+	t.Run("Ensure files are deleted", func(t *testing.T) {
+		cache := open(t, &Config{})
+		setKey(t, cache, "key", "data")
+		setKey(t, cache, "other", "data")
+		if err := cache.Delete("key"); err != nil {
+			t.Errorf("Expected no error from Delete, but got: %v", err)
+		}
+		if _, found, _ := cache.Get("key"); found {
+			t.Error("Expected file not to be found in cache after Delete, but it was")
+		}
+		readKey(t, cache, "other")
+
+		// Deleting a missing file is fine
+		if err := cache.Delete("key"); err != nil {
+			t.Errorf("Expected no error from Delete of a missing file, but got: %v", err)
+		}
+	})
+
+	t.Run("Ensure files are replaced at once", func(t *testing.T) {
+		cache := open(t, &Config{})
+		versions := []string{strings.Repeat("a", 1<<20), strings.Repeat("b", 1<<20)}
+		setKey(t, cache, "key", versions[0])
+
+		var wg sync.WaitGroup
+		done := make(chan struct{})
+		for range 4 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-done:
+						return
+					default:
+					}
+					if data := readKey(t, cache, "key"); data != versions[0] && data != versions[1] {
+						t.Errorf("Read a partial file of %d bytes", len(data))
+						return
+					}
+				}
+			}()
+		}
+		for i := range 20 {
+			setKey(t, cache, "key", versions[i%2])
+		}
+		close(done)
+		wg.Wait()
+	})
+
+	t.Run("Ensure a failed write leaves the previous version", func(t *testing.T) {
+		cache := open(t, &Config{})
+		setKey(t, cache, "key", "previous")
+		failing := &closeRecorder{Reader: io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(io.ErrUnexpectedEOF))}
+		if err := cache.Set("key", failing); err == nil {
+			t.Fatal("Expected an error from Set with a failing reader, but got none")
+		}
+		if !failing.closed {
+			t.Error("Expected the file to be closed after a failed Set, but it wasn't")
+		}
+		if got := readKey(t, cache, "key"); got != "previous" {
+			t.Errorf("Expected the previous version after a failed Set, but got %s", got)
+		}
+	})
+
+	t.Run("Ensure a locked key is filled once", func(t *testing.T) {
+		cache := open(t, &Config{})
+		var fills atomic.Int64
+		var wg sync.WaitGroup
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				unlock, err := cache.Lock("key")
+				if err != nil {
+					t.Errorf("Expected no error from Lock, but got: %v", err)
+					return
+				}
+				defer unlock()
+				if _, found, _ := cache.Get("key"); found {
+					return
+				}
+				fills.Add(1)
+				time.Sleep(10 * time.Millisecond)
+				setKey(t, cache, "key", "data")
+			}()
+		}
+		wg.Wait()
+		if fills.Load() != 1 {
+			t.Errorf("Expected the key to be filled once, but it was filled %d times", fills.Load())
+		}
+	})
+
+	t.Run("Ensure files expire after max age", func(t *testing.T) {
+		clock := newTestClock()
+		config := &Config{Directory: "test_cache", MaxAge: time.Minute}
+		cache := &Cache{Config: config, Backend: newBackend(t, config, clock.Now)}
+		setKey(t, cache, "key", "data")
+		readKey(t, cache, "key")
+
+		clock.Advance(2 * time.Minute)
+		if _, found, _ := cache.Get("key"); found {
+			t.Error("Expected an expired file to be missed, but it was found")
+		}
+	})
+
+	t.Run("Ensure least recently written files are evicted over max size", func(t *testing.T) {
+		// Room for two files, whatever a backend stores alongside them
+		cache := open(t, &Config{MaxSize: 2500})
+		for _, key := range []string{"a", "b", "c"} {
+			setKey(t, cache, key, strings.Repeat(key, 1000))
+			// Make the write order visible regardless of the timestamp resolution
+			time.Sleep(20 * time.Millisecond)
+		}
+
+		for key, expected := range map[string]bool{"a": false, "b": true, "c": true} {
+			if _, found, _ := cache.Get(key); found != expected {
+				t.Errorf("Expected %s to be cached: %v, but got %v", key, expected, found)
+			}
+		}
+	})
+
+	t.Run("Ensure files over max size are refused", func(t *testing.T) {
+		cache := open(t, &Config{MaxSize: 2500})
+		setKey(t, cache, "key", "previous")
+
+		large := &closeRecorder{Reader: strings.NewReader(strings.Repeat("a", 2501))}
+		if err := cache.Set("key", large); !errors.Is(err, ErrTooLarge) {
+			t.Errorf("Expected ErrTooLarge from Set, but got: %v", err)
+		}
+		if !large.closed {
+			t.Error("Expected the file to be closed after a refused Set, but it wasn't")
+		}
+		if got := readKey(t, cache, "key"); got != "previous" {
+			t.Errorf("Expected the previous version after a refused Set, but got %s", got)
+		}
+	})
+
+	t.Run("Ensure a file just written isn't evicted", func(t *testing.T) {
+		// A file filling the cache on its own evicts the others rather than itself
+		cache := open(t, &Config{MaxSize: 2500})
+		setKey(t, cache, "other", strings.Repeat("o", 1000))
+		setKey(t, cache, "key", strings.Repeat("a", 2000))
+		readKey(t, cache, "key")
+		if _, found, _ := cache.Get("other"); found {
+			t.Error("Expected the other file to be evicted, but it was found")
+		}
+	})
+}
@@ -0,0 +1,319 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// sumSuffix is the suffix of the file holding the checksum of a cached file.
+	sumSuffix = ".sum"
+	// tempPrefix is the prefix of files being written, which aren't part of the cache until renamed.
+	tempPrefix = ".tmp-"
+	// staleTempAge is the age after which a leftover temporary file, such as from a crash, is removed.
+	staleTempAge = time.Hour
+)
+
+// FileSystem is a Backend keeping files in a directory on the local filesystem, which allows for caching large files.
+//
+// Files are written to a temporary file and renamed into place, so they are never seen partially written, and are
+// checked against a checksum before they are first read.
+type FileSystem struct {
+	config    *Config
+	directory string
+	now       func() time.Time
+
+	// files serializes access to the file and checksum of a key, so they are consistent.
+	files keyedMutex
+	// fills serializes filling a key, for Lock.
+	fills keyedMutex
+
+	mu sync.Mutex
+	// verified are the files whose checksum was checked, by key, as they were then.
+	verified map[string]verifiedFile
+}
+
+// verifiedFile identifies the version of a file whose checksum was checked.
+type verifiedFile struct {
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+// NewFileSystem returns a FileSystem backend in the Directory of the Root of a config.
+func NewFileSystem(c *Config) *FileSystem {
+	return newFileSystem(c, time.Now)
+}
+
+func newFileSystem(c *Config, now func() time.Time) *FileSystem {
+	root := c.Root
+	if root == "" {
+		root = DefaultRoot()
+	}
+	return &FileSystem{
+		config:    c,
+		directory: filepath.Join(root, c.Directory),
+		now:       now,
+		verified:  map[string]verifiedFile{},
+	}
+}
+
+// Get reads a file from the local cache. Files which are expired or corrupt are removed and missed.
+func (f *FileSystem) Get(key string) (io.ReadCloser, bool, error) {
+	cacheKey := generateCacheKey(key)
+	unlock := f.files.lock(cacheKey)
+	defer unlock()
+
+	path := filepath.Join(f.directory, cacheKey)
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, false, err
+	}
+	if f.config.MaxAge > 0 && f.now().Sub(info.ModTime()) > f.config.MaxAge {
+		file.Close()
+		return nil, false, f.remove(cacheKey)
+	}
+	if err := f.verify(cacheKey, file, info); err != nil {
+		file.Close()
+		if errors.Is(err, ErrCorrupt) {
+			return nil, false, f.remove(cacheKey)
+		}
+		return nil, false, err
+	}
+
+	return file, true, nil
+}
+
+// Exists reports whether a file is in the local cache, without reading it. Expired files are removed and missed.
+func (f *FileSystem) Exists(key string) (bool, error) {
+	cacheKey := generateCacheKey(key)
+	unlock := f.files.lock(cacheKey)
+	defer unlock()
+
+	info, err := os.Stat(filepath.Join(f.directory, cacheKey))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if f.config.MaxAge > 0 && f.now().Sub(info.ModTime()) > f.config.MaxAge {
+		return false, f.remove(cacheKey)
+	}
+	return true, nil
+}
+
+// Set writes a file in the local cache. It replaces any previous version of the file at once, and leaves it in
+// place if writing fails or the file is larger than the maximum size.
+func (f *FileSystem) Set(key string, i io.ReadCloser) error {
+	defer i.Close()
+	var defaultPermissions os.FileMode = 0700
+
+	err := os.MkdirAll(f.directory, defaultPermissions)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file, so the file is complete once it is in place
+	out, err := os.CreateTemp(f.directory, tempPrefix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+
+	var reader io.Reader = i
+	if f.config.MaxSize > 0 {
+		// Reading one byte past the maximum size is enough to refuse the file
+		reader = io.LimitReader(i, f.config.MaxSize+1)
+	}
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(out, hash), reader)
+	if err == nil && f.config.MaxSize > 0 && n > f.config.MaxSize {
+		err = ErrTooLarge
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	cacheKey := generateCacheKey(key)
+	path := filepath.Join(f.directory, cacheKey)
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	unlock := f.files.lock(cacheKey)
+	if err := os.Rename(out.Name(), path); err != nil {
+		unlock()
+		return err
+	}
+	err = writeFileAtomic(path+sumSuffix, []byte(sum))
+	unlock()
+	if err != nil {
+		return err
+	}
+
+	return f.evict(cacheKey)
+}
+
+// Delete removes a file from the local cache, if it is there.
+func (f *FileSystem) Delete(key string) error {
+	cacheKey := generateCacheKey(key)
+	unlock := f.files.lock(cacheKey)
+	defer unlock()
+	return f.remove(cacheKey)
+}
+
+// Lock serializes filling the cache for a key within the process.
+func (f *FileSystem) Lock(key string) (func(), error) {
+	return f.fills.lock(generateCacheKey(key)), nil
+}
+
+// verify checks an opened file against its checksum, unless this version of it was checked already. The file lock
+// must be held.
+func (f *FileSystem) verify(cacheKey string, file *os.File, info os.FileInfo) error {
+	sum, err := os.ReadFile(filepath.Join(f.directory, cacheKey+sumSuffix))
+	if errors.Is(err, os.ErrNotExist) {
+		// Written, but not checksummed
+		return ErrCorrupt
+	}
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	verified, ok := f.verified[cacheKey]
+	f.mu.Unlock()
+	if ok && verified.size == info.Size() && verified.modTime.Equal(info.ModTime()) && verified.sum == string(sum) {
+		return nil
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != string(sum) {
+		return ErrCorrupt
+	}
+
+	f.mu.Lock()
+	f.verified[cacheKey] = verifiedFile{size: info.Size(), modTime: info.ModTime(), sum: string(sum)}
+	f.mu.Unlock()
+	return nil
+}
+
+// remove removes the file of a key and its checksum. The file lock must be held.
+func (f *FileSystem) remove(cacheKey string) error {
+	f.mu.Lock()
+	delete(f.verified, cacheKey)
+	f.mu.Unlock()
+
+	path := filepath.Join(f.directory, cacheKey)
+	err := os.Remove(path + sumSuffix)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// cachedFile is a file in the cache directory, for eviction.
+type cachedFile struct {
+	cacheKey string
+	size     int64
+	modTime  time.Time
+}
+
+// evict removes expired files, leftover temporary files and, while the cache is over its maximum size, the least
+// recently written files, except for the file of a key just written.
+func (f *FileSystem) evict(keep string) error {
+	entries, err := os.ReadDir(f.directory)
+	if err != nil {
+		return err
+	}
+
+	var files []cachedFile
+	var total int64
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			// Removed in the meantime
+			continue
+		}
+		name := entry.Name()
+		switch {
+		case strings.HasPrefix(name, tempPrefix):
+			if f.now().Sub(info.ModTime()) > staleTempAge {
+				_ = os.Remove(filepath.Join(f.directory, name))
+			}
+		case strings.HasSuffix(name, sumSuffix):
+			// Checksums are too small to count
+		default:
+			files = append(files, cachedFile{cacheKey: name, size: info.Size(), modTime: info.ModTime()})
+			total += info.Size()
+		}
+	}
+
+	slices.SortFunc(files, func(a, b cachedFile) int { return a.modTime.Compare(b.modTime) })
+	for _, file := range files {
+		if file.cacheKey == keep {
+			continue
+		}
+		expired := f.config.MaxAge > 0 && f.now().Sub(file.modTime) > f.config.MaxAge
+		if !expired && (f.config.MaxSize == 0 || total <= f.config.MaxSize) {
+			continue
+		}
+		unlock := f.files.lock(file.cacheKey)
+		err := f.remove(file.cacheKey)
+		unlock()
+		if err != nil {
+			return err
+		}
+		total -= file.size
+	}
+	return nil
+}
+
+// writeFileAtomic writes a file through a temporary file renamed into place.
+func writeFileAtomic(path string, data []byte) error {
+	out, err := os.CreateTemp(filepath.Dir(path), tempPrefix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+
+	_, err = out.Write(data)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), path)
+}
@@ -0,0 +1,303 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/certmagic"
+)
+
+// storagePrefix is the storage key caches are kept under, by Directory.
+const storagePrefix = "caddy-defender/cache"
+
+// Storage is a Backend keeping files in a certmagic.Storage, such as the storage Caddy is configured with, so nodes
+// of a cluster sharing it fetch each file once.
+//
+// Each file is stored as a single object, prefixed with its checksum, so it is replaced at once and checked before
+// it is first read. Files are held in memory while they are written, and kept in memory once checked, by version, so
+// reading them again doesn't load them from the storage.
+type Storage struct {
+	config  *Config
+	storage certmagic.Storage
+	prefix  string
+	now     func() time.Time
+
+	// files serializes access to the object of a key within the process, so a corrupt one isn't removed after being
+	// replaced.
+	files keyedMutex
+	// fills serializes filling a key within the process, before taking the storage lock.
+	fills keyedMutex
+
+	mu sync.Mutex
+	// verified are the files of the objects whose checksum was checked, by key, as they were then.
+	verified map[string]storedFile
+}
+
+// storedFile is the file of a version of an object whose checksum was checked.
+type storedFile struct {
+	size    int64
+	modTime time.Time
+	data    []byte
+}
+
+// NewStorage returns a Storage backend in the Directory of a config. Its Root is unused.
+func NewStorage(storage certmagic.Storage, c *Config) *Storage {
+	return newStorage(storage, c, time.Now)
+}
+
+func newStorage(storage certmagic.Storage, c *Config, now func() time.Time) *Storage {
+	return &Storage{
+		config:   c,
+		storage:  storage,
+		prefix:   path.Join(storagePrefix, c.Directory),
+		now:      now,
+		verified: map[string]storedFile{},
+	}
+}
+
+// Get reads a file from the storage. Files which are expired or corrupt are removed and missed.
+func (s *Storage) Get(key string) (io.ReadCloser, bool, error) {
+	ctx := context.Background()
+	cacheKey := generateCacheKey(key)
+	info, ok, err := s.stat(ctx, cacheKey)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	if data, ok := s.stored(cacheKey, info); ok {
+		return memoryFile{bytes.NewReader(data)}, true, nil
+	}
+
+	// Loading doesn't hold the file lock, so it doesn't hold up readers of other versions
+	value, err := s.storage.Load(ctx, s.key(cacheKey))
+	if errors.Is(err, fs.ErrNotExist) {
+		// Removed in the meantime
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	data, err := s.verify(cacheKey, value, info)
+	if errors.Is(err, ErrCorrupt) {
+		return nil, false, s.removeCorrupt(ctx, cacheKey, info)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return memoryFile{bytes.NewReader(data)}, true, nil
+}
+
+// Exists reports whether a file is in the storage, without loading it. Expired files are removed and missed.
+func (s *Storage) Exists(key string) (bool, error) {
+	_, ok, err := s.stat(context.Background(), generateCacheKey(key))
+	return ok, err
+}
+
+// stat returns the info of the object of a key, and whether it is there. Expired objects are removed and missed.
+func (s *Storage) stat(ctx context.Context, cacheKey string) (certmagic.KeyInfo, bool, error) {
+	unlock := s.files.lock(cacheKey)
+	defer unlock()
+
+	info, err := s.storage.Stat(ctx, s.key(cacheKey))
+	if errors.Is(err, fs.ErrNotExist) {
+		return info, false, nil
+	}
+	if err != nil {
+		return info, false, err
+	}
+	if s.config.MaxAge > 0 && s.now().Sub(info.Modified) > s.config.MaxAge {
+		return info, false, s.remove(ctx, cacheKey)
+	}
+	return info, true, nil
+}
+
+// Set writes a file in the storage. It replaces any previous version of the file at once, and leaves it in place if
+// reading the file fails or its object is larger than the maximum size.
+func (s *Storage) Set(key string, i io.ReadCloser) error {
+	defer i.Close()
+	var reader io.Reader = i
+	if s.config.MaxSize > 0 {
+		// Reading one byte past the maximum size is enough to refuse the file
+		reader = io.LimitReader(i, s.config.MaxSize+1)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	value := make([]byte, 0, hex.EncodedLen(len(sum))+1+len(data))
+	value = hex.AppendEncode(value, sum[:])
+	value = append(value, '\n')
+	value = append(value, data...)
+	if s.config.MaxSize > 0 && int64(len(value)) > s.config.MaxSize {
+		return ErrTooLarge
+	}
+
+	cacheKey := generateCacheKey(key)
+	unlock := s.files.lock(cacheKey)
+	err = s.storage.Store(context.Background(), s.key(cacheKey), value)
+	s.mu.Lock()
+	delete(s.verified, cacheKey)
+	s.mu.Unlock()
+	unlock()
+	if err != nil {
+		return err
+	}
+
+	return s.evict(cacheKey)
+}
+
+// Delete removes a file from the storage, if it is there.
+func (s *Storage) Delete(key string) error {
+	cacheKey := generateCacheKey(key)
+	unlock := s.files.lock(cacheKey)
+	defer unlock()
+	return s.remove(context.Background(), cacheKey)
+}
+
+// Lock serializes filling the cache for a key across every node sharing the storage.
+func (s *Storage) Lock(key string) (func(), error) {
+	cacheKey := generateCacheKey(key)
+	unlock := s.fills.lock(cacheKey)
+
+	// Storage locks are named apart from keys, so the object's key names its lock
+	name := s.key(cacheKey)
+	if err := s.storage.Lock(context.Background(), name); err != nil {
+		unlock()
+		return nil, err
+	}
+	return func() {
+		// A lock which fails to be released expires, so there is nothing more to do
+		_ = s.storage.Unlock(context.Background(), name)
+		unlock()
+	}, nil
+}
+
+// stored returns the file of a version of an object, if it was checked already.
+func (s *Storage) stored(cacheKey string, info certmagic.KeyInfo) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.verified[cacheKey]
+	if !ok || stored.size != info.Size || !stored.modTime.Equal(info.Modified) {
+		return nil, false
+	}
+	return stored.data, true
+}
+
+// verify checks a loaded version of an object against the checksum it starts with, and returns the file in it, which
+// is kept for later reads of that version.
+func (s *Storage) verify(cacheKey string, value []byte, info certmagic.KeyInfo) ([]byte, error) {
+	sum, data, ok := bytes.Cut(value, []byte{'\n'})
+	if !ok || len(sum) != hex.EncodedLen(sha256.Size) {
+		return nil, ErrCorrupt
+	}
+	actual := sha256.Sum256(data)
+	if hex.EncodeToString(actual[:]) != string(sum) {
+		return nil, ErrCorrupt
+	}
+
+	s.mu.Lock()
+	s.verified[cacheKey] = storedFile{size: info.Size, modTime: info.Modified, data: data}
+	s.mu.Unlock()
+	return data, nil
+}
+
+// removeCorrupt removes the object of a key found corrupt, unless it was replaced since.
+func (s *Storage) removeCorrupt(ctx context.Context, cacheKey string, corrupt certmagic.KeyInfo) error {
+	unlock := s.files.lock(cacheKey)
+	defer unlock()
+
+	info, err := s.storage.Stat(ctx, s.key(cacheKey))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Size != corrupt.Size || !info.Modified.Equal(corrupt.Modified) {
+		return nil
+	}
+	return s.remove(ctx, cacheKey)
+}
+
+// remove removes the object of a key. The file lock must be held.
+func (s *Storage) remove(ctx context.Context, cacheKey string) error {
+	s.mu.Lock()
+	delete(s.verified, cacheKey)
+	s.mu.Unlock()
+
+	err := s.storage.Delete(ctx, s.key(cacheKey))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// evict removes expired objects and, while the cache is over its maximum size, the least recently written objects,
+// except for the object of a key just written.
+func (s *Storage) evict(keep string) error {
+	if s.config.MaxAge == 0 && s.config.MaxSize == 0 {
+		return nil
+	}
+
+	ctx := context.Background()
+	keys, err := s.storage.List(ctx, s.prefix, false)
+	if err != nil {
+		return err
+	}
+
+	var files []cachedFile
+	var total int64
+	for _, key := range keys {
+		info, err := s.storage.Stat(ctx, key)
+		if err != nil || !info.IsTerminal {
+			// Removed in the meantime
+			continue
+		}
+		files = append(files, cachedFile{cacheKey: path.Base(key), size: info.Size, modTime: info.Modified})
+		total += info.Size
+	}
+
+	slices.SortFunc(files, func(a, b cachedFile) int { return a.modTime.Compare(b.modTime) })
+	for _, file := range files {
+		if file.cacheKey == keep {
+			continue
+		}
+		expired := s.config.MaxAge > 0 && s.now().Sub(file.modTime) > s.config.MaxAge
+		if !expired && (s.config.MaxSize == 0 || total <= s.config.MaxSize) {
+			continue
+		}
+		unlock := s.files.lock(file.cacheKey)
+		err := s.remove(ctx, file.cacheKey)
+		unlock()
+		if err != nil {
+			return err
+		}
+		total -= file.size
+	}
+	return nil
+}
+
+// key returns the storage key of the object of a cache key.
+func (s *Storage) key(cacheKey string) string {
+	return path.Join(s.prefix, cacheKey)
+}
+
+// memoryFile is a cached file read from memory.
+type memoryFile struct {
+	*bytes.Reader
+}
+
+// Close implements the io.Closer interface.
+func (m memoryFile) Close() error {
+	return nil
+}
@@ -14,13 +14,24 @@ import (
 	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
 	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/jasonlovesdoggo/caddy-defender/alerts"
+	"github.com/jasonlovesdoggo/caddy-defender/budget"
+	"github.com/jasonlovesdoggo/caddy-defender/bypass"
+	"github.com/jasonlovesdoggo/caddy-defender/cache"
 	"github.com/jasonlovesdoggo/caddy-defender/matchers/whitelist"
 	"github.com/jasonlovesdoggo/caddy-defender/ranges/data"
 	"github.com/jasonlovesdoggo/caddy-defender/responders"
+	"github.com/jasonlovesdoggo/caddy-defender/responders/challenge"
 	"github.com/jasonlovesdoggo/caddy-defender/responders/tarpit"
 )
 
-var responderTypes = []string{"block", "custom", "drop", "garbage", "ratelimit", "redirect", "tarpit"}
+var responderTypes = []string{
+	"block", "challenge", "custom", "drop", "error", "garbage", "maze", "ratelimit", "redirect", "tarpit", "throttle",
+}
+
+// fallbackTypes are the responder types which can handle requests exceeding a group budget or the tarpit's
+// connection limits. Responders which hold or pass on requests would defeat the limits.
+var fallbackTypes = []string{"block", "custom", "drop", "error", "garbage", "maze", "redirect"}
 
 // UnmarshalCaddyfile sets up the handler from Caddyfile tokens. Syntax:
 //
@@ -29,12 +40,130 @@ var responderTypes = []string{"block", "custom", "drop", "garbage", "ratelimit",
 //		ranges
 //		# Whitelisted IP addresses to allow to bypass ranges (optional)
 //		whitelist
-//	    # Custom message to return to the client when using "custom" middleware (optional)
+//	    # Custom message to return to the client when using "block" or "custom" middleware (optional)
 //	    message
+//	    # File to read the message from instead (optional)
+//	    message_file <path>
+//	    # Status code of "block", "custom", "error" and "redirect" responses, and headers of "block" and "custom" (optional)
+//	    response_code <code>
+//	    headers {
+//	        <name> <value>
+//	    }
 //	    # Custom URL to redirect the client to when using "redirect" middleware (optional)
 //	    url
+//	    # Further targets and options for the "redirect" responder (optional)
+//	    redirect_config {
+//	        targets <urls...>
+//	        selection random|hash
+//	        preserve_path (no arguments)
+//	        preserve_query (no arguments)
+//	    }
+//	    # Content and pacing of the "tarpit" responder (optional)
+//	    tarpit_config {
+//	        headers {
+//	            <name> <value>
+//	        }
+//	        content <protocol>://<path> [<weight>] (repeatable)
+//	        loop (no arguments)
+//	        content_length auto|<bytes>
+//	        mode body|headers|socket
+//	        cache_ttl <duration>
+//	        fetch_timeout <duration>
+//	        max_content_size <bytes>
+//	        stale_if_error (no arguments)
+//	        cache {
+//	            root <directory>
+//	            max_size <bytes>
+//	            max_age <duration>
+//	            backend filesystem|storage
+//	        }
+//	        timeout <duration>
+//	        bytes_per_second <bytes>|<bytes>/<duration>
+//	        ramp <initial bytes_per_second> <duration>
+//	        jitter <fraction>
+//	        response_code <code>
+//	        max_connections <connections>
+//	        max_connections_per_ip <connections>
+//	        fallback block|custom|drop|error|garbage|maze|redirect
+//	    }
 //	    # Serve robots.txt banning everything (optional)
 //	    serve_ignore (no arguments)
+//	    # Proof-of-work challenge for the "challenge" responder (optional)
+//	    challenge_config {
+//	        difficulty <bits>
+//	        secret <secret>
+//	        cookie_name <name>
+//	        cookie_ttl <duration>
+//	        challenge_ttl <duration>
+//	        verify_path <path>
+//	    }
+//	    # How the "drop" responder drops connections (optional)
+//	    drop_config {
+//	        mode abort|reset|hold
+//	        hold <duration>
+//	    }
+//	    # Prose generation for the "garbage" responder (optional)
+//	    garbage_config {
+//	        corpus <files or glob patterns...>
+//	        capture_upstream (no arguments)
+//	        max_corpus_size <bytes>
+//	        words <words>
+//	        order <words>
+//	        json_schema <file>
+//	    }
+//	    # Link maze for the "maze" responder, whose text is generated with garbage_config (optional)
+//	    maze_config {
+//	        prefix <path>
+//	        links <links>
+//	        sitemap (no arguments)
+//	        pages_per_second <pages>
+//	        burst <pages>
+//	    }
+//	    # Pacing of the real response for the "throttle" responder
+//	    throttle_config {
+//	        bytes_per_second <bytes>
+//	        delay <duration>
+//	    }
+//	    # Header to tag matched requests with when using "ratelimit" without a limit (optional)
+//	    rate_limit_header <header>
+//	    # Native rate limiting for the "ratelimit" responder (optional)
+//	    ratelimit_config {
+//	        algorithm token_bucket|sliding_window
+//	        key ip|prefix|group
+//	        requests <requests per window>
+//	        window <duration>
+//	        burst <requests>
+//	        ipv4_prefix <bits>
+//	        ipv6_prefix <bits>
+//	    }
+//	    # Aggregate budget shared by all clients of a range group (optional, repeatable)
+//	    budget <group> {
+//	        max_concurrent <requests>
+//	        bytes_per_second <bytes>
+//	        queue_timeout <duration>
+//	        fallback block|custom|drop|error|garbage|maze|redirect
+//	    }
+//	    # Webhook alerts for new offenders and traffic spikes (optional)
+//	    alerts {
+//	        webhook <urls...>
+//	        secret <hmac secret>
+//	        window <duration>
+//	        group_threshold <matches per window>
+//	        prefix_threshold <matches per window>
+//	        notify_new (no arguments)
+//	        forget_after <duration>
+//	        batch_interval <duration>
+//	        max_batch_size <alerts>
+//	        max_retries <retries>
+//	        timeout <duration>
+//	    }
+//	    # Credentials letting trusted clients through even if they are in the ranges (optional)
+//	    bypass {
+//	        secret <secret>
+//	        header <name>
+//	        query_param <name>
+//	        client_cert_subject <subjects...>
+//	    }
 //	}
 func (m *Defender) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
 	d.Next() // consume directive name
@@ -65,12 +194,39 @@ func (m *Defender) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
 			}
 			Message := d.Val()
 			m.Message = Message
+		case "message_file":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			m.MessageFile = d.Val()
+		case "response_code":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			code, err := strconv.Atoi(d.Val())
+			if err != nil {
+				return fmt.Errorf("invalid response_code value: '%s'", d.Val())
+			}
+			m.ResponseCode = code
+		case "headers":
+			m.Headers = map[string]string{}
+			for nesting := d.Nesting(); d.NextBlock(nesting); {
+				k := d.Val()
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				m.Headers[k] = d.Val()
+			}
 		case "url":
 			if !d.NextArg() {
 				return d.ArgErr()
 			}
 			url := d.Val()
 			m.URL = url
+		case "redirect_config":
+			if err := parseRedirectConfig(d, &m.RedirectConfig); err != nil {
+				return err
+			}
 		case "whitelist":
 			for d.NextArg() {
 				m.Whitelist = append(m.Whitelist, d.Val())
@@ -78,6 +234,7 @@ func (m *Defender) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
 		case "serve_ignore":
 			m.ServeIgnore = true
 		case "tarpit_config":
+			var sources []tarpit.Source
 			for nesting := d.Nesting(); d.NextBlock(nesting); {
 				switch d.Val() {
 				case "headers":
@@ -100,10 +257,79 @@ func (m *Defender) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
 						return errors.New("invalid content format. expected <content protocol>://<content path>")
 					}
 
-					m.TarpitConfig.Content = tarpit.Content{
+					source := tarpit.Source{Content: tarpit.Content{
 						Protocol: content[0],
 						Path:     content[1],
+					}}
+					if d.NextArg() {
+						weight, err := strconv.Atoi(d.Val())
+						if err != nil || weight <= 0 {
+							return fmt.Errorf("invalid content weight value: '%s'", d.Val())
+						}
+						source.Weight = weight
+					}
+					sources = append(sources, source)
+				case "cache_ttl", "fetch_timeout":
+					key := d.Val()
+					if !d.NextArg() {
+						return d.ArgErr()
+					}
+
+					duration, err := time.ParseDuration(d.Val())
+					if err != nil {
+						return fmt.Errorf("invalid %s value: '%s'", key, d.Val())
+					}
+
+					if key == "cache_ttl" {
+						m.TarpitConfig.CacheTTL = duration
+					} else {
+						m.TarpitConfig.FetchTimeout = duration
+					}
+				case "max_content_size":
+					if !d.NextArg() {
+						return d.ArgErr()
+					}
+
+					size, err := strconv.ParseInt(d.Val(), 10, 64)
+					if err != nil {
+						return fmt.Errorf("invalid max_content_size value: '%s'", d.Val())
+					}
+
+					m.TarpitConfig.MaxContentSize = size
+				case "cache":
+					config, err := parseCacheConfig(d)
+					if err != nil {
+						return err
+					}
+					m.TarpitConfig.Cache = config
+				case "stale_if_error":
+					if d.NextArg() {
+						return d.ArgErr()
+					}
+					m.TarpitConfig.StaleIfError = true
+				case "loop":
+					if d.NextArg() {
+						return d.ArgErr()
+					}
+					m.TarpitConfig.Loop = true
+				case "content_length":
+					if !d.NextArg() {
+						return d.ArgErr()
+					}
+					if d.Val() != "auto" {
+						if _, err := strconv.ParseInt(d.Val(), 10, 64); err != nil {
+							return fmt.Errorf("invalid content_length value: '%s'", d.Val())
+						}
+					}
+					m.TarpitConfig.ContentLength = d.Val()
+				case "mode":
+					if !d.NextArg() {
+						return d.ArgErr()
+					}
+					if !slices.Contains(tarpit.Modes, d.Val()) {
+						return fmt.Errorf("invalid mode value: '%s'", d.Val())
 					}
+					m.TarpitConfig.Mode = d.Val()
 				case "timeout":
 					if !d.NextArg() {
 						return d.ArgErr()
@@ -120,12 +346,42 @@ func (m *Defender) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
 						return d.ArgErr()
 					}
 
-					bps, err := strconv.Atoi(d.Val())
+					bps, err := tarpit.ParseRate(d.Val())
 					if err != nil {
 						return fmt.Errorf("invalid bytes_per_second value: '%s'", d.Val())
 					}
 
 					m.TarpitConfig.BytesPerSecond = bps
+				case "ramp":
+					if !d.NextArg() {
+						return d.ArgErr()
+					}
+					initial, err := tarpit.ParseRate(d.Val())
+					if err != nil {
+						return fmt.Errorf("invalid ramp value: '%s'", d.Val())
+					}
+
+					if !d.NextArg() {
+						return d.ArgErr()
+					}
+					duration, err := time.ParseDuration(d.Val())
+					if err != nil {
+						return fmt.Errorf("invalid ramp value: '%s'", d.Val())
+					}
+
+					m.TarpitConfig.InitialBytesPerSecond = initial
+					m.TarpitConfig.RampDuration = duration
+				case "jitter":
+					if !d.NextArg() {
+						return d.ArgErr()
+					}
+
+					jitter, err := strconv.ParseFloat(d.Val(), 64)
+					if err != nil {
+						return fmt.Errorf("invalid jitter value: '%s'", d.Val())
+					}
+
+					m.TarpitConfig.Jitter = jitter
 				case "response_code":
 					if !d.NextArg() {
 						return d.ArgErr()
@@ -137,10 +393,91 @@ func (m *Defender) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
 					}
 
 					m.TarpitConfig.ResponseCode = responseCode
+				case "max_connections", "max_connections_per_ip":
+					key := d.Val()
+					if !d.NextArg() {
+						return d.ArgErr()
+					}
+
+					connections, err := strconv.Atoi(d.Val())
+					if err != nil {
+						return fmt.Errorf("invalid %s value: '%s'", key, d.Val())
+					}
+
+					if key == "max_connections" {
+						m.TarpitConfig.MaxConnections = connections
+					} else {
+						m.TarpitConfig.MaxConnectionsPerIP = connections
+					}
+				case "fallback":
+					if !d.NextArg() {
+						return d.ArgErr()
+					}
+					m.TarpitConfig.Fallback = d.Val()
 				default:
 					return d.Errf("unknown nested config key: %s", d.Val())
 				}
 			}
+			// A single unweighted content is the tarpit's content, several are picked from by weight
+			if len(sources) == 1 && sources[0].Weight == 0 {
+				m.TarpitConfig.Content = sources[0].Content
+			} else if len(sources) > 0 {
+				m.TarpitConfig.Sources = sources
+			}
+		case "challenge_config":
+			if err := parseChallengeConfig(d, &m.ChallengeConfig); err != nil {
+				return err
+			}
+		case "drop_config":
+			if err := parseDropConfig(d, &m.DropConfig); err != nil {
+				return err
+			}
+		case "garbage_config":
+			if err := parseGarbageConfig(d, &m.GarbageConfig); err != nil {
+				return err
+			}
+		case "maze_config":
+			if err := parseMazeConfig(d, &m.MazeConfig); err != nil {
+				return err
+			}
+		case "throttle_config":
+			if err := parseThrottleConfig(d, &m.ThrottleConfig); err != nil {
+				return err
+			}
+		case "rate_limit_header":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			m.RateLimitHeader = d.Val()
+		case "ratelimit_config":
+			if err := parseRateLimitConfig(d, &m.RateLimitConfig); err != nil {
+				return err
+			}
+		case "budget":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			group := d.Val()
+			budgetConfig, err := parseBudgetConfig(d)
+			if err != nil {
+				return err
+			}
+			if m.Budgets == nil {
+				m.Budgets = make(map[string]*budget.Config)
+			}
+			m.Budgets[group] = budgetConfig
+		case "alerts":
+			alertsConfig, err := parseAlertsConfig(d)
+			if err != nil {
+				return err
+			}
+			m.Alerts = alertsConfig
+		case "bypass":
+			bypassConfig, err := parseBypassConfig(d)
+			if err != nil {
+				return err
+			}
+			m.Bypass = bypassConfig
 		default:
 			return d.Errf("unknown subdirective '%s'", d.Val())
 		}
@@ -149,6 +486,404 @@ func (m *Defender) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
 	return nil
 }
 
+// parseChallengeConfig parses the challenge_config block.
+func parseChallengeConfig(d *caddyfile.Dispenser, config *challenge.Config) error {
+	for nesting := d.Nesting(); d.NextBlock(nesting); {
+		key := d.Val()
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		switch key {
+		case "difficulty":
+			difficulty, err := strconv.Atoi(d.Val())
+			if err != nil {
+				return fmt.Errorf("invalid difficulty value: '%s'", d.Val())
+			}
+			config.Difficulty = difficulty
+		case "secret":
+			config.Secret = d.Val()
+		case "cookie_name":
+			config.CookieName = d.Val()
+		case "verify_path":
+			config.VerifyPath = d.Val()
+		case "cookie_ttl", "challenge_ttl":
+			ttl, err := time.ParseDuration(d.Val())
+			if err != nil {
+				return fmt.Errorf("invalid %s value: '%s'", key, d.Val())
+			}
+			if key == "cookie_ttl" {
+				config.CookieTTL = ttl
+			} else {
+				config.ChallengeTTL = ttl
+			}
+		default:
+			return d.Errf("unknown challenge_config key: %s", key)
+		}
+	}
+	return nil
+}
+
+// parseDropConfig parses the drop_config block.
+func parseDropConfig(d *caddyfile.Dispenser, config *responders.DropConfig) error {
+	for nesting := d.Nesting(); d.NextBlock(nesting); {
+		key := d.Val()
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		switch key {
+		case "mode":
+			config.Mode = d.Val()
+		case "hold":
+			hold, err := time.ParseDuration(d.Val())
+			if err != nil {
+				return fmt.Errorf("invalid hold value: '%s'", d.Val())
+			}
+			config.Hold = hold
+		default:
+			return d.Errf("unknown drop_config key: %s", key)
+		}
+	}
+	return nil
+}
+
+// parseGarbageConfig parses the garbage_config block.
+func parseGarbageConfig(d *caddyfile.Dispenser, config *responders.GarbageConfig) error {
+	for nesting := d.Nesting(); d.NextBlock(nesting); {
+		key := d.Val()
+		switch key {
+		case "corpus":
+			for d.NextArg() {
+				config.Corpus = append(config.Corpus, d.Val())
+			}
+			if len(config.Corpus) == 0 {
+				return d.ArgErr()
+			}
+		case "capture_upstream":
+			config.CaptureUpstream = true
+		case "json_schema":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			config.JSONSchema = d.Val()
+		case "max_corpus_size", "words", "order":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			value, err := strconv.Atoi(d.Val())
+			if err != nil {
+				return fmt.Errorf("invalid %s value: '%s'", key, d.Val())
+			}
+			switch key {
+			case "max_corpus_size":
+				config.MaxCorpusSize = value
+			case "words":
+				config.Words = value
+			case "order":
+				config.Order = value
+			}
+		default:
+			return d.Errf("unknown garbage_config key: %s", key)
+		}
+	}
+	return nil
+}
+
+// parseRedirectConfig parses the redirect_config block.
+func parseRedirectConfig(d *caddyfile.Dispenser, config *responders.RedirectConfig) error {
+	for nesting := d.Nesting(); d.NextBlock(nesting); {
+		key := d.Val()
+		switch key {
+		case "targets":
+			for d.NextArg() {
+				config.Targets = append(config.Targets, d.Val())
+			}
+			if len(config.Targets) == 0 {
+				return d.ArgErr()
+			}
+		case "selection":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			config.Selection = d.Val()
+		case "preserve_path":
+			config.PreservePath = true
+		case "preserve_query":
+			config.PreserveQuery = true
+		default:
+			return d.Errf("unknown redirect_config key: %s", key)
+		}
+	}
+	return nil
+}
+
+// parseMazeConfig parses the maze_config block.
+func parseMazeConfig(d *caddyfile.Dispenser, config *responders.MazeConfig) error {
+	for nesting := d.Nesting(); d.NextBlock(nesting); {
+		key := d.Val()
+		if key == "sitemap" {
+			config.Sitemap = true
+			continue
+		}
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		switch key {
+		case "prefix":
+			config.Prefix = d.Val()
+		case "links", "burst":
+			value, err := strconv.Atoi(d.Val())
+			if err != nil {
+				return fmt.Errorf("invalid %s value: '%s'", key, d.Val())
+			}
+			if key == "links" {
+				config.Links = value
+			} else {
+				config.Burst = value
+			}
+		case "pages_per_second":
+			pps, err := strconv.ParseFloat(d.Val(), 64)
+			if err != nil {
+				return fmt.Errorf("invalid pages_per_second value: '%s'", d.Val())
+			}
+			config.PagesPerSecond = pps
+		default:
+			return d.Errf("unknown maze_config key: %s", key)
+		}
+	}
+	return nil
+}
+
+// parseThrottleConfig parses the throttle_config block.
+func parseThrottleConfig(d *caddyfile.Dispenser, config *responders.ThrottleConfig) error {
+	for nesting := d.Nesting(); d.NextBlock(nesting); {
+		key := d.Val()
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		switch key {
+		case "bytes_per_second":
+			bps, err := strconv.Atoi(d.Val())
+			if err != nil {
+				return fmt.Errorf("invalid bytes_per_second value: '%s'", d.Val())
+			}
+			config.BytesPerSecond = bps
+		case "delay":
+			delay, err := time.ParseDuration(d.Val())
+			if err != nil {
+				return fmt.Errorf("invalid delay value: '%s'", d.Val())
+			}
+			config.Delay = delay
+		default:
+			return d.Errf("unknown throttle_config key: %s", key)
+		}
+	}
+	return nil
+}
+
+// parseRateLimitConfig parses the ratelimit_config block.
+func parseRateLimitConfig(d *caddyfile.Dispenser, config *responders.RateLimitConfig) error {
+	for nesting := d.Nesting(); d.NextBlock(nesting); {
+		key := d.Val()
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		switch key {
+		case "algorithm":
+			config.Algorithm = d.Val()
+		case "key":
+			config.Key = d.Val()
+		case "window":
+			window, err := time.ParseDuration(d.Val())
+			if err != nil {
+				return fmt.Errorf("invalid window value: '%s'", d.Val())
+			}
+			config.Window = window
+		case "requests", "burst", "ipv4_prefix", "ipv6_prefix":
+			value, err := strconv.Atoi(d.Val())
+			if err != nil {
+				return fmt.Errorf("invalid %s value: '%s'", key, d.Val())
+			}
+			switch key {
+			case "requests":
+				config.Requests = value
+			case "burst":
+				config.Burst = value
+			case "ipv4_prefix":
+				config.IPv4Prefix = value
+			case "ipv6_prefix":
+				config.IPv6Prefix = value
+			}
+		default:
+			return d.Errf("unknown ratelimit_config key: %s", key)
+		}
+	}
+	return nil
+}
+
+// parseBudgetConfig parses a budget block.
+func parseBudgetConfig(d *caddyfile.Dispenser) (*budget.Config, error) {
+	config := &budget.Config{}
+	for nesting := d.Nesting(); d.NextBlock(nesting); {
+		key := d.Val()
+		if !d.NextArg() {
+			return nil, d.ArgErr()
+		}
+		switch key {
+		case "max_concurrent", "bytes_per_second":
+			value, err := strconv.Atoi(d.Val())
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s value: '%s'", key, d.Val())
+			}
+			if key == "max_concurrent" {
+				config.MaxConcurrent = value
+			} else {
+				config.BytesPerSecond = value
+			}
+		case "queue_timeout":
+			timeout, err := time.ParseDuration(d.Val())
+			if err != nil {
+				return nil, fmt.Errorf("invalid queue_timeout value: '%s'", d.Val())
+			}
+			config.QueueTimeout = timeout
+		case "fallback":
+			config.Fallback = d.Val()
+		default:
+			return nil, d.Errf("unknown budget config key: %s", key)
+		}
+	}
+	return config, nil
+}
+
+// parseAlertsConfig parses the alerts block.
+func parseAlertsConfig(d *caddyfile.Dispenser) (*alerts.Config, error) {
+	config := &alerts.Config{}
+	for nesting := d.Nesting(); d.NextBlock(nesting); {
+		key := d.Val()
+		switch key {
+		case "webhook":
+			for d.NextArg() {
+				config.Webhooks = append(config.Webhooks, d.Val())
+			}
+			if len(config.Webhooks) == 0 {
+				return nil, d.ArgErr()
+			}
+		case "secret":
+			if !d.NextArg() {
+				return nil, d.ArgErr()
+			}
+			config.Secret = d.Val()
+		case "notify_new":
+			config.NotifyNew = true
+		case "window", "forget_after", "batch_interval", "timeout":
+			if !d.NextArg() {
+				return nil, d.ArgErr()
+			}
+			duration, err := time.ParseDuration(d.Val())
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s value: '%s'", key, d.Val())
+			}
+			switch key {
+			case "window":
+				config.Window = duration
+			case "forget_after":
+				config.ForgetAfter = duration
+			case "batch_interval":
+				config.BatchInterval = duration
+			case "timeout":
+				config.Timeout = duration
+			}
+		case "group_threshold", "prefix_threshold", "max_batch_size", "max_retries":
+			if !d.NextArg() {
+				return nil, d.ArgErr()
+			}
+			value, err := strconv.Atoi(d.Val())
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s value: '%s'", key, d.Val())
+			}
+			switch key {
+			case "group_threshold":
+				config.GroupThreshold = value
+			case "prefix_threshold":
+				config.PrefixThreshold = value
+			case "max_batch_size":
+				config.MaxBatchSize = value
+			case "max_retries":
+				config.MaxRetries = &value
+			}
+		default:
+			return nil, d.Errf("unknown alerts config key: %s", key)
+		}
+	}
+	return config, nil
+}
+
+// parseBypassConfig parses the bypass block.
+func parseBypassConfig(d *caddyfile.Dispenser) (*bypass.Config, error) {
+	config := &bypass.Config{}
+	for nesting := d.Nesting(); d.NextBlock(nesting); {
+		key := d.Val()
+		switch key {
+		case "secret", "header", "query_param":
+			if !d.NextArg() {
+				return nil, d.ArgErr()
+			}
+			switch key {
+			case "secret":
+				config.Secret = d.Val()
+			case "header":
+				config.Header = d.Val()
+			case "query_param":
+				config.QueryParam = d.Val()
+			}
+		case "client_cert_subject":
+			for d.NextArg() {
+				config.ClientCertSubjects = append(config.ClientCertSubjects, d.Val())
+			}
+			if len(config.ClientCertSubjects) == 0 {
+				return nil, d.ArgErr()
+			}
+		default:
+			return nil, d.Errf("unknown bypass config key: %s", key)
+		}
+	}
+	return config, nil
+}
+
+// parseCacheConfig parses the cache block of tarpit_config.
+func parseCacheConfig(d *caddyfile.Dispenser) (*cache.Config, error) {
+	config := &cache.Config{}
+	for nesting := d.Nesting(); d.NextBlock(nesting); {
+		key := d.Val()
+		if !d.NextArg() {
+			return nil, d.ArgErr()
+		}
+		switch key {
+		case "root":
+			config.Root = d.Val()
+		case "max_size":
+			size, err := strconv.ParseInt(d.Val(), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid max_size value: '%s'", d.Val())
+			}
+			config.MaxSize = size
+		case "max_age":
+			age, err := time.ParseDuration(d.Val())
+			if err != nil {
+				return nil, fmt.Errorf("invalid max_age value: '%s'", d.Val())
+			}
+			config.MaxAge = age
+		case "backend":
+			if !slices.Contains(cache.Backends, d.Val()) {
+				return nil, fmt.Errorf("invalid backend value: '%s'", d.Val())
+			}
+			config.Backend = d.Val()
+		default:
+			return nil, d.Errf("unknown cache config key: %s", key)
+		}
+	}
+	return config, nil
+}
+
 // UnmarshalJSON handles the Responder interface and converts the interface to a Defender struct
 func (m *Defender) UnmarshalJSON(b []byte) error {
 	type rawDefender Defender
@@ -159,35 +894,6 @@ func (m *Defender) UnmarshalJSON(b []byte) error {
 		return err
 	}
 
-	switch rawConfig.RawResponder {
-	case "block":
-		m.responder = &responders.BlockResponder{}
-	case "custom":
-		// Get the custom message
-		m.Message = rawConfig.Message
-		m.responder = &responders.CustomResponder{
-			Message: m.Message,
-		}
-	case "drop":
-		m.responder = &responders.DropResponder{}
-	case "garbage":
-		m.responder = &responders.GarbageResponder{}
-	case "ratelimit":
-		m.responder = &responders.RateLimitResponder{}
-	case "redirect":
-		m.URL = rawConfig.URL
-		m.responder = &responders.RedirectResponder{
-			URL: m.URL,
-		}
-	case "tarpit":
-		m.responder = &tarpit.Responder{
-			Config: &m.TarpitConfig,
-		}
-
-	default:
-		return fmt.Errorf("unknown responder type: %s", rawConfig.RawResponder)
-	}
-
 	// Use reflection to copy fields excluding excludedKeys
 	rawVal := reflect.ValueOf(rawConfig)
 	mVal := reflect.ValueOf(m).Elem()
@@ -205,9 +911,79 @@ func (m *Defender) UnmarshalJSON(b []byte) error {
 		}
 	}
 
+	// Responders are configured after the fields are copied so they can reference them
+	responder, err := m.newResponder(m.RawResponder)
+	if err != nil {
+		return err
+	}
+	m.responder = responder
+
 	return nil
 }
 
+// newResponder returns the responder for a responder type, configured from the Defender's fields.
+func (m *Defender) newResponder(responderType string) (responders.Responder, error) {
+	switch responderType {
+	case "block":
+		return &responders.BlockResponder{
+			ResponseCode: m.ResponseCode,
+			Headers:      m.Headers,
+			Message:      m.Message,
+			MessageFile:  m.MessageFile,
+		}, nil
+	case "challenge":
+		return &responders.ChallengeResponder{
+			Config: &m.ChallengeConfig,
+		}, nil
+	case "custom":
+		return &responders.CustomResponder{
+			ResponseCode: m.ResponseCode,
+			Headers:      m.Headers,
+			Message:      m.Message,
+			MessageFile:  m.MessageFile,
+		}, nil
+	case "drop":
+		return &responders.DropResponder{
+			Config: &m.DropConfig,
+		}, nil
+	case "error":
+		return &responders.ErrorResponder{
+			ResponseCode: m.ResponseCode,
+		}, nil
+	case "garbage":
+		return &responders.GarbageResponder{
+			Config: &m.GarbageConfig,
+		}, nil
+	case "maze":
+		return &responders.MazeResponder{
+			Config:  &m.MazeConfig,
+			Garbage: &m.GarbageConfig,
+		}, nil
+	case "ratelimit":
+		return &responders.RateLimitResponder{
+			Config: &m.RateLimitConfig,
+			Header: m.RateLimitHeader,
+		}, nil
+	case "redirect":
+		return &responders.RedirectResponder{
+			URL:          m.URL,
+			ResponseCode: m.ResponseCode,
+			Config:       &m.RedirectConfig,
+		}, nil
+	case "tarpit":
+		return &tarpit.Responder{
+			Config: &m.TarpitConfig,
+		}, nil
+	case "throttle":
+		return &responders.ThrottleResponder{
+			Config: &m.ThrottleConfig,
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown responder type: %s", responderType)
+	}
+}
+
 // Validate ensures the middleware configuration is valid
 func (m *Defender) Validate() error {
 	if m.responder == nil {
@@ -235,13 +1011,118 @@ func (m *Defender) Validate() error {
 	}
 
 	// Validate responder config options
-	if m.RawResponder == "redirect" && m.URL == "" {
-		return errors.New("redirect responder requires 'url' to be set")
+	if m.RawResponder == "redirect" {
+		if m.URL == "" && len(m.RedirectConfig.Targets) == 0 {
+			return errors.New("redirect responder requires 'url' to be set")
+		}
+		if m.URL != "" {
+			if err := responders.ValidateRedirectTarget(m.URL); err != nil {
+				return err
+			}
+		}
+		if err := m.RedirectConfig.Validate(); err != nil {
+			return err
+		}
+		if !isRedirectCode(m.ResponseCode) {
+			return fmt.Errorf("invalid redirect response_code %d", m.ResponseCode)
+		}
+	}
+
+	if m.Message != "" && m.MessageFile != "" {
+		return errors.New("only one of 'message' and 'message_file' may be set")
+	}
+
+	if m.ResponseCode != 0 && (m.ResponseCode < 100 || m.ResponseCode > 599) {
+		return fmt.Errorf("invalid response_code %d", m.ResponseCode)
+	}
+
+	if err := m.ChallengeConfig.Validate(); err != nil {
+		return err
+	}
+
+	if err := m.DropConfig.Validate(); err != nil {
+		return err
+	}
+
+	if err := m.GarbageConfig.Validate(); err != nil {
+		return err
+	}
+
+	if err := m.MazeConfig.Validate(); err != nil {
+		return err
+	}
+
+	if err := m.RateLimitConfig.Validate(); err != nil {
+		return err
+	}
+
+	if m.RawResponder == "throttle" {
+		if err := m.ThrottleConfig.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if m.RawResponder == "tarpit" && m.TarpitConfig.Fallback != "" {
+		if !slices.Contains(fallbackTypes, m.TarpitConfig.Fallback) {
+			return fmt.Errorf("invalid tarpit fallback responder %q", m.TarpitConfig.Fallback)
+		}
+		if m.TarpitConfig.Fallback == "drop" && m.DropConfig.Mode == "hold" {
+			return errors.New("tarpit fallback drops connections, but holding them defeats the connection limits")
+		}
+		if m.TarpitConfig.Fallback == "redirect" && m.URL == "" && len(m.RedirectConfig.Targets) == 0 {
+			return errors.New("tarpit fallback redirects, but 'url' is not set")
+		}
+		if m.TarpitConfig.Fallback == "redirect" && !isRedirectCode(m.ResponseCode) {
+			return fmt.Errorf("tarpit fallback redirects, but response_code %d is not a redirect", m.ResponseCode)
+		}
+	}
+
+	if m.Alerts != nil {
+		if err := m.Alerts.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if m.Bypass != nil {
+		if err := m.Bypass.Validate(); err != nil {
+			return err
+		}
+	}
+
+	ranges := m.Ranges
+	if len(ranges) == 0 {
+		ranges = DefaultRanges
+	}
+	for group, budgetConfig := range m.Budgets {
+		if !slices.Contains(ranges, group) {
+			return fmt.Errorf("budget for group %q which is not in ranges", group)
+		}
+		if err := budgetConfig.Validate(); err != nil {
+			return fmt.Errorf("invalid budget for group %q: %v", group, err)
+		}
+		if budgetConfig.Fallback != "" && !slices.Contains(fallbackTypes, budgetConfig.Fallback) {
+			return fmt.Errorf("invalid budget fallback responder %q for group %q", budgetConfig.Fallback, group)
+		}
+		if budgetConfig.Fallback == "drop" && m.DropConfig.Mode == "hold" {
+			return fmt.Errorf("budget fallback for group %q drops connections, but holding them defeats the budget", group)
+		}
+		if budgetConfig.Fallback == "redirect" && m.URL == "" && len(m.RedirectConfig.Targets) == 0 {
+			return fmt.Errorf("budget fallback for group %q redirects, but 'url' is not set", group)
+		}
+		if budgetConfig.Fallback == "redirect" && !isRedirectCode(m.ResponseCode) {
+			return fmt.Errorf("budget fallback for group %q redirects, but response_code %d is not a redirect", group,
+				m.ResponseCode)
+		}
 	}
 
 	return nil
 }
 
+// isRedirectCode reports whether a response code is unset, or one the redirect responder can respond with.
+func isRedirectCode(code int) bool {
+	return code == 0 || slices.Contains(responders.RedirectStatusCodes, code)
+}
+
 func parseCaddyfile(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
 	var m Defender
 	err := m.UnmarshalCaddyfile(h.Dispenser)
@@ -8,13 +8,20 @@ import (
 
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddytest"
+	"github.com/jasonlovesdoggo/caddy-defender/alerts"
+	"github.com/jasonlovesdoggo/caddy-defender/budget"
+	"github.com/jasonlovesdoggo/caddy-defender/bypass"
+	"github.com/jasonlovesdoggo/caddy-defender/cache"
 	"github.com/jasonlovesdoggo/caddy-defender/responders"
+	"github.com/jasonlovesdoggo/caddy-defender/responders/challenge"
 	"github.com/jasonlovesdoggo/caddy-defender/responders/tarpit"
 
 	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
 	"github.com/stretchr/testify/require"
 )
 
+func intPtr(v int) *int { return &v }
+
 func TestUnmarshalCaddyfile(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -55,6 +62,47 @@ func TestUnmarshalCaddyfile(t *testing.T) {
 				Ranges:       []string{"openai"},
 			},
 		},
+		{
+			name: "valid challenge responder with config",
+			input: `defender challenge {
+				ranges aws
+				challenge_config {
+					difficulty 18
+					secret "a long enough secret"
+					cookie_name cleared
+					cookie_ttl 12h
+					challenge_ttl 2m
+					verify_path /verify
+				}
+			}`,
+			expected: Defender{
+				RawResponder: "challenge",
+				Ranges:       []string{"aws"},
+				ChallengeConfig: challenge.Config{
+					Difficulty:   18,
+					Secret:       "a long enough secret",
+					CookieName:   "cleared",
+					CookieTTL:    12 * time.Hour,
+					ChallengeTTL: 2 * time.Minute,
+					VerifyPath:   "/verify",
+				},
+			},
+		},
+		{
+			name: "valid drop responder with config",
+			input: `defender drop {
+				ranges openai
+				drop_config {
+					mode hold
+					hold 1m
+				}
+			}`,
+			expected: Defender{
+				RawResponder: "drop",
+				Ranges:       []string{"openai"},
+				DropConfig:   responders.DropConfig{Mode: "hold", Hold: time.Minute},
+			},
+		},
 		{
 			name: "valid redirect responder with url",
 			input: `defender redirect {
@@ -67,6 +115,32 @@ func TestUnmarshalCaddyfile(t *testing.T) {
 				URL:          "https://example.com",
 			},
 		},
+		{
+			name: "valid redirect responder with config",
+			input: `defender redirect {
+				ranges openai
+				url "https://decoy-a.example.com/{http.vars.defender_group}"
+				response_code 302
+				redirect_config {
+					targets https://decoy-b.example.com https://decoy-c.example.com
+					selection hash
+					preserve_path
+					preserve_query
+				}
+			}`,
+			expected: Defender{
+				RawResponder: "redirect",
+				Ranges:       []string{"openai"},
+				URL:          "https://decoy-a.example.com/{http.vars.defender_group}",
+				ResponseCode: 302,
+				RedirectConfig: responders.RedirectConfig{
+					Targets:       []string{"https://decoy-b.example.com", "https://decoy-c.example.com"},
+					Selection:     "hash",
+					PreservePath:  true,
+					PreserveQuery: true,
+				},
+			},
+		},
 		{
 			name: "valid tarpit responder with config",
 			input: `defender tarpit {
@@ -79,6 +153,9 @@ func TestUnmarshalCaddyfile(t *testing.T) {
 					timeout 30s
 					bytes_per_second 24
 					response_code 404
+					max_connections 1000
+					max_connections_per_ip 4
+					fallback drop
 				}
 			}`,
 			expected: Defender{
@@ -92,9 +169,12 @@ func TestUnmarshalCaddyfile(t *testing.T) {
 						Protocol: "file",
 						Path:     "test.txt",
 					},
-					Timeout:        time.Second * 30,
-					BytesPerSecond: 24,
-					ResponseCode:   404,
+					Timeout:             time.Second * 30,
+					BytesPerSecond:      24,
+					ResponseCode:        404,
+					MaxConnections:      1000,
+					MaxConnectionsPerIP: 4,
+					Fallback:            "drop",
 				},
 			},
 		},
@@ -108,6 +188,329 @@ func TestUnmarshalCaddyfile(t *testing.T) {
 				Ranges:       []string{"cloudflare"},
 			},
 		},
+		{
+			name: "valid tarpit content sources",
+			input: `defender tarpit {
+				ranges openai
+				tarpit_config {
+					content dir:///srv/tarpit 3
+					content file://decoy.html
+					content generate://html 2
+					loop
+					content_length 10485760
+					cache_ttl 1h
+					fetch_timeout 10s
+					max_content_size 1048576
+					stale_if_error
+					cache {
+						root /var/cache/defender
+						max_size 1073741824
+						max_age 168h
+						backend storage
+					}
+				}
+			}`,
+			expected: Defender{
+				RawResponder: "tarpit",
+				Ranges:       []string{"openai"},
+				TarpitConfig: tarpit.Config{
+					Sources: []tarpit.Source{
+						{Content: tarpit.Content{Protocol: "dir", Path: "/srv/tarpit"}, Weight: 3},
+						{Content: tarpit.Content{Protocol: "file", Path: "decoy.html"}},
+						{Content: tarpit.Content{Protocol: "generate", Path: "html"}, Weight: 2},
+					},
+					Loop:           true,
+					ContentLength:  "10485760",
+					CacheTTL:       time.Hour,
+					FetchTimeout:   10 * time.Second,
+					MaxContentSize: 1 << 20,
+					StaleIfError:   true,
+					Cache: &cache.Config{
+						Root:    "/var/cache/defender",
+						MaxSize: 1 << 30,
+						MaxAge:  168 * time.Hour,
+						Backend: cache.BackendStorage,
+					},
+				},
+			},
+		},
+		{
+			name: "invalid tarpit cache config",
+			input: `defender tarpit {
+				tarpit_config {
+					cache {
+						max_age forever
+					}
+				}
+			}`,
+			errContains: "invalid max_age value",
+			expectError: true,
+		},
+		{
+			name: "invalid tarpit cache backend",
+			input: `defender tarpit {
+				tarpit_config {
+					cache {
+						backend redis
+					}
+				}
+			}`,
+			errContains: "invalid backend value: 'redis'",
+			expectError: true,
+		},
+		{
+			name: "invalid tarpit content weight",
+			input: `defender tarpit {
+				tarpit_config {
+					content file://decoy.html heavy
+				}
+			}`,
+			errContains: "invalid content weight value",
+			expectError: true,
+		},
+		{
+			name: "valid tarpit header mode",
+			input: `defender tarpit {
+				ranges openai
+				tarpit_config {
+					mode headers
+					bytes_per_second 1
+					timeout 10m
+				}
+			}`,
+			expected: Defender{
+				RawResponder: "tarpit",
+				Ranges:       []string{"openai"},
+				TarpitConfig: tarpit.Config{
+					Mode:           tarpit.ModeHeaders,
+					BytesPerSecond: 1,
+					Timeout:        10 * time.Minute,
+				},
+			},
+		},
+		{
+			name: "invalid tarpit mode",
+			input: `defender tarpit {
+				tarpit_config {
+					mode trailers
+				}
+			}`,
+			errContains: "invalid mode value: 'trailers'",
+			expectError: true,
+		},
+		{
+			name: "valid tarpit drip rate",
+			input: `defender tarpit {
+				ranges openai
+				tarpit_config {
+					bytes_per_second 1/5s
+					ramp 100 30s
+					jitter 0.3
+				}
+			}`,
+			expected: Defender{
+				RawResponder: "tarpit",
+				Ranges:       []string{"openai"},
+				TarpitConfig: tarpit.Config{
+					BytesPerSecond:        0.2,
+					InitialBytesPerSecond: 100,
+					RampDuration:          30 * time.Second,
+					Jitter:                0.3,
+				},
+			},
+		},
+		{
+			name: "valid alerts config",
+			input: `defender block {
+				ranges openai
+				alerts {
+					webhook https://example.com/hook https://example.org/hook
+					secret s3cret
+					window 5m
+					group_threshold 100
+					prefix_threshold 20
+					notify_new
+					batch_interval 30s
+					max_retries 5
+				}
+			}`,
+			expected: Defender{
+				RawResponder: "block",
+				Ranges:       []string{"openai"},
+				Alerts: &alerts.Config{
+					Webhooks:        []string{"https://example.com/hook", "https://example.org/hook"},
+					Secret:          "s3cret",
+					Window:          5 * time.Minute,
+					GroupThreshold:  100,
+					PrefixThreshold: 20,
+					NotifyNew:       true,
+					BatchInterval:   30 * time.Second,
+					MaxRetries:      intPtr(5),
+				},
+			},
+		},
+		{
+			name: "valid bypass config",
+			input: `defender block {
+				ranges aws gcloud
+				bypass {
+					secret "a test secret of some length"
+					header X-Bypass
+					client_cert_subject monitoring "CN=ci,O=Example"
+				}
+			}`,
+			expected: Defender{
+				RawResponder: "block",
+				Ranges:       []string{"aws", "gcloud"},
+				Bypass: &bypass.Config{
+					Secret:             "a test secret of some length",
+					Header:             "X-Bypass",
+					ClientCertSubjects: []string{"monitoring", "CN=ci,O=Example"},
+				},
+			},
+		},
+		{
+			name: "valid ratelimit config",
+			input: `defender ratelimit {
+				ranges openai
+				rate_limit_header X-API-RateLimit
+				ratelimit_config {
+					algorithm sliding_window
+					key prefix
+					requests 100
+					window 1m
+					ipv4_prefix 16
+				}
+			}`,
+			expected: Defender{
+				RawResponder:    "ratelimit",
+				Ranges:          []string{"openai"},
+				RateLimitHeader: "X-API-RateLimit",
+				RateLimitConfig: responders.RateLimitConfig{
+					Algorithm:  "sliding_window",
+					Key:        "prefix",
+					Requests:   100,
+					Window:     time.Minute,
+					IPv4Prefix: 16,
+				},
+			},
+		},
+		{
+			name: "valid block responder with response",
+			input: `defender block {
+				ranges openai
+				response_code 451
+				message_file /srv/blocked.html
+				headers {
+					Content-Type text/html
+					X-Defender-Group {http.vars.defender_group}
+				}
+			}`,
+			expected: Defender{
+				RawResponder: "block",
+				Ranges:       []string{"openai"},
+				ResponseCode: 451,
+				MessageFile:  "/srv/blocked.html",
+				Headers: map[string]string{
+					"Content-Type":     "text/html",
+					"X-Defender-Group": "{http.vars.defender_group}",
+				},
+			},
+		},
+		{
+			name: "valid garbage responder with config",
+			input: `defender garbage {
+				ranges openai
+				garbage_config {
+					corpus /srv/site/*.html /srv/about.txt
+					capture_upstream
+					words 500
+					order 3
+					json_schema /srv/api/schema.json
+				}
+			}`,
+			expected: Defender{
+				RawResponder: "garbage",
+				Ranges:       []string{"openai"},
+				GarbageConfig: responders.GarbageConfig{
+					Corpus:          []string{"/srv/site/*.html", "/srv/about.txt"},
+					CaptureUpstream: true,
+					Words:           500,
+					Order:           3,
+					JSONSchema:      "/srv/api/schema.json",
+				},
+			},
+		},
+		{
+			name: "valid maze responder with config",
+			input: `defender maze {
+				ranges openai
+				maze_config {
+					prefix /archive/
+					links 8
+					sitemap
+					pages_per_second 2.5
+					burst 10
+				}
+			}`,
+			expected: Defender{
+				RawResponder: "maze",
+				Ranges:       []string{"openai"},
+				MazeConfig: responders.MazeConfig{
+					Prefix:         "/archive/",
+					Links:          8,
+					Sitemap:        true,
+					PagesPerSecond: 2.5,
+					Burst:          10,
+				},
+			},
+		},
+		{
+			name: "valid throttle responder with config",
+			input: `defender throttle {
+				ranges openai
+				throttle_config {
+					bytes_per_second 1024
+					delay 2s
+				}
+			}`,
+			expected: Defender{
+				RawResponder: "throttle",
+				Ranges:       []string{"openai"},
+				ThrottleConfig: responders.ThrottleConfig{
+					BytesPerSecond: 1024,
+					Delay:          2 * time.Second,
+				},
+			},
+		},
+		{
+			name: "valid budget config",
+			input: `defender tarpit {
+				ranges openai aws
+				budget openai {
+					max_concurrent 4
+					bytes_per_second 2000000
+					queue_timeout 5s
+					fallback block
+				}
+				budget aws {
+					max_concurrent 10
+				}
+			}`,
+			expected: Defender{
+				RawResponder: "tarpit",
+				Ranges:       []string{"openai", "aws"},
+				Budgets: map[string]*budget.Config{
+					"openai": {
+						MaxConcurrent:  4,
+						BytesPerSecond: 2000000,
+						QueueTimeout:   5 * time.Second,
+						Fallback:       "block",
+					},
+					"aws": {MaxConcurrent: 10},
+				},
+			},
+		},
 		{
 			name: "missing responder type",
 			input: `defender {
@@ -172,6 +575,144 @@ func TestUnmarshalCaddyfile(t *testing.T) {
 			errContains: "invalid response_code value",
 			expectError: true,
 		},
+		{
+			name: "unknown bypass key",
+			input: `defender block {
+				bypass {
+					token abc
+				}
+			}`,
+			errContains: "unknown bypass config key",
+			expectError: true,
+		},
+		{
+			name: "invalid tarpit_config ramp",
+			input: `defender tarpit {
+				tarpit_config {
+					ramp fast 10s
+				}
+			}`,
+			errContains: "invalid ramp value",
+			expectError: true,
+		},
+		{
+			name: "invalid tarpit_config max_connections_per_ip",
+			input: `defender tarpit {
+				tarpit_config {
+					max_connections_per_ip few
+				}
+			}`,
+			errContains: "invalid max_connections_per_ip value",
+			expectError: true,
+		},
+		{
+			name: "invalid alerts threshold",
+			input: `defender block {
+				alerts {
+					group_threshold many
+				}
+			}`,
+			errContains: "invalid group_threshold value",
+			expectError: true,
+		},
+		{
+			name: "invalid ratelimit_config requests",
+			input: `defender ratelimit {
+				ratelimit_config {
+					requests lots
+				}
+			}`,
+			errContains: "invalid requests value",
+			expectError: true,
+		},
+		{
+			name: "unknown ratelimit_config key",
+			input: `defender ratelimit {
+				ratelimit_config {
+					rate 5r/s
+				}
+			}`,
+			errContains: "unknown ratelimit_config key",
+			expectError: true,
+		},
+		{
+			name: "invalid response_code",
+			input: `defender block {
+				response_code forbidden
+			}`,
+			errContains: "invalid response_code value",
+			expectError: true,
+		},
+		{
+			name: "invalid drop_config hold",
+			input: `defender drop {
+				drop_config {
+					hold forever
+				}
+			}`,
+			errContains: "invalid hold value",
+			expectError: true,
+		},
+		{
+			name: "invalid garbage_config words",
+			input: `defender garbage {
+				garbage_config {
+					words many
+				}
+			}`,
+			errContains: "invalid words value",
+			expectError: true,
+		},
+		{
+			name: "invalid maze_config pages_per_second",
+			input: `defender maze {
+				maze_config {
+					pages_per_second lots
+				}
+			}`,
+			errContains: "invalid pages_per_second value",
+			expectError: true,
+		},
+		{
+			name: "invalid throttle_config delay",
+			input: `defender throttle {
+				throttle_config {
+					delay soon
+				}
+			}`,
+			errContains: "invalid delay value",
+			expectError: true,
+		},
+		{
+			name: "invalid budget max_concurrent",
+			input: `defender block {
+				budget openai {
+					max_concurrent some
+				}
+			}`,
+			errContains: "invalid max_concurrent value",
+			expectError: true,
+		},
+		{
+			name: "unknown budget key",
+			input: `defender block {
+				budget openai {
+					queue 10
+				}
+			}`,
+			errContains: "unknown budget config key",
+			expectError: true,
+		},
+		{
+			name: "unknown alerts key",
+			input: `defender block {
+				alerts {
+					pager 555-0100
+				}
+			}`,
+			errContains: "unknown alerts config key",
+			expectError: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -193,6 +734,17 @@ func TestUnmarshalCaddyfile(t *testing.T) {
 			require.Equal(t, tt.expected.RawResponder, def.RawResponder)
 			require.Equal(t, tt.expected.Ranges, def.Ranges)
 			require.Equal(t, tt.expected.Message, def.Message)
+			require.Equal(t, tt.expected.RateLimitHeader, def.RateLimitHeader)
+			require.Equal(t, tt.expected.RateLimitConfig, def.RateLimitConfig)
+			require.Equal(t, tt.expected.ResponseCode, def.ResponseCode)
+			require.Equal(t, tt.expected.MessageFile, def.MessageFile)
+			require.Equal(t, tt.expected.Headers, def.Headers)
+			require.Equal(t, tt.expected.GarbageConfig, def.GarbageConfig)
+			require.Equal(t, tt.expected.ThrottleConfig, def.ThrottleConfig)
+			require.Equal(t, tt.expected.TarpitConfig, def.TarpitConfig)
+			require.Equal(t, tt.expected.Budgets, def.Budgets)
+			require.Equal(t, tt.expected.Alerts, def.Alerts)
+			require.Equal(t, tt.expected.Bypass, def.Bypass)
 		})
 	}
 }
@@ -286,6 +838,35 @@ func TestUnmarshalJSON(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:  "valid ratelimit responder with ratelimit_config",
+			input: `{"raw_responder":"ratelimit","ratelimit_config":{"key":"group","requests":10}}`,
+			expected: Defender{
+				RawResponder: "ratelimit",
+				RateLimitConfig: responders.RateLimitConfig{
+					Key:      "group",
+					Requests: 10,
+				},
+				responder: &responders.RateLimitResponder{},
+			},
+		},
+		{
+			name:  "valid error responder",
+			input: `{"raw_responder":"error","response_code":451}`,
+			expected: Defender{
+				RawResponder: "error",
+				responder:    &responders.ErrorResponder{},
+			},
+		},
+		{
+			name:  "valid throttle responder",
+			input: `{"raw_responder":"throttle","throttle_config":{"bytes_per_second":512}}`,
+			expected: Defender{
+				RawResponder:   "throttle",
+				ThrottleConfig: responders.ThrottleConfig{BytesPerSecond: 512},
+				responder:      &responders.ThrottleResponder{},
+			},
+		},
 		{
 			name:        "invalid responder type",
 			input:       `{"raw_responder":"invalid"}`,
@@ -317,6 +898,7 @@ func TestUnmarshalJSON(t *testing.T) {
 			require.Equal(t, tt.expected.RawResponder, def.RawResponder)
 			require.Equal(t, tt.expected.Ranges, def.Ranges)
 			require.Equal(t, tt.expected.Message, def.Message)
+			require.Equal(t, tt.expected.RateLimitConfig, def.RateLimitConfig)
 			require.IsType(t, tt.expected.responder, def.responder)
 		})
 	}
@@ -358,6 +940,185 @@ func TestValidation(t *testing.T) {
 		require.ErrorContains(t, def.Validate(), "invalid IP address")
 	})
 
+	t.Run("invalid alerts config", func(t *testing.T) {
+		def := Defender{
+			RawResponder: "block",
+			responder:    &responders.BlockResponder{},
+			Alerts:       &alerts.Config{GroupThreshold: 10},
+		}
+		require.ErrorContains(t, def.Validate(), "alerts require at least one webhook")
+	})
+
+	t.Run("invalid ratelimit config", func(t *testing.T) {
+		def := Defender{
+			RawResponder:    "ratelimit",
+			responder:       &responders.RateLimitResponder{},
+			RateLimitConfig: responders.RateLimitConfig{Key: "path"},
+		}
+		require.ErrorContains(t, def.Validate(), "invalid ratelimit key")
+	})
+
+	t.Run("message and message_file", func(t *testing.T) {
+		def := Defender{
+			RawResponder: "custom",
+			Message:      "Go away",
+			MessageFile:  "/srv/blocked.html",
+			responder:    &responders.CustomResponder{},
+		}
+		require.ErrorContains(t, def.Validate(), "only one of 'message' and 'message_file'")
+	})
+
+	t.Run("invalid response_code", func(t *testing.T) {
+		def := Defender{
+			RawResponder: "block",
+			ResponseCode: 1000,
+			responder:    &responders.BlockResponder{},
+		}
+		require.ErrorContains(t, def.Validate(), "invalid response_code")
+	})
+
+	t.Run("throttle without limits", func(t *testing.T) {
+		def := Defender{
+			RawResponder: "throttle",
+			responder:    &responders.ThrottleResponder{},
+		}
+		require.ErrorContains(t, def.Validate(), "throttle responder requires")
+	})
+
+	t.Run("redirect with targets only", func(t *testing.T) {
+		def := Defender{
+			RawResponder:   "redirect",
+			RedirectConfig: responders.RedirectConfig{Targets: []string{"https://example.com/"}},
+			responder:      &responders.RedirectResponder{},
+		}
+		require.NoError(t, def.Validate())
+	})
+
+	t.Run("malformed redirect target", func(t *testing.T) {
+		def := Defender{
+			RawResponder:   "redirect",
+			URL:            "https://example.com/",
+			RedirectConfig: responders.RedirectConfig{Targets: []string{"example.com/away"}},
+			responder:      &responders.RedirectResponder{},
+		}
+		require.ErrorContains(t, def.Validate(), "must be an absolute URL or path")
+
+		def.URL, def.RedirectConfig = "gopher://example.com/", responders.RedirectConfig{}
+		require.ErrorContains(t, def.Validate(), "scheme must be http or https")
+	})
+
+	t.Run("invalid redirect response_code", func(t *testing.T) {
+		def := Defender{
+			RawResponder: "redirect",
+			URL:          "https://example.com/",
+			ResponseCode: 200,
+			responder:    &responders.RedirectResponder{},
+		}
+		require.ErrorContains(t, def.Validate(), "invalid redirect response_code 200")
+	})
+
+	t.Run("holding drop budget fallback", func(t *testing.T) {
+		def := Defender{
+			RawResponder: "block",
+			Ranges:       []string{"openai"},
+			DropConfig:   responders.DropConfig{Mode: "hold"},
+			responder:    &responders.BlockResponder{},
+			Budgets:      map[string]*budget.Config{"openai": {MaxConcurrent: 1, Fallback: "drop"}},
+		}
+		require.ErrorContains(t, def.Validate(), "holding them defeats the budget")
+	})
+
+	t.Run("redirect budget fallback without url", func(t *testing.T) {
+		def := Defender{
+			RawResponder: "block",
+			Ranges:       []string{"openai"},
+			responder:    &responders.BlockResponder{},
+			Budgets:      map[string]*budget.Config{"openai": {MaxConcurrent: 1, Fallback: "redirect"}},
+		}
+		require.ErrorContains(t, def.Validate(), "redirects, but 'url' is not set")
+	})
+
+	t.Run("redirect budget fallback with another response_code", func(t *testing.T) {
+		def := Defender{
+			RawResponder: "block",
+			Ranges:       []string{"openai"},
+			URL:          "https://example.com/",
+			ResponseCode: 403,
+			responder:    &responders.BlockResponder{},
+			Budgets:      map[string]*budget.Config{"openai": {MaxConcurrent: 1, Fallback: "redirect"}},
+		}
+		require.ErrorContains(t, def.Validate(), "response_code 403 is not a redirect")
+
+		def.ResponseCode = 302
+		require.NoError(t, def.Validate())
+	})
+
+	t.Run("invalid tarpit fallback", func(t *testing.T) {
+		def := Defender{
+			RawResponder: "tarpit",
+			TarpitConfig: tarpit.Config{MaxConnections: 10, Fallback: "throttle"},
+			responder:    &tarpit.Responder{},
+		}
+		require.ErrorContains(t, def.Validate(), "invalid tarpit fallback responder")
+	})
+
+	t.Run("holding drop tarpit fallback", func(t *testing.T) {
+		def := Defender{
+			RawResponder: "tarpit",
+			TarpitConfig: tarpit.Config{MaxConnections: 10, Fallback: "drop"},
+			DropConfig:   responders.DropConfig{Mode: "hold"},
+			responder:    &tarpit.Responder{},
+		}
+		require.ErrorContains(t, def.Validate(), "holding them defeats the connection limits")
+	})
+
+	t.Run("invalid challenge difficulty", func(t *testing.T) {
+		def := Defender{
+			RawResponder:    "challenge",
+			ChallengeConfig: challenge.Config{Difficulty: 64},
+			responder:       &responders.ChallengeResponder{},
+		}
+		require.ErrorContains(t, def.Validate(), "challenge difficulty must be between")
+	})
+
+	t.Run("invalid drop mode", func(t *testing.T) {
+		def := Defender{
+			RawResponder: "drop",
+			DropConfig:   responders.DropConfig{Mode: "explode"},
+			responder:    &responders.DropResponder{},
+		}
+		require.ErrorContains(t, def.Validate(), "invalid drop mode")
+	})
+
+	t.Run("invalid maze prefix", func(t *testing.T) {
+		def := Defender{
+			RawResponder: "maze",
+			MazeConfig:   responders.MazeConfig{Prefix: "maze"},
+			responder:    &responders.MazeResponder{},
+		}
+		require.ErrorContains(t, def.Validate(), "maze prefix must start and end with '/'")
+	})
+
+	t.Run("budget for group not in ranges", func(t *testing.T) {
+		def := Defender{
+			RawResponder: "block",
+			Ranges:       []string{"openai"},
+			responder:    &responders.BlockResponder{},
+			Budgets:      map[string]*budget.Config{"aws": {MaxConcurrent: 1}},
+		}
+		require.ErrorContains(t, def.Validate(), "not in ranges")
+	})
+
+	t.Run("invalid budget fallback", func(t *testing.T) {
+		def := Defender{
+			RawResponder: "block",
+			Ranges:       []string{"openai"},
+			responder:    &responders.BlockResponder{},
+			Budgets:      map[string]*budget.Config{"openai": {MaxConcurrent: 1, Fallback: "tarpit"}},
+		}
+		require.ErrorContains(t, def.Validate(), "invalid budget fallback responder")
+	})
+
 	t.Run("Missing ranges", func(t *testing.T) {
 		def := Defender{
 			RawResponder: "block",
@@ -384,6 +1145,7 @@ func TestValidation(t *testing.T) {
 }
 
 func TestDefenderValidation(t *testing.T) {
+	skipUnlessCaddyLoadsConfigs(t)
 	t.Run("Invalid responder type", func(t *testing.T) {
 		caddytest.AssertLoadError(t, `{
   "admin": {
@@ -0,0 +1,98 @@
+package caddydefender
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyevents"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/jasonlovesdoggo/caddy-defender/responders"
+	"go.uber.org/zap"
+)
+
+// Events emitted through Caddy's events app. Every event carries the client "ip", the matched range "group"
+// and the "responder" type in its data.
+const (
+	// EventMatched is emitted when a client IP matches the configured ranges, before the responder runs.
+	// If a handler aborts the event, the responder still handles the request, but no further events are emitted
+	// for it.
+	EventMatched = "defender.matched"
+	// EventBanned is emitted after the responder has handled a matched request without passing it on.
+	// Its data also includes the "duration" the responder took.
+	EventBanned = "defender.banned"
+	// EventTarpitFinished is emitted when a tarpitted response ends.
+	// Its data also includes the "duration" the connection was held and the content "bytes_written".
+	EventTarpitFinished = "defender.tarpit_finished"
+)
+
+// eventsAbortedVarKey is the request var set once a handler aborted EventMatched for the request.
+const eventsAbortedVarKey = "defender.events_aborted"
+
+// emit dispatches an event to subscribed handlers, if the events app is available.
+func (m Defender) emit(name string, data map[string]any) caddyevents.Event {
+	if m.events == nil {
+		return caddyevents.Event{}
+	}
+	return m.events.Emit(m.ctx, name, data)
+}
+
+// eventData returns the data common to all Defender events. A new map is returned on each call as
+// event data must not be modified once emitted.
+func (m Defender) eventData(ip, group, responderType string) map[string]any {
+	return map[string]any{
+		"ip":        ip,
+		"group":     group,
+		"responder": responderType,
+	}
+}
+
+// respond hands a matched request to responder, emitting events describing the decision.
+func (m Defender) respond(
+	w http.ResponseWriter,
+	r *http.Request,
+	next caddyhttp.Handler,
+	responderType string,
+	responder responders.Responder,
+	ip, group string,
+) error {
+	if m.events == nil {
+		return responder.ServeHTTP(w, r, next)
+	}
+
+	if e := m.emit(EventMatched, m.eventData(ip, group, responderType)); e.Aborted != nil {
+		// Subscribers may keep the decision from being acted on through events, but never from being enforced
+		m.log.Debug("Matched event aborted, not emitting further events", zap.String("ip", ip), zap.Error(e.Aborted))
+		caddyhttp.SetVar(r.Context(), eventsAbortedVarKey, true)
+		return responder.ServeHTTP(w, r, next)
+	}
+
+	start := time.Now()
+	passed := false
+	// Deferred so that responders which abort the connection by panicking are reported too
+	defer func() {
+		if passed {
+			return
+		}
+		data := m.eventData(ip, group, responderType)
+		data["duration"] = time.Since(start)
+		m.emit(EventBanned, data)
+	}()
+
+	return responder.ServeHTTP(w, r, caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		passed = true
+		return next.ServeHTTP(w, r)
+	}))
+}
+
+// tarpitFinished emits EventTarpitFinished once a tarpitted response ends.
+func (m *Defender) tarpitFinished(r *http.Request, duration time.Duration, written int64) {
+	if aborted, _ := caddyhttp.GetVar(r.Context(), eventsAbortedVarKey).(bool); m.events == nil || aborted {
+		return
+	}
+	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+	data := m.eventData(ip, responders.MatchedGroup(r), m.RawResponder)
+	data["duration"] = duration
+	data["bytes_written"] = written
+	m.emit(EventTarpitFinished, data)
+}
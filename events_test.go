@@ -0,0 +1,202 @@
+package caddydefender
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyevents"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/stretchr/testify/require"
+)
+
+// eventRecorder is an in-process event handler that records every event it receives.
+type eventRecorder struct {
+	events []caddyevents.Event
+	abort  bool
+	mu     sync.Mutex
+}
+
+func (e *eventRecorder) Handle(_ context.Context, event caddyevents.Event) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events = append(e.events, event)
+	if e.abort && event.Name() == EventMatched {
+		return caddyevents.ErrAborted
+	}
+	return nil
+}
+
+func (e *eventRecorder) names() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	names := make([]string, 0, len(e.events))
+	for _, event := range e.events {
+		names = append(names, event.Name())
+	}
+	return names
+}
+
+func (e *eventRecorder) last() caddyevents.Event {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.events[len(e.events)-1]
+}
+
+// newEventsDefender provisions a Defender from its JSON config with an events app whose
+// subscribers are recorded.
+func newEventsDefender(t *testing.T, config string) (*Defender, *eventRecorder) {
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	t.Cleanup(cancel)
+
+	appIface, err := ctx.LoadModuleByID("events", nil)
+	require.NoError(t, err)
+	app := appIface.(*caddyevents.App)
+
+	recorder := &eventRecorder{}
+	require.NoError(t, app.On("", recorder))
+
+	mod, err := ctx.LoadModuleByID("http.handlers.defender", json.RawMessage(config))
+	require.NoError(t, err)
+	def := mod.(*Defender)
+	def.events = app
+
+	return def, recorder
+}
+
+// newMatchedRequest returns a request from a private IP with Caddy's request vars initialized.
+func newMatchedRequest() *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.168.1.10:4321"
+	ctx := context.WithValue(req.Context(), caddyhttp.VarsCtxKey, map[string]any{})
+	return req.WithContext(ctx)
+}
+
+// nextHandler records whether the request was passed on.
+type nextHandler struct {
+	called bool
+}
+
+func (n *nextHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) error {
+	n.called = true
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func TestEvents(t *testing.T) {
+	t.Run("Blocked request emits matched and banned", func(t *testing.T) {
+		def, recorder := newEventsDefender(t, `{"raw_responder":"block","ranges":["private"]}`)
+
+		next := &nextHandler{}
+		rec := httptest.NewRecorder()
+		require.NoError(t, def.ServeHTTP(rec, newMatchedRequest(), next))
+
+		require.False(t, next.called)
+		require.Equal(t, http.StatusForbidden, rec.Code)
+		require.Equal(t, []string{EventMatched, EventBanned}, recorder.names())
+
+		banned := recorder.last()
+		require.Equal(t, "192.168.1.10", banned.Data["ip"])
+		require.Equal(t, "private", banned.Data["group"])
+		require.Equal(t, "block", banned.Data["responder"])
+		require.IsType(t, time.Duration(0), banned.Data["duration"])
+	})
+
+	t.Run("Unmatched request emits nothing", func(t *testing.T) {
+		def, recorder := newEventsDefender(t, `{"raw_responder":"block","ranges":["10.0.0.0/8"]}`)
+
+		next := &nextHandler{}
+		require.NoError(t, def.ServeHTTP(httptest.NewRecorder(), newMatchedRequest(), next))
+
+		require.True(t, next.called)
+		require.Empty(t, recorder.names())
+	})
+
+	t.Run("Passed on request is not banned", func(t *testing.T) {
+		def, recorder := newEventsDefender(t, `{"raw_responder":"ratelimit","ranges":["private"]}`)
+
+		next := &nextHandler{}
+		require.NoError(t, def.ServeHTTP(httptest.NewRecorder(), newMatchedRequest(), next))
+
+		require.True(t, next.called)
+		require.Equal(t, []string{EventMatched}, recorder.names())
+	})
+
+	t.Run("Aborting matched still blocks the request", func(t *testing.T) {
+		def, recorder := newEventsDefender(t, `{"raw_responder":"block","ranges":["private"]}`)
+		recorder.abort = true
+
+		next := &nextHandler{}
+		rec := httptest.NewRecorder()
+		require.NoError(t, def.ServeHTTP(rec, newMatchedRequest(), next))
+
+		require.False(t, next.called)
+		require.Equal(t, http.StatusForbidden, rec.Code)
+		require.Equal(t, []string{EventMatched}, recorder.names())
+	})
+
+	t.Run("Dropped connection is banned", func(t *testing.T) {
+		def, recorder := newEventsDefender(t, `{"raw_responder":"drop","ranges":["private"]}`)
+
+		require.PanicsWithValue(t, http.ErrAbortHandler, func() {
+			_ = def.ServeHTTP(httptest.NewRecorder(), newMatchedRequest(), &nextHandler{})
+		})
+		require.Equal(t, []string{EventMatched, EventBanned}, recorder.names())
+	})
+
+	t.Run("Tarpit emits tarpit_finished", func(t *testing.T) {
+		def, recorder := newTarpitEventsDefender(t)
+
+		rec := httptest.NewRecorder()
+		require.NoError(t, def.ServeHTTP(rec, newMatchedRequest(), &nextHandler{}))
+		require.Equal(t, "Hello, bot!", rec.Body.String())
+
+		require.Equal(t, []string{EventMatched, EventTarpitFinished, EventBanned}, recorder.names())
+
+		recorder.mu.Lock()
+		finished := recorder.events[1]
+		recorder.mu.Unlock()
+		require.Equal(t, "private", finished.Data["group"])
+		require.Equal(t, "tarpit", finished.Data["responder"])
+		require.Equal(t, int64(len("Hello, bot!")), finished.Data["bytes_written"])
+	})
+
+	t.Run("Aborting matched still tarpits the request", func(t *testing.T) {
+		def, recorder := newTarpitEventsDefender(t)
+		recorder.abort = true
+
+		rec := httptest.NewRecorder()
+		require.NoError(t, def.ServeHTTP(rec, newMatchedRequest(), &nextHandler{}))
+		require.Equal(t, "Hello, bot!", rec.Body.String())
+		require.Equal(t, []string{EventMatched}, recorder.names())
+	})
+}
+
+// newTarpitEventsDefender provisions a tarpitting Defender with recorded events, serving a short file.
+func newTarpitEventsDefender(t *testing.T) (*Defender, *eventRecorder) {
+	content, err := os.CreateTemp("", "tarpit_events")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.Remove(content.Name())
+	})
+	_, err = content.WriteString("Hello, bot!")
+	require.NoError(t, err)
+	require.NoError(t, content.Close())
+
+	return newEventsDefender(t, fmt.Sprintf(`{
+		"raw_responder": "tarpit",
+		"ranges": ["private"],
+		"tarpit_config": {
+			"content": {"protocol": "file", "path": %q},
+			"timeout": %d,
+			"bytes_per_second": 1000
+		}
+	}`, content.Name(), time.Second))
+}
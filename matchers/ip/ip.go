@@ -15,7 +15,7 @@ import (
 )
 
 type IPChecker struct {
-	table     *bart.Table[struct{}]
+	table     *bart.Table[string]
 	cache     *sturdyc.Client[string]
 	whitelist *Whitelist.Whitelist
 	log       *zap.Logger
@@ -62,45 +62,60 @@ func NewIPChecker(cidrRanges, whitelistedIPs []string, log *zap.Logger) *IPCheck
 }
 
 func (c *IPChecker) ReqAllowed(ctx context.Context, clientIP net.IP) bool {
+	_, matched := c.Match(ctx, clientIP)
+	return !matched
+}
+
+// Match reports whether the client IP falls within the configured ranges and, if so, the name of the
+// range group it matched. Predefined ranges are reported by their key (e.g. "openai") and custom ranges
+// by their CIDR. Whitelisted IPs never match. IPs that cannot be parsed are treated as matched with an
+// empty group, as they cannot be trusted.
+func (c *IPChecker) Match(ctx context.Context, clientIP net.IP) (string, bool) {
 	// convert net.IP to netip.Addr
 	ipAddr, err := ipToAddr(clientIP)
 	if err != nil {
 		c.log.Warn("Invalid IP address format",
 			zap.String("ip", clientIP.String()),
 			zap.Error(err))
-		return false
+		return "", true
 	}
 
 	// Check if the IP is whitelisted
 	if ok, _ := c.whitelist.Matches(ipAddr); ok {
 		c.log.Debug("IP is whitelisted", zap.String("ip", clientIP.String()))
-		return true
+		return "", false
 	}
 	// Check if the IP is in the blocked ranges
-	return !c.IPInRanges(ctx, ipAddr)
+	return c.IPGroup(ctx, ipAddr)
 }
 
 func (c *IPChecker) IPInRanges(ctx context.Context, ipAddr netip.Addr) bool {
+	_, ok := c.IPGroup(ctx, ipAddr)
+	return ok
+}
+
+// IPGroup returns the name of the range group containing ipAddr, if any.
+func (c *IPChecker) IPGroup(ctx context.Context, ipAddr netip.Addr) (string, bool) {
 	// Convert to netip.Addr first to handle IPv4-mapped IPv6 addresses
 	// Use the normalized string representation for cache keys
 	cacheKey := ipAddr.String()
 
-	result, _ := c.cache.GetOrFetch(ctx, cacheKey, func(ctx context.Context) (string, error) {
-		if c.table.Contains(ipAddr) {
-			return "true", nil
+	group, err := c.cache.GetOrFetch(ctx, cacheKey, func(ctx context.Context) (string, error) {
+		if group, ok := c.table.Lookup(ipAddr); ok {
+			return group, nil
 		}
-		return "false", sturdyc.ErrNotFound
+		return "", sturdyc.ErrNotFound
 	})
 
-	return result == "true"
+	return group, err == nil
 }
 
-func buildTable(cidrRanges []string, log *zap.Logger) *bart.Table[struct{}] {
-	table := &bart.Table[struct{}]{}
+func buildTable(cidrRanges []string, log *zap.Logger) *bart.Table[string] {
+	table := &bart.Table[string]{}
 	for _, cidr := range cidrRanges {
 		if ranges, ok := data.IPRanges[cidr]; ok {
 			for _, predefinedCIDR := range ranges {
-				if err := insertCIDR(table, predefinedCIDR); err != nil {
+				if err := insertCIDR(table, predefinedCIDR, cidr); err != nil {
 					log.Warn("Invalid predefined CIDR",
 						zap.String("group", cidr),
 						zap.String("cidr", predefinedCIDR),
@@ -110,7 +125,7 @@ func buildTable(cidrRanges []string, log *zap.Logger) *bart.Table[struct{}] {
 			continue
 		}
 
-		if err := insertCIDR(table, cidr); err != nil {
+		if err := insertCIDR(table, cidr, cidr); err != nil {
 			log.Warn("Invalid CIDR specification",
 				zap.String("cidr", cidr),
 				zap.Error(err))
@@ -119,14 +134,14 @@ func buildTable(cidrRanges []string, log *zap.Logger) *bart.Table[struct{}] {
 	return table
 }
 
-func insertCIDR(table *bart.Table[struct{}], cidr string) error {
+func insertCIDR(table *bart.Table[string], cidr, group string) error {
 	prefix, err := netip.ParsePrefix(cidr)
 	if err != nil {
 		return fmt.Errorf("invalid CIDR: %w", err)
 	}
 
 	// Always insert the original CIDR
-	table.Insert(prefix.Masked(), struct{}{})
+	table.Insert(prefix.Masked(), group)
 
 	// If IPv4 CIDR, also insert as IPv4-mapped IPv6
 	if prefix.Addr().Is4() {
@@ -139,7 +154,7 @@ func insertCIDR(table *bart.Table[struct{}], cidr string) error {
 			netip.AddrFrom16(ipv6Bytes),
 			96+prefix.Bits(), // Convert IPv4 prefix to IPv4-mapped IPv6
 		)
-		table.Insert(ipv6Prefix.Masked(), struct{}{})
+		table.Insert(ipv6Prefix.Masked(), group)
 	}
 
 	return nil
@@ -245,3 +245,51 @@ func TestPredefinedCIDRGroups(t *testing.T) {
 		})
 	}
 }
+
+func TestMatchGroup(t *testing.T) {
+	// Mock predefined CIDRs
+	originalIPRanges := data.IPRanges
+	defer func() { data.IPRanges = originalIPRanges }()
+	data.IPRanges = predefinedCIDRs
+
+	checker := NewIPChecker(validCIDRs, []string{}, testLogger)
+
+	tests := []struct {
+		name          string
+		ip            string
+		expectedGroup string
+		expected      bool
+	}{
+		{
+			name:          "Predefined group is reported by key",
+			ip:            "203.0.113.10",
+			expectedGroup: "openai",
+			expected:      true,
+		},
+		{
+			name:          "Custom range is reported by CIDR",
+			ip:            "10.1.2.3",
+			expectedGroup: "10.0.0.0/8",
+			expected:      true,
+		},
+		{
+			name:          "IPv6 custom range",
+			ip:            "2001:db8::1",
+			expectedGroup: "2001:db8::/48",
+			expected:      true,
+		},
+		{
+			name:     "IP not in ranges",
+			ip:       "172.16.0.1",
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			group, matched := checker.Match(context.Background(), net.ParseIP(tt.ip))
+			assert.Equal(t, tt.expected, matched, "Unexpected match result for IP %s", tt.ip)
+			assert.Equal(t, tt.expectedGroup, group, "Unexpected group for IP %s", tt.ip)
+		})
+	}
+}
@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/netip"
 
 	"go.uber.org/zap"
 
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/jasonlovesdoggo/caddy-defender/responders"
 )
 
 // serveIgnore is a helper function to serve a robots.txt file if the ServeIgnore option is enabled.
@@ -43,6 +45,17 @@ Disallow: /
 	return true
 }
 
+// upstreamCapturer is implemented by responders which learn from the site's own responses to unmatched clients.
+type upstreamCapturer interface {
+	CaptureUpstream(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, func())
+}
+
+// clearer is implemented by responders which let matched clients through once they have proven themselves, such as
+// by solving a challenge.
+type clearer interface {
+	Cleared(r *http.Request) bool
+}
+
 // ServeHTTP implements the middleware logic.
 func (m Defender) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
 	if m.serveGitignore(w, r) {
@@ -60,13 +73,36 @@ func (m Defender) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyht
 		m.log.Error("Invalid client IP", zap.String("ip", host))
 		return caddyhttp.Error(http.StatusForbidden, fmt.Errorf("invalid client IP"))
 	}
+	// Trusted clients are let through before their IP is checked
+	if m.bypass != nil {
+		if subject, ok := m.bypass.Allow(r); ok {
+			m.log.Debug("Bypass credentials accepted", zap.String("ip", clientIP.String()), zap.String("subject", subject))
+			return next.ServeHTTP(w, r)
+		}
+	}
 	m.log.Debug("Ranges", zap.Strings("ranges", m.Ranges))
 	// Check if the client IP is in any of the ranges using the optimized checker
-	if m.ipChecker.ReqAllowed(r.Context(), clientIP) {
+	if group, matched := m.ipChecker.Match(r.Context(), clientIP); !matched {
 		m.log.Debug("IP is not in ranges", zap.String("ip", clientIP.String()))
 	} else {
-		m.log.Debug("IP is in ranges", zap.String("ip", clientIP.String()))
-		return m.responder.ServeHTTP(w, r, next)
+		m.log.Debug("IP is in ranges", zap.String("ip", clientIP.String()), zap.String("group", group))
+		caddyhttp.SetVar(r.Context(), responders.GroupVarKey, group)
+		if c, ok := m.responder.(clearer); ok && c.Cleared(r) {
+			m.log.Debug("Client is cleared", zap.String("ip", clientIP.String()))
+			return next.ServeHTTP(w, r)
+		}
+		if m.alerter != nil {
+			if addr, err := netip.ParseAddr(host); err == nil {
+				m.alerter.Observe(group, addr)
+			}
+		}
+		return m.serveMatched(w, r, next, host, group)
+	}
+
+	if capturer, ok := m.responder.(upstreamCapturer); ok {
+		var done func()
+		w, done = capturer.CaptureUpstream(w, r)
+		defer done()
 	}
 
 	// IP is not in any of the ranges, proceed to the next handler
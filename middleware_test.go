@@ -0,0 +1,186 @@
+package caddydefender
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddytest"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/jasonlovesdoggo/caddy-defender/bypass"
+	"github.com/jasonlovesdoggo/caddy-defender/responders/challenge"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestDefender provisions a Defender from its JSON config.
+func newTestDefender(t *testing.T, config string) *Defender {
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	t.Cleanup(cancel)
+
+	mod, err := ctx.LoadModuleByID("http.handlers.defender", json.RawMessage(config))
+	require.NoError(t, err)
+	return mod.(*Defender)
+}
+
+func TestGarbageCapturesUpstream(t *testing.T) {
+	def := newTestDefender(t, `{
+		"raw_responder": "garbage",
+		"ranges": ["private"],
+		"garbage_config": {"capture_upstream": true, "max_corpus_size": 10, "words": 30}
+	}`)
+
+	const page = "<html><body><p>Our orchard grows apples. Apples ripen in autumn.</p></body></html>"
+	upstream := caddyhttp.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) error {
+		w.Header().Set("Content-Type", "text/html")
+		_, err := w.Write([]byte(page))
+		return err
+	})
+
+	// A human visitor gets the real page, which is captured and completes the corpus
+	human := httptest.NewRequest(http.MethodGet, "/", nil)
+	human.RemoteAddr = "203.0.113.10:1234"
+	rec := httptest.NewRecorder()
+	require.NoError(t, def.ServeHTTP(rec, human, upstream))
+	require.Equal(t, page, rec.Body.String())
+
+	// A matched client gets prose generated from it
+	rec = httptest.NewRecorder()
+	require.NoError(t, def.ServeHTTP(rec, newMatchedRequest(), upstream))
+	words := strings.Fields(rec.Body.String())
+	require.Len(t, words, 30)
+	for _, word := range words {
+		require.Contains(t, page, word)
+	}
+}
+
+func TestChallengeClearsClient(t *testing.T) {
+	def := newTestDefender(t, `{
+		"raw_responder": "challenge",
+		"ranges": ["private"],
+		"challenge_config": {"difficulty": 4, "secret": "a test secret of some length"}
+	}`)
+	next := &nextHandler{}
+
+	// Without a cookie, the client gets the challenge
+	rec := httptest.NewRecorder()
+	require.NoError(t, def.ServeHTTP(rec, newMatchedRequest(), next))
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.False(t, next.called)
+	match := regexp.MustCompile(`name="challenge" value="([^"]+)"`).FindStringSubmatch(rec.Body.String())
+	require.NotNil(t, match)
+
+	// Posting the solution sets the cookie
+	form := url.Values{"challenge": {match[1]}, "nonce": {challenge.Solve(match[1], 4)}, "redirect": {"/"}}
+	req := newMatchedRequest()
+	req.Method = http.MethodPost
+	req.URL.Path = challenge.DefaultVerifyPath
+	req.Body = io.NopCloser(strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	require.NoError(t, def.ServeHTTP(rec, req, next))
+	require.Equal(t, http.StatusSeeOther, rec.Code)
+	require.False(t, next.called)
+
+	// With the cookie, the client is let through
+	req = newMatchedRequest()
+	req.AddCookie(rec.Result().Cookies()[0])
+	rec = httptest.NewRecorder()
+	require.NoError(t, def.ServeHTTP(rec, req, next))
+	require.True(t, next.called)
+}
+
+func TestBypassSkipsRanges(t *testing.T) {
+	def := newTestDefender(t, `{
+		"raw_responder": "block",
+		"ranges": ["private"],
+		"bypass": {"secret": "a test secret of some length"}
+	}`)
+	token, err := bypass.Mint([]byte("a test secret of some length"), bypass.Claims{
+		Subject: "ci",
+		Expiry:  time.Now().Add(time.Hour).Unix(),
+		Paths:   []string{"/api"},
+	})
+	require.NoError(t, err)
+
+	// In scope, the client is let through and the token isn't passed on
+	next := &nextHandler{}
+	req := newMatchedRequest()
+	req.URL.Path = "/api/builds"
+	req.Header.Set(bypass.DefaultHeader, token)
+	require.NoError(t, def.ServeHTTP(httptest.NewRecorder(), req, next))
+	require.True(t, next.called)
+	require.Empty(t, req.Header.Get(bypass.DefaultHeader))
+
+	// Out of scope, the client is blocked
+	next = &nextHandler{}
+	req = newMatchedRequest()
+	req.URL.Path = "/admin"
+	req.Header.Set(bypass.DefaultHeader, token)
+	rec := httptest.NewRecorder()
+	require.NoError(t, def.ServeHTTP(rec, req, next))
+	require.False(t, next.called)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+// skipUnlessCaddyLoadsConfigs skips tests running a Caddy server where Caddy can't load configs: when encoding/json
+// is built on json v2, json.RawMessage is an alias Caddy's module loader doesn't recognize, and provisioning the TLS
+// app, which every HTTP server needs, panics. Build with GOEXPERIMENT=nojsonv2 to run them.
+func skipUnlessCaddyLoadsConfigs(t *testing.T) {
+	t.Helper()
+	if reflect.TypeOf(json.RawMessage{}).PkgPath() != "encoding/json" {
+		t.Skip("Caddy can't load configs with encoding/json built on json v2, run with GOEXPERIMENT=nojsonv2")
+	}
+}
+
+func TestErrorResponderHandleErrors(t *testing.T) {
+	t.Run("Handler error", func(t *testing.T) {
+		def := newTestDefender(t, `{"raw_responder": "error", "ranges": ["private"], "response_code": 451}`)
+		req := newMatchedRequest()
+		repl := caddy.NewReplacer()
+		req = req.WithContext(context.WithValue(req.Context(), caddy.ReplacerCtxKey, repl))
+
+		// Nothing is written, and handle_errors routes get the status and the group
+		rec := httptest.NewRecorder()
+		err := def.ServeHTTP(rec, req, &nextHandler{})
+		var handlerErr caddyhttp.HandlerError
+		require.ErrorAs(t, err, &handlerErr)
+		require.Equal(t, http.StatusUnavailableForLegalReasons, handlerErr.StatusCode)
+		require.Zero(t, rec.Body.Len())
+		require.Equal(t, "Blocked private", repl.ReplaceAll("Blocked {http.error.defender_group}", ""))
+	})
+
+	t.Run("Caddy server", func(t *testing.T) {
+		skipUnlessCaddyLoadsConfigs(t)
+		tester := caddytest.NewTester(t)
+		tester.InitServer(`
+		{
+			skip_install_trust
+			admin localhost:2999
+			http_port 9080
+		}
+
+		http://127.0.0.1:9080 {
+			defender error {
+				ranges 127.0.0.0/8
+				response_code 451
+			}
+			respond "This is what a human sees"
+
+			handle_errors {
+				respond "Blocked {http.error.defender_group}" {http.error.status_code}
+			}
+		}
+		`, "caddyfile")
+
+		tester.AssertGetResponse("http://127.0.0.1:9080/", 451, "Blocked 127.0.0.0/8")
+	})
+}
@@ -0,0 +1,63 @@
+// Package pacing limits the rate at which HTTP responses are written.
+package pacing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"golang.org/x/time/rate"
+)
+
+// NewLimiter returns a limiter for bytesPerSecond which allows bursts of a tenth of a second, so that writes are
+// spread smoothly over time.
+func NewLimiter(bytesPerSecond int) *rate.Limiter {
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), max(bytesPerSecond/10, 1))
+}
+
+// NewWriter returns w with writes paced by limiter. Writes are split into chunks of at most the limiter's burst,
+// each of which is flushed to the client once allowed. Writes fail once ctx is done.
+//
+// The returned writer implements http.Flusher and unwraps to w for use with http.ResponseController.
+func NewWriter(ctx context.Context, w http.ResponseWriter, limiter *rate.Limiter) http.ResponseWriter {
+	return &writer{ResponseWriter: w, limiter: limiter, ctx: ctx}
+}
+
+// writer is an http.ResponseWriter which paces writes by a rate limiter.
+type writer struct {
+	http.ResponseWriter
+	limiter *rate.Limiter
+	ctx     context.Context
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	written := 0
+	burst := w.limiter.Burst()
+	for written < len(p) {
+		chunk := p[written:min(written+burst, len(p))]
+		if err := w.limiter.WaitN(w.ctx, len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := w.ResponseWriter.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		// Flush each chunk so that it reaches the client at the paced rate rather than when buffers fill up
+		if err := http.NewResponseController(w.ResponseWriter).Flush(); err != nil &&
+			!errors.Is(err, http.ErrNotSupported) {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// Flush implements http.Flusher.
+func (w *writer) Flush() {
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap returns the underlying http.ResponseWriter for use with http.ResponseController.
+func (w *writer) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,70 @@
+package pacing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// flushRecorder records the size of the body at every flush.
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushes []int
+}
+
+func (f *flushRecorder) Flush() {
+	f.flushes = append(f.flushes, f.Body.Len())
+	f.ResponseRecorder.Flush()
+}
+
+func TestWriter(t *testing.T) {
+	t.Run("Writes are paced and flushed in chunks", func(t *testing.T) {
+		rec := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+		w := NewWriter(context.Background(), rec, NewLimiter(1000))
+
+		start := time.Now()
+		n, err := w.Write(make([]byte, 500))
+		require.NoError(t, err)
+		require.Equal(t, 500, n)
+
+		// 500 bytes at 1000 B/s with an initial burst of 100 bytes
+		require.GreaterOrEqual(t, time.Since(start), 350*time.Millisecond)
+		require.Equal(t, []int{100, 200, 300, 400, 500}, rec.flushes)
+	})
+
+	t.Run("Write stops when the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		rec := httptest.NewRecorder()
+		w := NewWriter(ctx, rec, NewLimiter(10))
+
+		n, err := w.Write(make([]byte, 100))
+		require.Error(t, err)
+		require.Less(t, n, 100)
+		require.Equal(t, n, rec.Body.Len())
+	})
+
+	t.Run("Works without a flusher", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		// Hide the recorder's Flush method
+		w := NewWriter(context.Background(), struct{ http.ResponseWriter }{rec}, NewLimiter(1000))
+
+		_, err := w.Write([]byte("hello"))
+		require.NoError(t, err)
+		require.Equal(t, "hello", rec.Body.String())
+	})
+
+	t.Run("Unwrap and Flush", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		w := NewWriter(context.Background(), rec, NewLimiter(1000))
+
+		require.Implements(t, (*http.Flusher)(nil), w)
+		require.NoError(t, http.NewResponseController(w).Flush())
+		require.True(t, rec.Flushed)
+		require.Same(t, rec, w.(interface{ Unwrap() http.ResponseWriter }).Unwrap())
+	})
+}
@@ -8,9 +8,15 @@ import (
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
 	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyevents"
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/jasonlovesdoggo/caddy-defender/alerts"
+	"github.com/jasonlovesdoggo/caddy-defender/budget"
+	"github.com/jasonlovesdoggo/caddy-defender/bypass"
+	"github.com/jasonlovesdoggo/caddy-defender/cache"
 	"github.com/jasonlovesdoggo/caddy-defender/matchers/ip"
 	"github.com/jasonlovesdoggo/caddy-defender/responders"
+	"github.com/jasonlovesdoggo/caddy-defender/responders/challenge"
 	"github.com/jasonlovesdoggo/caddy-defender/responders/tarpit"
 	"go.uber.org/zap"
 )
@@ -29,7 +35,7 @@ var (
 	// defaultTarpitTimeout is the default duration for a request to be closed after.
 	defaultTarpitTimeout = time.Second * 30
 	// defaultTarpitBytesPerSecond is the default amount of bytes to stream per second.
-	defaultTarpitBytesPerSecond = 24
+	defaultTarpitBytesPerSecond = 24.0
 	// defaultTarpitResponseCode is the default HTTP respond code for the tarpit responder.
 	defaultTarpitResponseCode = http.StatusOK
 )
@@ -46,7 +52,7 @@ var (
 //	  "handler": "defender",
 //	  "raw_responder": "block",
 //	  "ranges": ["openai", "10.0.0.0/8"],
-//	  "message": "Custom block message" // Only for 'custom' responder
+//	  "message": "Custom block message" // Only for 'block' and 'custom' responders
 //	}
 //
 // ```
@@ -63,11 +69,16 @@ var (
 //
 // Supported responder types:
 // - `block`: Immediately block requests with 403 Forbidden
+// - `challenge`: Serve a proof-of-work challenge, letting clients which solve it through
 // - `custom`: Return a custom message (requires `message` field)
 // - `drop`: Drops the connection
+// - `error`: Return a handler error, so the request is handled by the site's handle_errors routes
 // - `garbage`: Respond with random garbage data
-// - `redirect`: Redirect requests to a URL with 308 permanent redirect
+// - `maze`: Trap crawlers in an endless maze of generated pages linking to each other
+// - `ratelimit`: Rate limit requests, or tag them for a separate rate limiting module
+// - `redirect`: Redirect requests to one of several URLs, with 308 permanent redirect by default
 // - `tarpit`: Stream data at a slow, but configurable rate to stall bots and pollute AI training.
+// - `throttle`: Serve the real response after a delay and at a reduced rate
 //
 // For a list of predefined ranges, see the the [readme]
 // [readme]: https://github.com/JasonLovesDoggo/caddy-defender#embedded-ip-ranges
@@ -75,17 +86,39 @@ type Defender struct {
 	// responder is the internal implementation of the response strategy
 	responder responders.Responder
 	ipChecker *ip.IPChecker
+	alerter   *alerts.Alerter
+	bypass    *bypass.Checker
+	budgets   map[string]*groupBudget
+	events    *caddyevents.App
+	ctx       caddy.Context
 	log       *zap.Logger
-	// Message specifies the custom response message for 'custom' responder type.
-	// Required only when using 'custom' responder.
+	// Message specifies the response body for the 'block' and 'custom' responder types. It may contain
+	// placeholders such as {http.request.remote.host} and {http.vars.defender_group}.
+	// Required only when using 'custom' responder, unless MessageFile is set.
 	Message string `json:"message,omitempty"`
 
-	// URL specifies the custom URL to redirect clients to for 'redirect' responder type.
-	// Required only when using 'redirect' responder.
+	// MessageFile specifies a file to read the response body from instead of Message.
+	MessageFile string `json:"message_file,omitempty"`
+
+	// ResponseCode specifies the status code for the 'block', 'custom', 'error' and 'redirect' responder types.
+	// Default: 403 for 'block' and 'error', 200 for 'custom', 308 for 'redirect'
+	ResponseCode int `json:"response_code,omitempty"`
+
+	// Headers specifies headers added to responses of the 'block' and 'custom' responder types.
+	// Values may contain placeholders.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// URL specifies the custom URL to redirect clients to for 'redirect' responder type. It may contain placeholders.
+	// Required only when using 'redirect' responder, unless RedirectConfig has targets.
 	URL string `json:"url,omitempty"`
 
+	// An optional configuration for the 'redirect' responder, with further targets and path and query preservation.
+	// Default: {Selection: "random"}
+	RedirectConfig responders.RedirectConfig `json:"redirect_config,omitempty"`
+
 	// RawResponder defines the response strategy for blocked requests.
-	// Required. Must be one of: "block", "custom", "drop", "garbage", "redirect", "tarpit"
+	// Required. Must be one of: "block", "challenge", "custom", "drop", "error", "garbage", "maze",
+	// "ratelimit", "redirect", "tarpit", "throttle"
 	RawResponder string `json:"raw_responder,omitempty"`
 
 	// Ranges specifies IP ranges to block, which can be either:
@@ -103,14 +136,65 @@ type Defender struct {
 	// Default: {Headers: {}, timeout: 30s, ResponseCode: 200}
 	TarpitConfig tarpit.Config `json:"tarpit_config,omitempty"`
 
+	// An optional configuration for the 'challenge' responder. Without a secret, the key is kept in Caddy's storage.
+	// Default: {Difficulty: 16, CookieName: "defender_challenge", CookieTTL: 24h, ChallengeTTL: 5m,
+	// VerifyPath: "/.defender/challenge"}
+	ChallengeConfig challenge.Config `json:"challenge_config,omitempty"`
+
+	// An optional configuration for the 'drop' responder, choosing between aborting the request, resetting the
+	// connection and holding it open before aborting.
+	// Default: {Mode: "abort", Hold: 30s}
+	DropConfig responders.DropConfig `json:"drop_config,omitempty"`
+
+	// An optional configuration for the 'garbage' responder. Without a corpus, random nonsense is returned.
+	// Default: {Words: 300, Order: 2, MaxCorpusSize: 10MiB}
+	GarbageConfig responders.GarbageConfig `json:"garbage_config,omitempty"`
+
+	// An optional configuration for the 'maze' responder. Its text is generated with GarbageConfig.
+	// Default: {Prefix: "/maze/", Links: 5, PagesPerSecond: 20, Burst: PagesPerSecond}
+	MazeConfig responders.MazeConfig `json:"maze_config,omitempty"`
+
+	// An optional configuration for the 'throttle' responder. At least one of BytesPerSecond and Delay is required.
+	// Default: {}
+	ThrottleConfig responders.ThrottleConfig `json:"throttle_config,omitempty"`
+
+	// RateLimitHeader is the request header set to "true" on matched requests by the 'ratelimit' responder when
+	// no limit is configured in RateLimitConfig, for use with a separate rate limiting module.
+	// Default: X-RateLimit-Apply
+	RateLimitHeader string `json:"rate_limit_header,omitempty"`
+
+	// An optional configuration for native rate limiting by the 'ratelimit' responder.
+	// Default: {} (tag matched requests with RateLimitHeader only)
+	RateLimitConfig responders.RateLimitConfig `json:"ratelimit_config,omitempty"`
+
 	// ServeIgnore specifies whether to serve a robots.txt file with a "Disallow: /" directive
 	// Default: false
 	ServeIgnore bool `json:"serve_ignore,omitempty"`
+
+	// Budgets are optional aggregate limits shared by all clients of a range group, keyed by the group's
+	// predefined range key or CIDR as given in Ranges.
+	// Default: {} (unlimited)
+	Budgets map[string]*budget.Config `json:"budgets,omitempty"`
+
+	// An optional configuration for webhook alerts on new offenders and traffic spikes.
+	// Default: nil (disabled)
+	Alerts *alerts.Config `json:"alerts,omitempty"`
+
+	// An optional configuration for bypass credentials, which let trusted clients such as monitoring or CI through
+	// even if they are in the configured ranges.
+	// Default: nil (disabled)
+	Bypass *bypass.Config `json:"bypass,omitempty"`
 }
 
 // Provision sets up the middleware, logger, and responder configurations.
 func (m *Defender) Provision(ctx caddy.Context) error {
 	m.log = ctx.Logger(m)
+	m.ctx = ctx
+
+	// Events are only emitted if the events app is loaded
+	if eventsApp, err := ctx.AppIfConfigured("events"); err == nil {
+		m.events = eventsApp.(*caddyevents.App)
+	}
 
 	if len(m.Ranges) == 0 {
 		// set the default ranges to be all of the predefined ranges
@@ -128,11 +212,30 @@ func (m *Defender) Provision(ctx caddy.Context) error {
 			return fmt.Errorf("expected tarpit responder but got %T", m.responder)
 		}
 
+		if m.TarpitConfig.Cache != nil && m.TarpitConfig.Cache.Backend == cache.BackendStorage {
+			tarpitResponder.Storage = ctx.Storage()
+		}
+
 		err := tarpitResponder.ConfigureContentReader()
 		if err != nil {
 			return err
 		}
 
+		tarpitResponder.OnFinish = m.tarpitFinished
+
+		if m.TarpitConfig.Fallback != "" {
+			fallback, err := m.newResponder(m.TarpitConfig.Fallback)
+			if err != nil {
+				return err
+			}
+			if provisioner, ok := fallback.(caddy.Provisioner); ok {
+				if err := provisioner.Provision(ctx); err != nil {
+					return err
+				}
+			}
+			tarpitResponder.Fallback = fallback
+		}
+
 		if m.TarpitConfig.Timeout == 0 {
 			m.TarpitConfig.Timeout = defaultTarpitTimeout
 		}
@@ -146,6 +249,35 @@ func (m *Defender) Provision(ctx caddy.Context) error {
 		}
 	}
 
+	// Provision responders which hold state
+	if provisioner, ok := m.responder.(caddy.Provisioner); ok {
+		if err := provisioner.Provision(ctx); err != nil {
+			return err
+		}
+	}
+
+	if err := m.provisionBudgets(ctx); err != nil {
+		return err
+	}
+
+	if m.Bypass != nil {
+		m.Bypass.SetDefaults()
+		m.bypass = bypass.New(m.Bypass)
+	}
+
+	if m.Alerts != nil {
+		m.alerter = alerts.New(m.Alerts, m.log.Named("alerts"))
+		m.alerter.Start()
+	}
+
+	return nil
+}
+
+// Cleanup stops background work started during provisioning.
+func (m *Defender) Cleanup() error {
+	if m.alerter != nil {
+		m.alerter.Stop()
+	}
 	return nil
 }
 
@@ -160,6 +292,7 @@ func (Defender) CaddyModule() caddy.ModuleInfo {
 // Interface guards
 var (
 	_ caddy.Provisioner           = (*Defender)(nil)
+	_ caddy.CleanerUpper          = (*Defender)(nil)
 	_ caddyhttp.MiddlewareHandler = (*Defender)(nil)
 	_ caddyfile.Unmarshaler       = (*Defender)(nil)
 )
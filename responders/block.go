@@ -1,15 +1,49 @@
 package responders
 
 import (
-	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
 	"net/http"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
 )
 
 // BlockResponder blocks the request with a 403 Forbidden response.
-type BlockResponder struct{}
+type BlockResponder struct {
+	// ResponseCode is the status code of the response.
+	// Default: 403
+	ResponseCode int
+	// Headers are added to the response. Values may contain placeholders.
+	Headers map[string]string
+	// Message is the body of the response. It may contain placeholders.
+	// Default: Access denied
+	Message string
+	// MessageFile is a file to read the body from instead of Message.
+	MessageFile string
+
+	body string
+}
+
+// Provision loads the message.
+func (b *BlockResponder) Provision(_ caddy.Context) error {
+	body, err := loadMessage(b.Message, b.MessageFile)
+	if err != nil {
+		return err
+	}
+	b.body = body
+	return nil
+}
 
-func (b BlockResponder) ServeHTTP(w http.ResponseWriter, _ *http.Request, _ caddyhttp.Handler) error {
-	w.WriteHeader(http.StatusForbidden)
-	_, err := w.Write([]byte("Access denied"))
-	return err
+func (b *BlockResponder) ServeHTTP(w http.ResponseWriter, r *http.Request, _ caddyhttp.Handler) error {
+	code := b.ResponseCode
+	if code == 0 {
+		code = http.StatusForbidden
+	}
+	body := b.body
+	if body == "" {
+		body = b.Message
+	}
+	if body == "" {
+		body = "Access denied"
+	}
+	return writeTemplated(w, r, code, b.Headers, body)
 }
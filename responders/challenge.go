@@ -0,0 +1,116 @@
+package responders
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/caddyserver/certmagic"
+	"github.com/jasonlovesdoggo/caddy-defender/responders/challenge"
+)
+
+// challengeMaxFormSize is the maximum size of a posted solution.
+const challengeMaxFormSize = 4 << 10
+
+// ChallengeResponder serves a JavaScript proof-of-work challenge instead of blocking outright, so real users in
+// blocked ranges, such as on corporate VPNs, can get through. Browsers solve the challenge and post the solution,
+// which is verified here, and get a signed cookie bound to their IP letting them through until it expires.
+type ChallengeResponder struct {
+	Config *challenge.Config
+
+	challenger *challenge.Challenger
+	// storage holds the key if no secret is configured. Defaults to Caddy's storage.
+	storage certmagic.Storage
+}
+
+// Provision sets defaults and loads the key.
+func (c *ChallengeResponder) Provision(ctx caddy.Context) error {
+	if c.Config == nil {
+		c.Config = &challenge.Config{}
+	}
+	c.Config.SetDefaults()
+
+	if c.storage == nil && c.Config.Secret == "" {
+		c.storage = ctx.Storage()
+	}
+	key, err := challenge.LoadKey(ctx, c.Config, c.storage)
+	if err != nil {
+		return err
+	}
+	c.challenger = challenge.New(c.Config, key)
+	return nil
+}
+
+func (c *ChallengeResponder) ServeHTTP(w http.ResponseWriter, r *http.Request, _ caddyhttp.Handler) error {
+	ip := challengeClientIP(r)
+	redirect := r.URL.RequestURI()
+
+	if r.URL.Path == c.Config.VerifyPath && r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, challengeMaxFormSize)
+		if err := r.ParseForm(); err == nil {
+			redirect = safeRedirect(r.PostForm.Get("redirect"))
+			if c.challenger.VerifySolution(ip, r.PostForm.Get("challenge"), r.PostForm.Get("nonce")) == nil {
+				http.SetCookie(w, &http.Cookie{
+					Name:     c.Config.CookieName,
+					Value:    c.challenger.NewCookie(ip),
+					Path:     "/",
+					Expires:  time.Now().Add(c.Config.CookieTTL),
+					Secure:   r.TLS != nil,
+					HttpOnly: true,
+					SameSite: http.SameSiteLaxMode,
+				})
+				http.Redirect(w, r, redirect, http.StatusSeeOther)
+				return nil
+			}
+		}
+		// Failed solutions get a new challenge
+	}
+
+	var body bytes.Buffer
+	err := challenge.WritePage(&body, challenge.Page{
+		Challenge:  c.challenger.NewChallenge(ip),
+		Difficulty: c.Config.Difficulty,
+		VerifyPath: c.Config.VerifyPath,
+		Redirect:   redirect,
+	})
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusForbidden)
+	_, err = body.WriteTo(w)
+	return err
+}
+
+// Cleared reports whether the request carries a valid cookie from a solved challenge.
+func (c *ChallengeResponder) Cleared(r *http.Request) bool {
+	cookie, err := r.Cookie(c.Config.CookieName)
+	if err != nil {
+		return false
+	}
+	return c.challenger.VerifyCookie(challengeClientIP(r), cookie.Value) == nil
+}
+
+// challengeClientIP returns the IP challenges and cookies are bound to.
+func challengeClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// safeRedirect returns target if it is a path on this site, and "/" otherwise, so the verify endpoint can't be
+// used as an open redirect.
+func safeRedirect(target string) string {
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") {
+		return "/"
+	}
+	return target
+}
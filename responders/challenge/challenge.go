@@ -0,0 +1,203 @@
+package challenge
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultDifficulty   = 16
+	DefaultCookieName   = "defender_challenge"
+	DefaultCookieTTL    = 24 * time.Hour
+	DefaultChallengeTTL = 5 * time.Minute
+	DefaultVerifyPath   = "/.defender/challenge"
+	// MaxDifficulty keeps the expected work of a challenge within what a browser solves in reasonable time.
+	MaxDifficulty = 28
+	// MinSecretLength is the minimum length of a configured secret.
+	MinSecretLength = 16
+)
+
+var (
+	ErrMalformed = errors.New("malformed challenge token")
+	ErrSignature = errors.New("invalid challenge token signature")
+	ErrExpired   = errors.New("challenge token expired")
+	ErrUnsolved  = errors.New("challenge solution has too few leading zero bits")
+)
+
+// Config is used for configuring the proof-of-work challenge.
+type Config struct {
+	// Difficulty is the number of leading zero bits the SHA-256 hash of a solution must have. Every further bit
+	// doubles the expected work of the browser.
+	// Default: 16
+	Difficulty int `json:"difficulty,omitempty"`
+	// Secret is the key cookies and challenges are signed with. It must be at least 16 bytes long.
+	// Default: "" (a random key kept in Caddy's storage, shared by all instances using it)
+	Secret string `json:"secret,omitempty"`
+	// CookieName is the name of the cookie issued for a solved challenge.
+	// Default: "defender_challenge"
+	CookieName string `json:"cookie_name,omitempty"`
+	// CookieTTL is how long a solved challenge lets a client through.
+	// Default: 24h
+	CookieTTL time.Duration `json:"cookie_ttl,omitempty"`
+	// ChallengeTTL is how long a client has to solve a challenge.
+	// Default: 5m
+	ChallengeTTL time.Duration `json:"challenge_ttl,omitempty"`
+	// VerifyPath is the path solutions are posted to.
+	// Default: "/.defender/challenge"
+	VerifyPath string `json:"verify_path,omitempty"`
+}
+
+// Validate ensures the challenge configuration is valid.
+func (c *Config) Validate() error {
+	if c.Difficulty < 0 || c.Difficulty > MaxDifficulty {
+		return fmt.Errorf("challenge difficulty must be between 0 and %d", MaxDifficulty)
+	}
+	if c.Secret != "" && len(c.Secret) < MinSecretLength {
+		return fmt.Errorf("challenge secret must be at least %d bytes long", MinSecretLength)
+	}
+	if c.CookieTTL < 0 || c.ChallengeTTL < 0 {
+		return errors.New("challenge cookie_ttl and challenge_ttl must not be negative")
+	}
+	if c.VerifyPath != "" && !strings.HasPrefix(c.VerifyPath, "/") {
+		return fmt.Errorf("challenge verify_path must start with '/': '%s'", c.VerifyPath)
+	}
+	return nil
+}
+
+// SetDefaults sets the defaults of unset options.
+func (c *Config) SetDefaults() {
+	if c.Difficulty == 0 {
+		c.Difficulty = DefaultDifficulty
+	}
+	if c.CookieName == "" {
+		c.CookieName = DefaultCookieName
+	}
+	if c.CookieTTL == 0 {
+		c.CookieTTL = DefaultCookieTTL
+	}
+	if c.ChallengeTTL == 0 {
+		c.ChallengeTTL = DefaultChallengeTTL
+	}
+	if c.VerifyPath == "" {
+		c.VerifyPath = DefaultVerifyPath
+	}
+}
+
+// Challenger issues and verifies challenges and the cookies of solved ones. Both are stateless tokens of the form
+// "<expiry>.<nonce>.<signature>", signed with HMAC-SHA256 over their purpose, the client IP and the difficulty,
+// so a token is only valid for the client it was issued to.
+type Challenger struct {
+	config *Config
+	key    []byte
+	now    func() time.Time
+}
+
+// New returns a new Challenger. The config must have its defaults set.
+func New(config *Config, key []byte) *Challenger {
+	return &Challenger{config: config, key: key, now: time.Now}
+}
+
+// NewChallenge returns a challenge for a client IP.
+func (c *Challenger) NewChallenge(ip string) string {
+	return c.sign("challenge", ip, c.config.ChallengeTTL)
+}
+
+// VerifySolution checks that a challenge was issued to the client IP and hasn't expired, and that the nonce solves
+// it.
+func (c *Challenger) VerifySolution(ip, challenge, nonce string) error {
+	if err := c.verify("challenge", ip, challenge); err != nil {
+		return err
+	}
+	if LeadingZeroBits(challenge, nonce) < c.config.Difficulty {
+		return ErrUnsolved
+	}
+	return nil
+}
+
+// NewCookie returns the value of a cookie for a client IP which solved a challenge.
+func (c *Challenger) NewCookie(ip string) string {
+	return c.sign("cookie", ip, c.config.CookieTTL)
+}
+
+// VerifyCookie checks that a cookie value was issued to the client IP and hasn't expired.
+func (c *Challenger) VerifyCookie(ip, value string) error {
+	return c.verify("cookie", ip, value)
+}
+
+func (c *Challenger) sign(purpose, ip string, ttl time.Duration) string {
+	nonce := make([]byte, 12)
+	_, _ = rand.Read(nonce)
+	payload := strconv.FormatInt(c.now().Add(ttl).Unix(), 10) + "." + base64.RawURLEncoding.EncodeToString(nonce)
+	return payload + "." + c.mac(purpose, ip, payload)
+}
+
+func (c *Challenger) verify(purpose, ip, token string) error {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return ErrMalformed
+	}
+	payload, signature := token[:i], token[i+1:]
+	if !hmac.Equal([]byte(signature), []byte(c.mac(purpose, ip, payload))) {
+		return ErrSignature
+	}
+
+	expiry, _, ok := strings.Cut(payload, ".")
+	if !ok {
+		return ErrMalformed
+	}
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return ErrMalformed
+	}
+	if !c.now().Before(time.Unix(unix, 0)) {
+		return ErrExpired
+	}
+	return nil
+}
+
+func (c *Challenger) mac(purpose, ip, payload string) string {
+	h := hmac.New(sha256.New, c.key)
+	_, _ = fmt.Fprintf(h, "%s|%s|%d|%s", purpose, ip, c.config.Difficulty, payload)
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// LeadingZeroBits returns the number of leading zero bits of the SHA-256 hash of "<challenge>:<nonce>".
+func LeadingZeroBits(challenge, nonce string) int {
+	sum := sha256.Sum256([]byte(challenge + ":" + nonce))
+	zeros := 0
+	for _, b := range sum {
+		zeros += bits.LeadingZeros8(b)
+		if b != 0 {
+			break
+		}
+	}
+	return zeros
+}
+
+// Solve returns a nonce solving a challenge at a difficulty, like the challenge page does in the browser.
+func Solve(challenge string, difficulty int) string {
+	for n := 0; ; n++ {
+		nonce := strconv.Itoa(n)
+		if LeadingZeroBits(challenge, nonce) >= difficulty {
+			return nonce
+		}
+	}
+}
+
+// GenerateKey returns a new random key, hex encoded.
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return []byte(hex.EncodeToString(key)), nil
+}
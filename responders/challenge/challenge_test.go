@@ -0,0 +1,112 @@
+package challenge
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/certmagic"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestChallenger(difficulty int) *Challenger {
+	config := &Config{Difficulty: difficulty}
+	config.SetDefaults()
+	return New(config, []byte("0123456789abcdef0123456789abcdef"))
+}
+
+func TestVerifySolution(t *testing.T) {
+	c := newTestChallenger(8)
+
+	t.Run("Solved", func(t *testing.T) {
+		ch := c.NewChallenge("192.0.2.1")
+		require.NoError(t, c.VerifySolution("192.0.2.1", ch, Solve(ch, 8)))
+	})
+
+	t.Run("Unsolved", func(t *testing.T) {
+		ch := c.NewChallenge("192.0.2.1")
+		for n := 0; ; n++ {
+			nonce := strings.Repeat("x", n)
+			if LeadingZeroBits(ch, nonce) < 8 {
+				require.ErrorIs(t, c.VerifySolution("192.0.2.1", ch, nonce), ErrUnsolved)
+				break
+			}
+		}
+	})
+
+	t.Run("Bound to the client IP", func(t *testing.T) {
+		ch := c.NewChallenge("192.0.2.1")
+		require.ErrorIs(t, c.VerifySolution("192.0.2.2", ch, Solve(ch, 8)), ErrSignature)
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		ch := c.NewChallenge("192.0.2.1")
+		// Extending the expiry invalidates the signature
+		tampered := "9" + ch
+		require.ErrorIs(t, c.VerifySolution("192.0.2.1", tampered, Solve(tampered, 8)), ErrSignature)
+		require.ErrorIs(t, c.VerifySolution("192.0.2.1", "garbage", "0"), ErrMalformed)
+	})
+
+	t.Run("Signed for another difficulty", func(t *testing.T) {
+		easy := newTestChallenger(1)
+		ch := easy.NewChallenge("192.0.2.1")
+		require.ErrorIs(t, c.VerifySolution("192.0.2.1", ch, Solve(ch, 1)), ErrSignature)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		ch := c.NewChallenge("192.0.2.1")
+		nonce := Solve(ch, 8)
+		c.now = func() time.Time { return time.Now().Add(DefaultChallengeTTL + time.Second) }
+		defer func() { c.now = time.Now }()
+		require.ErrorIs(t, c.VerifySolution("192.0.2.1", ch, nonce), ErrExpired)
+	})
+}
+
+func TestVerifyCookie(t *testing.T) {
+	c := newTestChallenger(8)
+	cookie := c.NewCookie("2001:db8::1")
+
+	require.NoError(t, c.VerifyCookie("2001:db8::1", cookie))
+	require.ErrorIs(t, c.VerifyCookie("2001:db8::2", cookie), ErrSignature)
+
+	// A challenge is not a cookie
+	require.ErrorIs(t, c.VerifyCookie("2001:db8::1", c.NewChallenge("2001:db8::1")), ErrSignature)
+
+	c.now = func() time.Time { return time.Now().Add(DefaultCookieTTL + time.Second) }
+	require.ErrorIs(t, c.VerifyCookie("2001:db8::1", cookie), ErrExpired)
+}
+
+func TestLoadKey(t *testing.T) {
+	t.Run("Configured secret", func(t *testing.T) {
+		key, err := LoadKey(context.Background(), &Config{Secret: "a configured secret"}, nil)
+		require.NoError(t, err)
+		require.Equal(t, []byte("a configured secret"), key)
+	})
+
+	t.Run("Generated and kept in storage", func(t *testing.T) {
+		storage := &certmagic.FileStorage{Path: t.TempDir()}
+
+		key, err := LoadKey(context.Background(), &Config{}, storage)
+		require.NoError(t, err)
+		require.Len(t, key, 64)
+
+		again, err := LoadKey(context.Background(), &Config{}, storage)
+		require.NoError(t, err)
+		require.Equal(t, key, again)
+	})
+
+	t.Run("No secret or storage", func(t *testing.T) {
+		_, err := LoadKey(context.Background(), &Config{}, nil)
+		require.ErrorContains(t, err, "requires a secret")
+	})
+}
+
+func TestValidate(t *testing.T) {
+	require.NoError(t, (&Config{}).Validate())
+	require.NoError(t, (&Config{Difficulty: 20, Secret: "sixteen bytes!!!"}).Validate())
+	require.ErrorContains(t, (&Config{Difficulty: 40}).Validate(), "difficulty must be between")
+	require.ErrorContains(t, (&Config{Secret: "short"}).Validate(), "at least 16 bytes")
+	require.ErrorContains(t, (&Config{CookieTTL: -time.Hour}).Validate(), "must not be negative")
+	require.ErrorContains(t, (&Config{VerifyPath: "verify"}).Validate(), "must start with '/'")
+}
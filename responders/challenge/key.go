@@ -0,0 +1,48 @@
+package challenge
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+
+	"github.com/caddyserver/certmagic"
+)
+
+// StorageKey is the key the challenge key is kept under in Caddy's storage.
+const StorageKey = "defender/challenge.key"
+
+// LoadKey returns the configured secret, or the key kept in storage, generating and storing one if there is none.
+func LoadKey(ctx context.Context, config *Config, storage certmagic.Storage) ([]byte, error) {
+	if config.Secret != "" {
+		return []byte(config.Secret), nil
+	}
+	if storage == nil {
+		return nil, errors.New("challenge requires a secret when no storage is available")
+	}
+
+	key, err := storage.Load(ctx, StorageKey)
+	if err == nil {
+		return key, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	// Another instance sharing the storage may generate a key at the same time. Storing under a lock and loading
+	// again makes them agree on one.
+	if err := storage.Lock(ctx, StorageKey); err != nil {
+		return nil, err
+	}
+	defer func() { _ = storage.Unlock(context.WithoutCancel(ctx), StorageKey) }()
+
+	if key, err := storage.Load(ctx, StorageKey); err == nil {
+		return key, nil
+	}
+	if key, err = GenerateKey(); err != nil {
+		return nil, err
+	}
+	if err := storage.Store(ctx, StorageKey, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
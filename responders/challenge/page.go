@@ -0,0 +1,26 @@
+package challenge
+
+import (
+	_ "embed"
+	"html/template"
+	"io"
+)
+
+//go:embed page.html
+var pageHTML string
+
+var pageTemplate = template.Must(template.New("challenge").Parse(pageHTML))
+
+// Page is the data of the challenge page.
+type Page struct {
+	Challenge  string
+	Difficulty int
+	VerifyPath string
+	// Redirect is the path the client is sent back to once the challenge is solved.
+	Redirect string
+}
+
+// WritePage writes the challenge page, which solves the challenge in the browser and posts the solution.
+func WritePage(w io.Writer, page Page) error {
+	return pageTemplate.Execute(w, page)
+}
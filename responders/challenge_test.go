@@ -0,0 +1,117 @@
+package responders
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/certmagic"
+	"github.com/jasonlovesdoggo/caddy-defender/responders/challenge"
+	"github.com/stretchr/testify/require"
+)
+
+var challengePattern = regexp.MustCompile(`name="challenge" value="([^"]+)"`)
+
+func newChallengeRequest(method, target, remoteAddr string, form url.Values) *http.Request {
+	var req *http.Request
+	if form != nil {
+		req = httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req = httptest.NewRequest(method, target, nil)
+	}
+	req.RemoteAddr = remoteAddr
+	return req
+}
+
+// solveChallenge requests a page, solves the challenge on it and posts the solution.
+func solveChallenge(t *testing.T, c *ChallengeResponder, remoteAddr string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	require.NoError(t, c.ServeHTTP(rec, newChallengeRequest(http.MethodGet, "/docs?page=2", remoteAddr, nil), nil))
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	match := challengePattern.FindStringSubmatch(rec.Body.String())
+	require.NotNil(t, match)
+	require.Contains(t, rec.Body.String(), `name="redirect" value="/docs?page=2"`)
+
+	rec = httptest.NewRecorder()
+	form := url.Values{
+		"challenge": {match[1]},
+		"nonce":     {challenge.Solve(match[1], c.Config.Difficulty)},
+		"redirect":  {"/docs?page=2"},
+	}
+	require.NoError(t, c.ServeHTTP(rec, newChallengeRequest(http.MethodPost, c.Config.VerifyPath, remoteAddr, form), nil))
+	return rec
+}
+
+func TestChallengeResponder(t *testing.T) {
+	newResponder := func(t *testing.T) *ChallengeResponder {
+		c := &ChallengeResponder{Config: &challenge.Config{Difficulty: 8, Secret: "a test secret of some length"}}
+		require.NoError(t, c.Provision(caddy.Context{Context: context.Background()}))
+		return c
+	}
+
+	t.Run("Solving the challenge clears the client", func(t *testing.T) {
+		c := newResponder(t)
+
+		rec := solveChallenge(t, c, "192.0.2.1:1234")
+		require.Equal(t, http.StatusSeeOther, rec.Code)
+		require.Equal(t, "/docs?page=2", rec.Header().Get("Location"))
+		cookies := rec.Result().Cookies()
+		require.Len(t, cookies, 1)
+		require.True(t, cookies[0].HttpOnly)
+
+		req := newChallengeRequest(http.MethodGet, "/", "192.0.2.1:5678", nil)
+		req.AddCookie(cookies[0])
+		require.True(t, c.Cleared(req))
+
+		// The cookie is bound to the client IP
+		req.RemoteAddr = "192.0.2.2:5678"
+		require.False(t, c.Cleared(req))
+		require.False(t, c.Cleared(newChallengeRequest(http.MethodGet, "/", "192.0.2.1:5678", nil)))
+	})
+
+	t.Run("Wrong solution gets a new challenge", func(t *testing.T) {
+		c := newResponder(t)
+
+		rec := httptest.NewRecorder()
+		form := url.Values{"challenge": {"1.2.3"}, "nonce": {"0"}, "redirect": {"/docs"}}
+		require.NoError(t, c.ServeHTTP(rec, newChallengeRequest(http.MethodPost, c.Config.VerifyPath, "192.0.2.1:1234", form), nil))
+		require.Equal(t, http.StatusForbidden, rec.Code)
+		require.Empty(t, rec.Result().Cookies())
+		require.Regexp(t, challengePattern, rec.Body.String())
+		require.Contains(t, rec.Body.String(), `name="redirect" value="/docs"`)
+	})
+
+	t.Run("No open redirects", func(t *testing.T) {
+		for target, want := range map[string]string{
+			"/ok":                 "/ok",
+			"//evil.example.com":  "/",
+			"/\\evil.example.com": "/",
+			"https://evil.com/":   "/",
+			"":                    "/",
+		} {
+			require.Equal(t, want, safeRedirect(target), target)
+		}
+	})
+
+	t.Run("Key from storage", func(t *testing.T) {
+		storage := &certmagic.FileStorage{Path: t.TempDir()}
+		c := &ChallengeResponder{Config: &challenge.Config{Difficulty: 4}, storage: storage}
+		require.NoError(t, c.Provision(caddy.Context{Context: context.Background()}))
+
+		// Another instance sharing the storage accepts the cookie
+		other := &ChallengeResponder{Config: &challenge.Config{Difficulty: 4}, storage: storage}
+		require.NoError(t, other.Provision(caddy.Context{Context: context.Background()}))
+
+		rec := solveChallenge(t, c, "192.0.2.1:1234")
+		req := newChallengeRequest(http.MethodGet, "/", "192.0.2.1:1234", nil)
+		req.AddCookie(rec.Result().Cookies()[0])
+		require.True(t, other.Cleared(req))
+	})
+}
@@ -1,18 +1,45 @@
 package responders
 
 import (
-	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
 	"net/http"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
 )
 
 // CustomResponder returns a custom response.
 type CustomResponder struct {
+	// ResponseCode is the status code of the response.
+	// Default: 200
+	ResponseCode int `json:"response_code,omitempty"`
+	// Headers are added to the response. Values may contain placeholders.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Message is the body of the response. It may contain placeholders.
 	Message string `json:"message"`
+	// MessageFile is a file to read the body from instead of Message.
+	MessageFile string `json:"message_file,omitempty"`
+
+	body string
+}
+
+// Provision loads the message.
+func (c *CustomResponder) Provision(_ caddy.Context) error {
+	body, err := loadMessage(c.Message, c.MessageFile)
+	if err != nil {
+		return err
+	}
+	c.body = body
+	return nil
 }
 
-func (c CustomResponder) ServeHTTP(w http.ResponseWriter, _ *http.Request, _ caddyhttp.Handler) error {
-	w.Header().Set("Content-Type", "text/plain")
-	w.WriteHeader(http.StatusOK)
-	_, err := w.Write([]byte(c.Message))
-	return err
+func (c *CustomResponder) ServeHTTP(w http.ResponseWriter, r *http.Request, _ caddyhttp.Handler) error {
+	code := c.ResponseCode
+	if code == 0 {
+		code = http.StatusOK
+	}
+	body := c.body
+	if body == "" {
+		body = c.Message
+	}
+	return writeTemplated(w, r, code, c.Headers, body)
 }
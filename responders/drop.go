@@ -1,14 +1,119 @@
 package responders
 
 import (
+	"fmt"
+	"net"
 	"net/http"
+	"time"
 
+	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
 )
 
+const defaultDropHold = 30 * time.Second
+
+// DropConfig holds the drop responder's configuration.
+type DropConfig struct {
+	// Mode is how the connection is dropped:
+	//   - "abort": abort the request. HTTP/1.1 connections are closed gracefully, and on HTTP/2 only the stream is
+	//     reset, leaving the connection usable.
+	//   - "reset": close HTTP/1.1 connections with a TCP RST, and on HTTP/2 have the server send GOAWAY and close
+	//     the connection once the stream is reset. HTTP/3 requests are aborted.
+	//   - "hold": keep the connection open without responding, then abort the request.
+	// Default: "abort"
+	Mode string `json:"mode,omitempty"`
+	// Hold is how long the "hold" mode keeps the connection open.
+	// Default: 30s
+	Hold time.Duration `json:"hold,omitempty"`
+}
+
+// Validate ensures the drop configuration is valid.
+func (c *DropConfig) Validate() error {
+	switch c.Mode {
+	case "", "abort", "reset", "hold":
+	default:
+		return fmt.Errorf("invalid drop mode '%s'", c.Mode)
+	}
+	if c.Hold < 0 {
+		return fmt.Errorf("drop hold must not be negative")
+	}
+	return nil
+}
+
 // DropResponder drops the connection.
-type DropResponder struct{}
+type DropResponder struct {
+	Config *DropConfig
+}
+
+// Provision sets defaults.
+func (d *DropResponder) Provision(_ caddy.Context) error {
+	if d.Config == nil {
+		d.Config = &DropConfig{}
+	}
+	if d.Config.Mode == "" {
+		d.Config.Mode = "abort"
+	}
+	if d.Config.Hold == 0 {
+		d.Config.Hold = defaultDropHold
+	}
+	return nil
+}
 
-func (d *DropResponder) ServeHTTP(w http.ResponseWriter, _ *http.Request, _ caddyhttp.Handler) error {
+func (d *DropResponder) ServeHTTP(w http.ResponseWriter, r *http.Request, _ caddyhttp.Handler) error {
+	switch d.Config.Mode {
+	case "reset":
+		if r.ProtoMajor == 2 {
+			// The stream is reset below, leaving the connection idle so the server closes it
+			goAway(w)
+		} else if resetConnection(w, r) {
+			return nil
+		}
+		// Connections which can't be reset, such as HTTP/3 ones, are aborted instead
+	case "hold":
+		timer := time.NewTimer(d.Config.Hold)
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			timer.Stop()
+		}
+	}
 	panic(http.ErrAbortHandler)
 }
+
+// resetConnection closes the request's HTTP/1 connection with a TCP RST, and reports whether it could.
+func resetConnection(w http.ResponseWriter, r *http.Request) bool {
+	if r.ProtoMajor != 1 {
+		return false
+	}
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return false
+	}
+	setLingerZero(conn)
+	_ = conn.Close()
+	return true
+}
+
+// goAway has the HTTP/2 server send GOAWAY and close the request's connection once it is idle. Connection: close is
+// how a handler asks for it, so the frame is written by the server rather than racing its writes. The response's
+// headers are sent with it.
+func goAway(w http.ResponseWriter) {
+	w.Header().Set("Connection", "close")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	_ = http.NewResponseController(w).Flush()
+}
+
+// setLingerZero makes closing conn send a TCP RST instead of a FIN, if it is a TCP connection.
+func setLingerZero(conn net.Conn) {
+	for {
+		switch c := conn.(type) {
+		case interface{ SetLinger(sec int) error }:
+			_ = c.SetLinger(0)
+			return
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package responders
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// newDropServer starts a server responding with the drop responder.
+func newDropServer(t *testing.T, config *DropConfig, h2 bool) *httptest.Server {
+	d := &DropResponder{Config: config}
+	require.NoError(t, d.Provision(caddy.Context{}))
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = d.ServeHTTP(w, r, nil)
+	}))
+	if h2 {
+		server.EnableHTTP2 = true
+		server.StartTLS()
+	} else {
+		server.Start()
+	}
+	t.Cleanup(server.Close)
+	return server
+}
+
+// http1Get sends a request over a new connection and returns everything read until the connection is closed.
+func http1Get(t *testing.T, server *httptest.Server) ([]byte, error) {
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+	require.NoError(t, err)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	return io.ReadAll(conn)
+}
+
+// http2Get sends a request over a new HTTP/2 connection and returns the frames received until the connection is
+// closed or a frame matching done is received.
+func http2Get(t *testing.T, server *httptest.Server, done func(http2.Frame) bool) []http2.Frame {
+	conn, err := tls.Dial("tcp", server.Listener.Addr().String(), &tls.Config{
+		NextProtos:         []string{"h2"},
+		InsecureSkipVerify: true, //nolint:gosec
+	})
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Equal(t, "h2", conn.ConnectionState().NegotiatedProtocol)
+
+	_, err = conn.Write([]byte(http2.ClientPreface))
+	require.NoError(t, err)
+	framer := http2.NewFramer(conn, conn)
+	require.NoError(t, framer.WriteSettings())
+
+	var headers bytes.Buffer
+	encoder := hpack.NewEncoder(&headers)
+	for _, field := range []hpack.HeaderField{
+		{Name: ":method", Value: "GET"},
+		{Name: ":scheme", Value: "https"},
+		{Name: ":authority", Value: "example.com"},
+		{Name: ":path", Value: "/"},
+	} {
+		require.NoError(t, encoder.WriteField(field))
+	}
+	require.NoError(t, framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      1,
+		BlockFragment: headers.Bytes(),
+		EndStream:     true,
+		EndHeaders:    true,
+	}))
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	var frames []http2.Frame
+	for {
+		frame, err := framer.ReadFrame()
+		if err != nil {
+			require.ErrorIs(t, err, io.EOF)
+			return frames
+		}
+		frames = append(frames, frame)
+		if done(frame) {
+			return frames
+		}
+	}
+}
+
+func TestDropResponder(t *testing.T) {
+	t.Run("HTTP/1.1 abort closes gracefully", func(t *testing.T) {
+		server := newDropServer(t, nil, false)
+
+		data, err := http1Get(t, server)
+		require.NoError(t, err)
+		require.Empty(t, data)
+	})
+
+	t.Run("HTTP/1.1 reset sends RST", func(t *testing.T) {
+		server := newDropServer(t, &DropConfig{Mode: "reset"}, false)
+
+		data, err := http1Get(t, server)
+		require.ErrorIs(t, err, syscall.ECONNRESET)
+		require.Empty(t, data)
+	})
+
+	t.Run("HTTP/1.1 hold", func(t *testing.T) {
+		server := newDropServer(t, &DropConfig{Mode: "hold", Hold: 200 * time.Millisecond}, false)
+
+		start := time.Now()
+		data, err := http1Get(t, server)
+		require.NoError(t, err)
+		require.Empty(t, data)
+		require.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+	})
+
+	t.Run("HTTP/2 abort resets only the stream", func(t *testing.T) {
+		server := newDropServer(t, nil, true)
+
+		frames := http2Get(t, server, func(frame http2.Frame) bool {
+			_, ok := frame.(*http2.RSTStreamFrame)
+			return ok
+		})
+		require.IsType(t, &http2.RSTStreamFrame{}, frames[len(frames)-1])
+		for _, frame := range frames {
+			require.NotEqual(t, http2.FrameGoAway, frame.Header().Type)
+		}
+	})
+
+	t.Run("HTTP/2 reset sends GOAWAY", func(t *testing.T) {
+		server := newDropServer(t, &DropConfig{Mode: "reset"}, true)
+
+		// Frames are read until the server closes the connection
+		frames := http2Get(t, server, func(http2.Frame) bool { return false })
+		var types []http2.FrameType
+		for _, frame := range frames {
+			types = append(types, frame.Header().Type)
+		}
+		require.Contains(t, types, http2.FrameGoAway)
+		require.Contains(t, types, http2.FrameRSTStream)
+		for _, frame := range frames {
+			require.NotEqual(t, http2.FrameData, frame.Header().Type, "expected no response body")
+		}
+	})
+
+	t.Run("Hold ends when the client leaves", func(t *testing.T) {
+		d := &DropResponder{Config: &DropConfig{Mode: "hold", Hold: time.Minute}}
+		require.NoError(t, d.Provision(caddy.Context{}))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+
+		start := time.Now()
+		require.PanicsWithValue(t, http.ErrAbortHandler, func() {
+			_ = d.ServeHTTP(httptest.NewRecorder(), req, nil)
+		})
+		require.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("Reset without a connection aborts", func(t *testing.T) {
+		d := &DropResponder{Config: &DropConfig{Mode: "reset"}}
+		require.NoError(t, d.Provision(caddy.Context{}))
+
+		require.PanicsWithValue(t, http.ErrAbortHandler, func() {
+			_ = d.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), nil)
+		})
+	})
+}
+
+func TestDropConfigValidate(t *testing.T) {
+	require.NoError(t, (&DropConfig{Mode: "reset"}).Validate())
+	require.ErrorContains(t, (&DropConfig{Mode: "explode"}).Validate(), "invalid drop mode")
+	require.ErrorContains(t, (&DropConfig{Hold: -time.Second}).Validate(), "must not be negative")
+}
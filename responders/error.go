@@ -0,0 +1,34 @@
+package responders
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// ErrorGroupPlaceholder is the placeholder holding the matched range group in handle_errors routes.
+const ErrorGroupPlaceholder = "http.error.defender_group"
+
+// ErrorResponder returns a handler error instead of writing a response, so that blocked requests are handled by
+// the site's handle_errors routes.
+type ErrorResponder struct {
+	// ResponseCode is the status code of the error, available as {http.error.status_code}.
+	// Default: 403
+	ResponseCode int
+}
+
+func (e *ErrorResponder) ServeHTTP(_ http.ResponseWriter, r *http.Request, _ caddyhttp.Handler) error {
+	code := e.ResponseCode
+	if code == 0 {
+		code = http.StatusForbidden
+	}
+
+	group := MatchedGroup(r)
+	if repl, ok := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer); ok {
+		repl.Set(ErrorGroupPlaceholder, group)
+	}
+
+	return caddyhttp.Error(code, fmt.Errorf("request from range group %q blocked", group))
+}
@@ -0,0 +1,42 @@
+package responders
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorResponder(t *testing.T) {
+	t.Run("Default status", func(t *testing.T) {
+		r := &ErrorResponder{}
+		rec := httptest.NewRecorder()
+
+		err := r.ServeHTTP(rec, newTemplateRequest(""), nil)
+
+		var handlerErr caddyhttp.HandlerError
+		require.True(t, errors.As(err, &handlerErr))
+		require.Equal(t, http.StatusForbidden, handlerErr.StatusCode)
+		// Nothing is written, so handle_errors routes can render the response
+		require.Zero(t, rec.Body.Len())
+	})
+
+	t.Run("Custom status and group placeholder", func(t *testing.T) {
+		r := &ErrorResponder{ResponseCode: http.StatusUnavailableForLegalReasons}
+		req := newTemplateRequest("")
+
+		err := r.ServeHTTP(httptest.NewRecorder(), req, nil)
+
+		var handlerErr caddyhttp.HandlerError
+		require.True(t, errors.As(err, &handlerErr))
+		require.Equal(t, http.StatusUnavailableForLegalReasons, handlerErr.StatusCode)
+		require.ErrorContains(t, handlerErr.Err, `"openai"`)
+
+		repl := req.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+		require.Equal(t, "Blocked openai", repl.ReplaceAll("Blocked {http.error.defender_group}", ""))
+	})
+}
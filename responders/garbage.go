@@ -2,60 +2,266 @@
 package responders
 
 import (
-	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"html/template"
+	"io"
 	"math/rand/v2"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/jasonlovesdoggo/caddy-defender/responders/garbage"
 )
 
-// GarbageResponder returns garbage data to the client.
-type GarbageResponder struct{}
+const (
+	defaultGarbageWords         = 300
+	defaultGarbageOrder         = 2
+	defaultGarbageMaxCorpusSize = 10 << 20
+	// garbageNonsenseLines is the length of the output when there is no corpus to generate prose from.
+	garbageNonsenseLines = 100
+	// garbageMaxCaptureSize is the maximum number of bytes captured from a single upstream response.
+	garbageMaxCaptureSize = 256 << 10
+)
+
+// GarbageConfig holds the garbage responder's configuration.
+type GarbageConfig struct {
+	// Corpus are the files, or glob patterns matching them, that prose is generated from.
+	// The visible text of HTML files is used.
+	Corpus []string `json:"corpus,omitempty"`
+	// CaptureUpstream adds the site's own text responses to unmatched, anonymous clients to the corpus. Captured text
+	// is only used once the corpus reaches MaxCorpusSize, and the model is frozen from then on so that pages stay the
+	// same.
+	// Default: false
+	CaptureUpstream bool `json:"capture_upstream,omitempty"`
+	// MaxCorpusSize is the size of the corpus in bytes at which upstream responses are no longer captured.
+	// Default: 10MiB
+	MaxCorpusSize int `json:"max_corpus_size,omitempty"`
+	// Words is the length of the generated prose.
+	// Default: 300
+	Words int `json:"words,omitempty"`
+	// Order is the number of previous words the next word is chosen by. Higher orders are more coherent,
+	// but repeat the corpus more closely.
+	// Default: 2
+	Order int `json:"order,omitempty"`
+	// JSONSchema is a JSON Schema file that generated JSON is valid against.
+	// Default: "" (a generic API listing)
+	JSONSchema string `json:"json_schema,omitempty"`
+}
+
+// Validate ensures the garbage configuration is valid.
+func (c *GarbageConfig) Validate() error {
+	if c.MaxCorpusSize < 0 || c.Words < 0 || c.Order < 0 {
+		return errors.New("garbage max_corpus_size, words and order must not be negative")
+	}
+	return nil
+}
+
+// GarbageResponder returns garbage data to the client. With a corpus, it is plausible-looking but meaningless prose
+// generated by a Markov chain, otherwise random nonsense. The output is seeded by the request URL so that the same
+// page always returns the same garbage.
+//
+// The payload's type is negotiated from the path's extension and the Accept header, so that crawlers get
+// syntactically valid HTML, JSON, RSS, PNG or JPEG garbage where they expect it, and text otherwise.
+type GarbageResponder struct {
+	Config *GarbageConfig
+
+	// model generates the prose. With upstream capture, it is replaced once by the captured model.
+	model atomic.Pointer[garbage.Model]
+	// captured is trained on the corpus and upstream responses until it reaches the maximum corpus size, or is nil
+	// if capture is disabled or complete.
+	captured atomic.Pointer[garbage.Model]
+	schema   *garbage.Schema
+}
+
+// Provision sets defaults and trains the model on the corpus.
+func (g *GarbageResponder) Provision(_ caddy.Context) error {
+	if g.Config == nil {
+		g.Config = &GarbageConfig{}
+	}
+	if g.Config.Words == 0 {
+		g.Config.Words = defaultGarbageWords
+	}
+	if g.Config.Order == 0 {
+		g.Config.Order = defaultGarbageOrder
+	}
+	if g.Config.MaxCorpusSize == 0 {
+		g.Config.MaxCorpusSize = defaultGarbageMaxCorpusSize
+	}
+
+	if g.Config.JSONSchema != "" {
+		schema, err := garbage.LoadSchema(g.Config.JSONSchema)
+		if err != nil {
+			return err
+		}
+		g.schema = schema
+	}
+
+	model := garbage.NewModel(g.Config.Order)
+	if err := model.TrainFiles(g.Config.Corpus); err != nil {
+		return err
+	}
+	g.model.Store(model)
+	g.captured.Store(nil)
+	if g.Config.CaptureUpstream && model.Size() < g.Config.MaxCorpusSize {
+		g.captured.Store(model.Clone())
+	}
+	return nil
+}
+
+func (g *GarbageResponder) ServeHTTP(w http.ResponseWriter, r *http.Request, _ caddyhttp.Handler) error {
+	rng := garbage.RequestRand(r)
+	format := garbage.Negotiate(r)
 
-func (g GarbageResponder) ServeHTTP(w http.ResponseWriter, _ *http.Request, _ caddyhttp.Handler) error {
-	garbage := generateTerribleText(100)
-	w.Header().Set("Content-Type", "text/plain")
+	// Payloads are buffered so that a failure to generate one doesn't leave a partial response
+	var body bytes.Buffer
+	var err error
+	switch format {
+	case garbage.FormatHTML:
+		err = garbagePageTemplate.Execute(&body, g.page(rng))
+	case garbage.FormatJSON:
+		err = json.NewEncoder(&body).Encode(g.schema.Generate(rng, g.phrase))
+	case garbage.FormatXML:
+		err = g.writeFeed(&body, r, rng)
+	case garbage.FormatPNG, garbage.FormatJPEG:
+		err = garbage.WriteImage(&body, rng, format)
+	default:
+		body.WriteString(g.generate(rng))
+	}
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Length", strconv.Itoa(body.Len()))
 	w.WriteHeader(http.StatusOK)
-	_, err := w.Write([]byte(garbage))
+	_, err = body.WriteTo(w)
 	return err
 }
 
-var (
-	// A mix of characters, symbols, and numbers to create irregularity
-	characters = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!@#$%^&*()_+-=[]{};':\",./<>?\\|`~")
-	// A list of nonsensical "words" to add unpredictability
-	nonsenseWords = []string{"florb", "zaxor", "quint", "blarg", "wibble", "fizzle", "gronk", "snark", "ploosh", "dribble"}
-)
+// garbagePage is the data of a generated HTML page.
+type garbagePage struct {
+	Title      string
+	Paragraphs []string
+	Links      []garbageLink
+}
+
+// garbageLink is a link on a generated HTML page.
+type garbageLink struct {
+	URL  string
+	Text string
+}
 
-// generateTerribleText generates a block of text that is difficult for AI to train on
-func generateTerribleText(lines int) string {
-	var sb strings.Builder
+var garbagePageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body>
+<h1>{{.Title}}</h1>
+{{range .Paragraphs}}<p>{{.}}</p>
+{{end}}{{if .Links}}<ul>
+{{range .Links}}<li><a href="{{.URL}}">{{.Text}}</a></li>
+{{end}}</ul>
+{{end}}</body>
+</html>
+`))
 
-	for i := 0; i < lines; i++ {
-		// Randomly decide whether to generate a nonsense word or random characters
-		if rand.IntN(2) == 0 {
-			sb.WriteString(generateNonsenseWord())
-		} else {
-			sb.WriteString(generateRandomCharacters(rand.IntN(50) + 10)) // Random length between 10 and 60
-		}
+// page returns an HTML page of generated text.
+func (g *GarbageResponder) page(rng *rand.Rand) garbagePage {
+	return garbagePage{
+		Title:      g.phrase(rng, 2+rng.IntN(4)),
+		Paragraphs: strings.Split(strings.TrimSpace(g.generate(rng)), "\n\n"),
+	}
+}
+
+// garbageFeed is an RSS 2.0 feed.
+type garbageFeed struct {
+	XMLName xml.Name `xml:"rss"`
+	Version string   `xml:"version,attr"`
+	Channel struct {
+		Title       string            `xml:"title"`
+		Link        string            `xml:"link"`
+		Description string            `xml:"description"`
+		Items       []garbageFeedItem `xml:"item"`
+	} `xml:"channel"`
+}
 
-		// Add random punctuation or symbols
-		sb.WriteRune(characters[rand.IntN(len(characters))])
-		sb.WriteString("\n") // Newline after each "line"
+type garbageFeedItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	PubDate     string `xml:"pubDate"`
+	GUID        string `xml:"guid"`
+}
+
+// writeFeed writes an RSS feed of generated items linking to the requested site.
+func (g *GarbageResponder) writeFeed(w io.Writer, r *http.Request, rng *rand.Rand) error {
+	site := "http://" + r.Host
+	if r.TLS != nil {
+		site = "https://" + r.Host
+	}
+
+	feed := garbageFeed{Version: "2.0"}
+	feed.Channel.Title = g.phrase(rng, 2+rng.IntN(3))
+	feed.Channel.Link = site + "/"
+	feed.Channel.Description = g.phrase(rng, 8)
+	date := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5+rng.IntN(10); i++ {
+		title := g.phrase(rng, 3+rng.IntN(5))
+		link := site + "/" + strings.ReplaceAll(strings.ToLower(garbage.NonsenseWords(rng, 3)), " ", "-")
+		date = date.Add(-time.Duration(1+rng.IntN(96)) * time.Hour)
+		feed.Channel.Items = append(feed.Channel.Items, garbageFeedItem{
+			Title:       title,
+			Link:        link,
+			Description: g.phrase(rng, 30+rng.IntN(30)),
+			PubDate:     date.Format(time.RFC1123Z),
+			GUID:        link,
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
 	}
+	return xml.NewEncoder(w).Encode(feed)
+}
 
-	return sb.String()
+// generate returns prose from the model, or nonsense if there is nothing to generate prose from.
+func (g *GarbageResponder) generate(rng *rand.Rand) string {
+	if model := g.model.Load(); model != nil && !model.Empty() {
+		return model.Generate(rng, g.Config.Words)
+	}
+	return garbage.Nonsense(rng, garbageNonsenseLines)
 }
 
-// generateNonsenseWord generates a random nonsense word
-func generateNonsenseWord() string {
-	return nonsenseWords[rand.IntN(len(nonsenseWords))]
+// phrase returns a short phrase of n words, for titles and link text.
+func (g *GarbageResponder) phrase(rng *rand.Rand, n int) string {
+	if model := g.model.Load(); model != nil && !model.Empty() {
+		return strings.TrimRight(model.Generate(rng, n), ".!?,;:")
+	}
+	return garbage.NonsenseWords(rng, n)
 }
 
-// generateRandomCharacters generates a string of random characters and symbols
-func generateRandomCharacters(length int) string {
-	var sb strings.Builder
-	for i := 0; i < length; i++ {
-		sb.WriteRune(characters[rand.IntN(len(characters))])
+// CaptureUpstream wraps the response writer of a request passed on to the upstream so that its text is added to the
+// corpus, if enabled. Requests with credentials aren't captured, as their responses may be private to a user. The
+// returned function must be called once the response is complete.
+func (g *GarbageResponder) CaptureUpstream(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, func()) {
+	captured := g.captured.Load()
+	if captured == nil || r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != "" {
+		return w, func() {}
+	}
+
+	capture := garbage.NewCaptureWriter(w, garbageMaxCaptureSize)
+	return capture, func() {
+		captured.Train(capture.Text())
+		if captured.Size() >= g.Config.MaxCorpusSize && g.captured.CompareAndSwap(captured, nil) {
+			// The corpus is complete, and generates the same pages from now on
+			captured.Freeze()
+			g.model.Store(captured)
+		}
 	}
-	return sb.String()
 }
@@ -0,0 +1,85 @@
+package garbage
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// CaptureWriter is an http.ResponseWriter which records successful, uncompressed text responses up to a limit,
+// so that they can be trained on. Responses which set cookies or mustn't be cached by shared caches are skipped, as
+// they may be private to a user.
+type CaptureWriter struct {
+	http.ResponseWriter
+	buf     bytes.Buffer
+	limit   int
+	decided bool
+	capture bool
+	html    bool
+}
+
+// NewCaptureWriter returns a CaptureWriter recording up to limit bytes of the response written to w.
+func NewCaptureWriter(w http.ResponseWriter, limit int) *CaptureWriter {
+	return &CaptureWriter{ResponseWriter: w, limit: limit}
+}
+
+func (c *CaptureWriter) WriteHeader(code int) {
+	if !c.decided && code >= 200 {
+		c.decided = true
+		mediaType, _, _ := mime.ParseMediaType(c.Header().Get("Content-Type"))
+		c.html = mediaType == "text/html"
+		c.capture = code == http.StatusOK &&
+			(c.html || mediaType == "text/plain") &&
+			c.Header().Get("Content-Encoding") == "" &&
+			shared(c.Header())
+	}
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *CaptureWriter) Write(p []byte) (int, error) {
+	if !c.decided {
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.capture && c.buf.Len() < c.limit {
+		c.buf.Write(p[:min(len(p), c.limit-c.buf.Len())])
+	}
+	return c.ResponseWriter.Write(p)
+}
+
+// shared reports whether a response may be shared with other clients, as it neither sets cookies nor is private.
+func shared(header http.Header) bool {
+	if header.Get("Set-Cookie") != "" {
+		return false
+	}
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, _, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if strings.EqualFold(name, "private") || strings.EqualFold(name, "no-store") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Text returns the captured text, or an empty string if the response wasn't captured.
+func (c *CaptureWriter) Text() string {
+	if !c.capture {
+		return ""
+	}
+	if c.html {
+		return ExtractText(&c.buf)
+	}
+	return c.buf.String()
+}
+
+// Flush implements http.Flusher.
+func (c *CaptureWriter) Flush() {
+	_ = http.NewResponseController(c.ResponseWriter).Flush()
+}
+
+// Unwrap returns the underlying http.ResponseWriter for use with http.ResponseController.
+func (c *CaptureWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
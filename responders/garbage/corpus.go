@@ -0,0 +1,88 @@
+package garbage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// TrainFiles trains the model on the files matching the glob patterns. The visible text of HTML files is used.
+func (m *Model) TrainFiles(patterns []string) error {
+	for _, pattern := range patterns {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid corpus pattern %q: %v", pattern, err)
+		}
+		if len(paths) == 0 {
+			return fmt.Errorf("corpus pattern %q matches no files", pattern)
+		}
+
+		for _, path := range paths {
+			if err := m.trainFile(path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Model) trainFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm":
+		m.Train(ExtractText(file))
+	default:
+		content, err := io.ReadAll(file)
+		if err != nil {
+			return err
+		}
+		m.Train(string(content))
+	}
+	return nil
+}
+
+// ExtractText returns the visible text of an HTML document.
+func ExtractText(r io.Reader) string {
+	var sb strings.Builder
+	tokenizer := html.NewTokenizer(r)
+	skip := 0
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return sb.String()
+		case html.StartTagToken:
+			if invisible(tokenizer) {
+				skip++
+			}
+		case html.EndTagToken:
+			if invisible(tokenizer) && skip > 0 {
+				skip--
+			}
+		case html.TextToken:
+			if skip == 0 {
+				sb.Write(tokenizer.Text())
+				sb.WriteByte(' ')
+			}
+		default:
+		}
+	}
+}
+
+// invisible reports whether the current tag's content isn't displayed.
+func invisible(tokenizer *html.Tokenizer) bool {
+	name, _ := tokenizer.TagName()
+	switch string(name) {
+	case "script", "style", "noscript", "template", "head":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package garbage
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Format is the type of payload generated for a request.
+type Format string
+
+const (
+	FormatText Format = "text"
+	FormatHTML Format = "html"
+	FormatJSON Format = "json"
+	FormatXML  Format = "xml"
+	FormatPNG  Format = "png"
+	FormatJPEG Format = "jpeg"
+)
+
+var formatContentTypes = map[Format]string{
+	FormatText: "text/plain; charset=utf-8",
+	FormatHTML: "text/html; charset=utf-8",
+	FormatJSON: "application/json",
+	FormatXML:  "application/rss+xml; charset=utf-8",
+	FormatPNG:  "image/png",
+	FormatJPEG: "image/jpeg",
+}
+
+// ContentType returns the Content-Type header value of the format.
+func (f Format) ContentType() string {
+	return formatContentTypes[f]
+}
+
+var extensionFormats = map[string]Format{
+	".txt":  FormatText,
+	".html": FormatHTML,
+	".htm":  FormatHTML,
+	".json": FormatJSON,
+	".xml":  FormatXML,
+	".rss":  FormatXML,
+	".atom": FormatXML,
+	".png":  FormatPNG,
+	".jpg":  FormatJPEG,
+	".jpeg": FormatJPEG,
+}
+
+var mediaTypeFormats = map[string]Format{
+	"text/plain":            FormatText,
+	"text/html":             FormatHTML,
+	"application/xhtml+xml": FormatHTML,
+	"application/json":      FormatJSON,
+	"text/xml":              FormatXML,
+	"application/xml":       FormatXML,
+	"image/png":             FormatPNG,
+	"image/jpeg":            FormatJPEG,
+	"image/*":               FormatPNG,
+}
+
+// Negotiate returns the format a request expects. The path's extension takes precedence over the Accept header,
+// since crawlers often send a generic one. Requests for API endpoints get JSON, and anything else text.
+func Negotiate(r *http.Request) Format {
+	if format, ok := extensionFormats[strings.ToLower(path.Ext(r.URL.Path))]; ok {
+		return format
+	}
+	if format, ok := acceptedFormat(r.Header.Get("Accept")); ok {
+		return format
+	}
+	if strings.Contains(r.URL.Path, "/api/") {
+		return FormatJSON
+	}
+	return FormatText
+}
+
+// acceptedFormat returns the format of the media type with the highest quality in an Accept header.
+// Media types of other formats and full wildcards are ignored.
+func acceptedFormat(accept string) (Format, bool) {
+	var (
+		best  Format
+		bestQ float64
+	)
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+
+		format, ok := mediaTypeFormats[mediaType]
+		switch {
+		case ok:
+		case strings.HasSuffix(mediaType, "+json"):
+			format = FormatJSON
+		case strings.HasSuffix(mediaType, "+xml"):
+			format = FormatXML
+		default:
+			continue
+		}
+		if q > bestQ {
+			best, bestQ = format, q
+		}
+	}
+	return best, bestQ > 0
+}
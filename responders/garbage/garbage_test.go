@@ -0,0 +1,345 @@
+package garbage
+
+import (
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+)
+
+const corpus = `The quick brown fox jumps over the lazy dog. The lazy dog sleeps in the warm sun.
+A quick brown cat watches the dog from the fence. The warm sun sets over the quiet hills.
+Every evening the fox returns to the hills and the cat returns to the fence.`
+
+func TestModel(t *testing.T) {
+	model := NewModel(2)
+	require.True(t, model.Empty())
+	require.Empty(t, model.Generate(rand.New(rand.NewPCG(1, 2)), 50))
+
+	model.Train(corpus)
+	require.False(t, model.Empty())
+	require.Equal(t, len(corpus), model.Size())
+
+	t.Run("Length and vocabulary", func(t *testing.T) {
+		text := model.Generate(rand.New(rand.NewPCG(1, 2)), 200)
+		words := strings.Fields(text)
+		require.Len(t, words, 200)
+
+		vocabulary := make(map[string]bool)
+		for _, word := range strings.Fields(corpus) {
+			vocabulary[word] = true
+		}
+		for _, word := range words {
+			require.True(t, vocabulary[word], "generated word %q is not in the corpus", word)
+		}
+	})
+
+	t.Run("Transitions follow the corpus", func(t *testing.T) {
+		bigrams := make(map[string]bool)
+		corpusWords := strings.Fields(corpus)
+		for i := 0; i+1 < len(corpusWords); i++ {
+			bigrams[corpusWords[i]+" "+corpusWords[i+1]] = true
+		}
+
+		words := strings.Fields(model.Generate(rand.New(rand.NewPCG(3, 4)), 200))
+		for i := 0; i+1 < len(words); i++ {
+			if endsSentence(words[i]) {
+				// A new sentence may start anywhere
+				continue
+			}
+			require.True(t, bigrams[words[i]+" "+words[i+1]], "%q %q never follow each other", words[i], words[i+1])
+		}
+	})
+
+	t.Run("Deterministic", func(t *testing.T) {
+		first := model.Generate(rand.New(rand.NewPCG(5, 6)), 100)
+		require.Equal(t, first, model.Generate(rand.New(rand.NewPCG(5, 6)), 100))
+		require.NotEqual(t, first, model.Generate(rand.New(rand.NewPCG(7, 8)), 100))
+	})
+
+	t.Run("Paragraphs", func(t *testing.T) {
+		text := model.Generate(rand.New(rand.NewPCG(9, 10)), 300)
+		require.Contains(t, text, ".\n\n")
+	})
+}
+
+func TestTrainFiles(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("Alpha beta gamma delta."), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.html"), []byte(
+		`<html><head><title>Ignored title</title><script>var ignored = 1;</script></head>
+		<body><h1>Epsilon zeta</h1><p>Eta theta iota.</p></body></html>`), 0o600))
+
+	model := NewModel(1)
+	require.NoError(t, model.TrainFiles([]string{filepath.Join(dir, "*")}))
+
+	text := model.Generate(rand.New(rand.NewPCG(1, 2)), 500)
+	require.Contains(t, text, "Alpha")
+	require.Contains(t, text, "Epsilon")
+	require.NotContains(t, text, "ignored")
+	require.NotContains(t, text, "title")
+
+	require.ErrorContains(t, model.TrainFiles([]string{filepath.Join(dir, "*.md")}), "matches no files")
+}
+
+func TestExtractText(t *testing.T) {
+	text := ExtractText(strings.NewReader(
+		`<html><head><style>p { color: red }</style></head><body><p>Hello <b>world</b></p><noscript>x</noscript></body></html>`))
+	require.Equal(t, []string{"Hello", "world"}, strings.Fields(text))
+}
+
+func TestCaptureWriter(t *testing.T) {
+	t.Run("HTML response", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		capture := NewCaptureWriter(rec, 1024)
+		capture.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, err := capture.Write([]byte("<p>Captured text</p>"))
+		require.NoError(t, err)
+
+		require.Equal(t, "<p>Captured text</p>", rec.Body.String())
+		require.Equal(t, []string{"Captured", "text"}, strings.Fields(capture.Text()))
+	})
+
+	t.Run("Limit", func(t *testing.T) {
+		capture := NewCaptureWriter(httptest.NewRecorder(), 5)
+		capture.Header().Set("Content-Type", "text/plain")
+		_, err := capture.Write([]byte("abcdefgh"))
+		require.NoError(t, err)
+		require.Equal(t, "abcde", capture.Text())
+	})
+
+	t.Run("Skipped responses", func(t *testing.T) {
+		tests := []struct {
+			name            string
+			contentType     string
+			contentEncoding string
+			header          http.Header
+			code            int
+		}{
+			{name: "binary", contentType: "image/png", code: http.StatusOK},
+			{name: "compressed", contentType: "text/html", contentEncoding: "gzip", code: http.StatusOK},
+			{name: "error", contentType: "text/html", code: http.StatusNotFound},
+			{name: "cookie", contentType: "text/html", header: http.Header{"Set-Cookie": {"session=secret"}},
+				code: http.StatusOK},
+			{name: "private", contentType: "text/html", header: http.Header{"Cache-Control": {"max-age=60, Private"}},
+				code: http.StatusOK},
+			{name: "no-store", contentType: "text/plain", header: http.Header{"Cache-Control": {"no-store"}},
+				code: http.StatusOK},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				capture := NewCaptureWriter(httptest.NewRecorder(), 1024)
+				capture.Header().Set("Content-Type", tt.contentType)
+				if tt.contentEncoding != "" {
+					capture.Header().Set("Content-Encoding", tt.contentEncoding)
+				}
+				for key, values := range tt.header {
+					capture.Header()[key] = values
+				}
+				capture.WriteHeader(tt.code)
+				_, err := capture.Write([]byte("Some text"))
+				require.NoError(t, err)
+				require.Empty(t, capture.Text())
+			})
+		}
+	})
+}
+
+func TestRequestRand(t *testing.T) {
+	first := RequestRand(httptest.NewRequest(http.MethodGet, "http://example.com/a?page=1", nil)).Uint64()
+	require.Equal(t, first, RequestRand(httptest.NewRequest(http.MethodGet, "http://example.com/a?page=1", nil)).Uint64())
+	require.NotEqual(t, first, RequestRand(httptest.NewRequest(http.MethodGet, "http://example.com/a?page=2", nil)).Uint64())
+	require.NotEqual(t, first, RequestRand(httptest.NewRequest(http.MethodGet, "http://example.org/a?page=1", nil)).Uint64())
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		path   string
+		accept string
+		want   Format
+	}{
+		{"/", "", FormatText},
+		{"/", "*/*", FormatText},
+		{"/data.json", "text/html", FormatJSON},
+		{"/logo.PNG", "", FormatPNG},
+		{"/photo.jpeg", "", FormatJPEG},
+		{"/feed.rss", "", FormatXML},
+		{"/", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", FormatHTML},
+		{"/", "application/json, text/plain;q=0.5", FormatJSON},
+		{"/", "application/ld+json", FormatJSON},
+		{"/", "application/atom+xml", FormatXML},
+		{"/", "image/avif,image/webp,image/*,*/*;q=0.8", FormatPNG},
+		{"/api/v1/users", "*/*", FormatJSON},
+		{"/api/v1/users", "text/html", FormatHTML},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.Header.Set("Accept", tt.accept)
+		require.Equal(t, tt.want, Negotiate(req), "%s with Accept %q", tt.path, tt.accept)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	phrase := func(_ *rand.Rand, words int) string {
+		return strings.TrimSpace(strings.Repeat("word ", words))
+	}
+
+	t.Run("Generated values match the schema", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "schema.json")
+		require.NoError(t, os.WriteFile(file, []byte(`{
+			"type": "object",
+			"properties": {
+				"id": {"type": "integer", "minimum": 10, "maximum": 20},
+				"score": {"type": ["number", "null"], "minimum": 0, "maximum": 1},
+				"status": {"enum": ["active", "retired"]},
+				"email": {"type": "string", "format": "email"},
+				"name": {"type": "string", "maxLength": 6},
+				"tags": {"type": "array", "items": {"type": "string"}, "minItems": 2, "maxItems": 2},
+				"nested": {"properties": {"ok": {"type": "boolean"}}}
+			}
+		}`), 0o600))
+		schema, err := LoadSchema(file)
+		require.NoError(t, err)
+
+		for seed := uint64(0); seed < 20; seed++ {
+			value := schema.Generate(rand.New(rand.NewPCG(seed, seed)), phrase).(map[string]any)
+			require.GreaterOrEqual(t, value["id"], 10)
+			require.LessOrEqual(t, value["id"], 20)
+			require.IsType(t, float64(0), value["score"])
+			require.Contains(t, []any{"active", "retired"}, value["status"])
+			require.True(t, strings.HasSuffix(value["email"].(string), "@example.com"))
+			require.LessOrEqual(t, len(value["name"].(string)), 6)
+			require.Len(t, value["tags"], 2)
+			require.IsType(t, true, value["nested"].(map[string]any)["ok"])
+		}
+	})
+
+	t.Run("Deterministic", func(t *testing.T) {
+		a := (*Schema)(nil).Generate(rand.New(rand.NewPCG(1, 2)), phrase)
+		b := (*Schema)(nil).Generate(rand.New(rand.NewPCG(1, 2)), phrase)
+		require.Equal(t, a, b)
+		require.NotEmpty(t, a.(map[string]any)["items"])
+	})
+
+	t.Run("Invalid schema", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "schema.json")
+		require.NoError(t, os.WriteFile(file, []byte(`{"type": 5}`), 0o600))
+		_, err := LoadSchema(file)
+		require.ErrorContains(t, err, "schema type must be")
+	})
+
+	t.Run("Generated values stay within bounds", func(t *testing.T) {
+		within := func(low, high float64) func(any) bool {
+			return func(value any) bool {
+				n, ok := value.(int)
+				if !ok {
+					return value.(float64) >= low && value.(float64) <= high
+				}
+				return float64(n) >= low && float64(n) <= high
+			}
+		}
+		length := func(low, high int) func(any) bool {
+			return func(value any) bool {
+				n := utf8.RuneCountInString(value.(string))
+				return n >= low && n <= high
+			}
+		}
+
+		for schema, ok := range map[string]func(any) bool{
+			// Cutting "word word ..." at 5 leaves a trailing space, which can't be trimmed
+			`{"type": "string", "minLength": 5, "maxLength": 5}`:        length(5, 5),
+			`{"type": "string", "minLength": 9, "maxLength": 10}`:       length(9, 10),
+			`{"type": "string", "maxLength": 3}`:                        length(0, 3),
+			`{"type": "string", "format": "uuid", "maxLength": 8}`:      length(8, 8),
+			`{"type": "string", "format": "email", "minLength": 40}`:    length(40, 1000),
+			`{"type": "integer", "minimum": 1.5, "maximum": 3.5}`:       within(2, 3),
+			`{"type": "integer", "minimum": -2.5, "maximum": -0.5}`:     within(-2, -1),
+			`{"type": "integer", "minimum": 0.9999, "maximum": 1.0001}`: within(1, 1),
+			`{"type": "integer", "maximum": -5}`:                        within(-1005, -5),
+			`{"type": "number", "minimum": 5000}`:                       within(5000, 6000),
+			`{"type": "number", "minimum": 0.25, "maximum": 0.5}`:       within(0.25, 0.5),
+			`{"type": "integer", "minimum": 1000.5}`:                    within(1001, 2000),
+		} {
+			file := filepath.Join(t.TempDir(), "schema.json")
+			require.NoError(t, os.WriteFile(file, []byte(schema), 0o600))
+			loaded, err := LoadSchema(file)
+			require.NoError(t, err, schema)
+
+			for seed := uint64(0); seed < 50; seed++ {
+				value := loaded.Generate(rand.New(rand.NewPCG(seed, seed)), phrase)
+				require.True(t, ok(value), "%s generated %#v", schema, value)
+			}
+		}
+	})
+
+	t.Run("Unbounded schemas", func(t *testing.T) {
+		load := func(schema string) error {
+			file := filepath.Join(t.TempDir(), "schema.json")
+			require.NoError(t, os.WriteFile(file, []byte(schema), 0o600))
+			_, err := LoadSchema(file)
+			return err
+		}
+
+		for schema, msg := range map[string]string{
+			`{"type": "array", "minItems": -1}`:                        "#: minItems must be between 0 and 10000",
+			`{"type": "string", "maxLength": -1}`:                      "#: maxLength must be between 0 and 10000",
+			`{"type": "string", "minLength": 1000000000}`:              "#: minLength must be between 0 and 10000",
+			`{"type": "array", "minItems": 3, "maxItems": 2}`:          "#: minItems is greater than maxItems",
+			`{"type": "integer", "minimum": -1e300, "maximum": 1e300}`: "must be within",
+			`{"type": "number", "minimum": 2, "maximum": 1}`:           "#: minimum is greater than maximum",
+			`{"type": "integer", "minimum": 1.2, "maximum": 1.8}`:      "#: no integer is between minimum and maximum",
+			`{"properties": {"a": {"items": {"maxItems": -5}}}}`:       "#/properties/a/items: maxItems must be",
+			`{"oneOf": [{"type": "string"}, {"minLength": -1}]}`:       "#/oneOf/1: minLength must be",
+		} {
+			require.ErrorContains(t, load(schema), msg, schema)
+		}
+
+		// Nested arrays multiply their sizes
+		require.ErrorContains(t, load(`{"minItems": 1000, "items": {"minItems": 1000, "items": {"minLength": 10}}}`),
+			"could exceed")
+
+		// Large but bounded schemas are fine
+		file := filepath.Join(t.TempDir(), "schema.json")
+		require.NoError(t, os.WriteFile(file, []byte(`{
+			"type": "array",
+			"minItems": 100,
+			"maxItems": 100,
+			"items": {"type": "integer", "minimum": -9007199254740992, "maximum": 9007199254740992}
+		}`), 0o600))
+		schema, err := LoadSchema(file)
+		require.NoError(t, err)
+		require.Len(t, schema.Generate(rand.New(rand.NewPCG(1, 2)), phrase), 100)
+	})
+}
+
+func TestWriteImage(t *testing.T) {
+	for _, format := range []Format{FormatPNG, FormatJPEG} {
+		t.Run(string(format), func(t *testing.T) {
+			var buf strings.Builder
+			require.NoError(t, WriteImage(&buf, rand.New(rand.NewPCG(1, 2)), format))
+
+			config, decoded, err := image.DecodeConfig(strings.NewReader(buf.String()))
+			require.NoError(t, err)
+			require.Equal(t, string(format), decoded)
+			require.Contains(t, imageWidths, config.Width)
+
+			// Images are encoded once, and reused
+			seen := map[string]bool{}
+			for seed := uint64(0); seed < 100; seed++ {
+				buf.Reset()
+				require.NoError(t, WriteImage(&buf, rand.New(rand.NewPCG(seed, seed)), format))
+				seen[buf.String()] = true
+			}
+			require.LessOrEqual(t, len(seen), imageVariants)
+		})
+	}
+}
@@ -0,0 +1,99 @@
+//nolint:gosec
+package garbage
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math/rand/v2"
+	"sync"
+)
+
+var (
+	// imageWidths are common widths of images on the web
+	imageWidths = []int{320, 480, 640, 800, 1024}
+	// imageAspects are common aspect ratios as height/width
+	imageAspects = []float64{3.0 / 4, 9.0 / 16, 1, 2.0 / 3}
+)
+
+// imageVariants is the number of images of each format. They are generated once and reused, so that serving an
+// image to a bot costs no more than writing its bytes.
+const imageVariants = 8
+
+// encodedImage is an image variant, encoded on first use.
+type encodedImage struct {
+	once sync.Once
+	data []byte
+	err  error
+}
+
+// images are the image variants by format.
+var images = map[Format]*[imageVariants]encodedImage{FormatPNG: {}, FormatJPEG: {}}
+
+// WriteImage writes one of the noise images in the PNG or JPEG format.
+func WriteImage(w io.Writer, rng *rand.Rand, format Format) error {
+	if format != FormatJPEG {
+		format = FormatPNG
+	}
+	variant := rng.IntN(imageVariants)
+	encoded := &images[format][variant]
+	encoded.once.Do(func() {
+		var buf bytes.Buffer
+		encoded.err = encodeImage(&buf, rand.New(rand.NewPCG(uint64(variant), 0)), format)
+		encoded.data = buf.Bytes()
+	})
+	if encoded.err != nil {
+		return encoded.err
+	}
+	_, err := w.Write(encoded.data)
+	return err
+}
+
+// encodeImage encodes a noise image in the PNG or JPEG format. Its size is picked from common image sizes, and it is
+// smooth noise, interpolated between random colors on a coarse grid, so it compresses like a photo would.
+func encodeImage(w io.Writer, rng *rand.Rand, format Format) error {
+	width := imageWidths[rng.IntN(len(imageWidths))]
+	height := int(float64(width) * imageAspects[rng.IntN(len(imageAspects))])
+	img := noiseImage(rng, width, height, 16+rng.IntN(48))
+
+	if format == FormatJPEG {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: 75 + rng.IntN(20)})
+	}
+	encoder := png.Encoder{CompressionLevel: png.BestSpeed}
+	return encoder.Encode(w, img)
+}
+
+// noiseImage returns an image bilinearly interpolated between random colors on a grid with the given cell size.
+func noiseImage(rng *rand.Rand, width, height, cell int) *image.RGBA {
+	cols, rows := width/cell+2, height/cell+2
+	grid := make([]color.RGBA, cols*rows)
+	for i := range grid {
+		grid[i] = color.RGBA{R: uint8(rng.IntN(256)), G: uint8(rng.IntN(256)), B: uint8(rng.IntN(256)), A: 255}
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		row, fy := y/cell, float64(y%cell)/float64(cell)
+		for x := 0; x < width; x++ {
+			col, fx := x/cell, float64(x%cell)/float64(cell)
+			c00, c10 := grid[row*cols+col], grid[row*cols+col+1]
+			c01, c11 := grid[(row+1)*cols+col], grid[(row+1)*cols+col+1]
+
+			i := img.PixOffset(x, y)
+			img.Pix[i] = lerp2(c00.R, c10.R, c01.R, c11.R, fx, fy)
+			img.Pix[i+1] = lerp2(c00.G, c10.G, c01.G, c11.G, fx, fy)
+			img.Pix[i+2] = lerp2(c00.B, c10.B, c01.B, c11.B, fx, fy)
+			img.Pix[i+3] = 255
+		}
+	}
+	return img
+}
+
+func lerp2(c00, c10, c01, c11 uint8, fx, fy float64) uint8 {
+	top := float64(c00) + (float64(c10)-float64(c00))*fx
+	bottom := float64(c01) + (float64(c11)-float64(c01))*fx
+	return uint8(top + (bottom-top)*fy)
+}
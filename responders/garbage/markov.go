@@ -0,0 +1,161 @@
+//nolint:gosec
+package garbage
+
+import (
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Model is a word-level Markov chain. It is safe for concurrent use.
+type Model struct {
+	order int
+	// chain maps a prefix of order words, joined by spaces, to the words that followed it
+	chain map[string][]string
+	// starts are the prefixes which begin a sentence
+	starts []string
+	size   int
+	// frozen models aren't trained anymore, so that they keep generating the same text
+	frozen bool
+	mu     sync.RWMutex
+}
+
+// NewModel returns an empty model whose next word depends on the previous order words.
+func NewModel(order int) *Model {
+	return &Model{
+		order: max(order, 1),
+		chain: make(map[string][]string),
+	}
+}
+
+// Train adds text to the model, unless it is frozen.
+func (m *Model) Train(text string) {
+	words := strings.Fields(text)
+	if len(words) <= m.order {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.frozen {
+		return
+	}
+	m.size += len(text)
+	for i := 0; i+m.order < len(words); i++ {
+		key := strings.Join(words[i:i+m.order], " ")
+		m.chain[key] = append(m.chain[key], words[i+m.order])
+		if (i == 0 || endsSentence(words[i-1])) && startsSentence(words[i]) {
+			m.starts = append(m.starts, key)
+		}
+	}
+}
+
+// Freeze stops training the model.
+func (m *Model) Freeze() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.frozen = true
+}
+
+// Clone returns an unfrozen copy of the model, which can be trained without changing the model.
+func (m *Model) Clone() *Model {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	clone := &Model{
+		order:  m.order,
+		chain:  make(map[string][]string, len(m.chain)),
+		starts: slices.Clone(m.starts),
+		size:   m.size,
+	}
+	for key, words := range m.chain {
+		clone.chain[key] = slices.Clone(words)
+	}
+	return clone
+}
+
+// Size returns the number of bytes of text the model was trained on.
+func (m *Model) Size() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.size
+}
+
+// Empty reports whether the model can't generate text yet.
+func (m *Model) Empty() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.starts) == 0
+}
+
+// Generate returns prose of the given number of words, split into paragraphs. The same rng state and model
+// always produce the same text.
+func (m *Model) Generate(rng *rand.Rand, words int) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.starts) == 0 || words <= 0 {
+		return ""
+	}
+
+	out := make([]string, 0, words+m.order)
+	// paragraphEnds holds the indexes of the words which end a paragraph
+	paragraphEnds := make(map[int]bool)
+	sentences, paragraphSentences := 0, 3+rng.IntN(4)
+	var prefix []string
+	for len(out) < words {
+		if prefix == nil {
+			prefix = strings.Fields(m.starts[rng.IntN(len(m.starts))])
+			out = append(out, prefix...)
+			continue
+		}
+
+		next := m.chain[strings.Join(prefix, " ")]
+		if len(next) == 0 {
+			// Dead end, start a new sentence
+			prefix = nil
+			continue
+		}
+		word := next[rng.IntN(len(next))]
+		out = append(out, word)
+		prefix = append(prefix[1:], word)
+
+		if endsSentence(word) {
+			prefix = nil
+			sentences++
+			if sentences == paragraphSentences {
+				paragraphEnds[len(out)-1] = true
+				sentences, paragraphSentences = 0, 3+rng.IntN(4)
+			}
+		}
+	}
+
+	var sb strings.Builder
+	for i, word := range out[:words] {
+		if i > 0 {
+			if paragraphEnds[i-1] {
+				sb.WriteString("\n\n")
+			} else {
+				sb.WriteByte(' ')
+			}
+		}
+		sb.WriteString(word)
+	}
+	return sb.String()
+}
+
+// endsSentence reports whether word ends a sentence.
+func endsSentence(word string) bool {
+	last, _ := utf8.DecodeLastRuneInString(word)
+	return last == '.' || last == '!' || last == '?'
+}
+
+// startsSentence reports whether word can start a sentence.
+func startsSentence(word string) bool {
+	first, _ := utf8.DecodeRuneInString(word)
+	return unicode.IsUpper(first)
+}
@@ -0,0 +1,57 @@
+//nolint:gosec
+package garbage
+
+import (
+	"math/rand/v2"
+	"strings"
+)
+
+var (
+	// A mix of characters, symbols, and numbers to create irregularity
+	characters = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!@#$%^&*()_+-=[]{};':\",./<>?\\|`~")
+	// A list of nonsensical "words" to add unpredictability
+	nonsenseWords = []string{"florb", "zaxor", "quint", "blarg", "wibble", "fizzle", "gronk", "snark", "ploosh", "dribble"}
+)
+
+// Nonsense generates a block of text that is difficult for AI to train on
+func Nonsense(rng *rand.Rand, lines int) string {
+	var sb strings.Builder
+
+	for i := 0; i < lines; i++ {
+		// Randomly decide whether to generate a nonsense word or random characters
+		if rng.IntN(2) == 0 {
+			sb.WriteString(nonsenseWord(rng))
+		} else {
+			sb.WriteString(randomCharacters(rng, rng.IntN(50)+10)) // Random length between 10 and 60
+		}
+
+		// Add random punctuation or symbols
+		sb.WriteRune(characters[rng.IntN(len(characters))])
+		sb.WriteString("\n") // Newline after each "line"
+	}
+
+	return sb.String()
+}
+
+// nonsenseWord generates a random nonsense word
+func nonsenseWord(rng *rand.Rand) string {
+	return nonsenseWords[rng.IntN(len(nonsenseWords))]
+}
+
+// randomCharacters generates a string of random characters and symbols
+func randomCharacters(rng *rand.Rand, length int) string {
+	var sb strings.Builder
+	for i := 0; i < length; i++ {
+		sb.WriteRune(characters[rng.IntN(len(characters))])
+	}
+	return sb.String()
+}
+
+// NonsenseWords returns n random nonsense words separated by spaces.
+func NonsenseWords(rng *rand.Rand, n int) string {
+	words := make([]string, n)
+	for i := range words {
+		words[i] = nonsenseWord(rng)
+	}
+	return strings.Join(words, " ")
+}
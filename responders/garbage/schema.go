@@ -0,0 +1,364 @@
+//nolint:gosec
+package garbage
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PhraseFunc returns a phrase of the given number of words.
+type PhraseFunc func(rng *rand.Rand, words int) string
+
+// Schema is the subset of JSON Schema used to shape generated JSON. Keywords it doesn't know are ignored.
+type Schema struct {
+	Type       SchemaType         `json:"type,omitempty"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+	Enum       []any              `json:"enum,omitempty"`
+	Const      any                `json:"const,omitempty"`
+	OneOf      []*Schema          `json:"oneOf,omitempty"`
+	AnyOf      []*Schema          `json:"anyOf,omitempty"`
+	Format     string             `json:"format,omitempty"`
+	MinLength  *int               `json:"minLength,omitempty"`
+	MaxLength  *int               `json:"maxLength,omitempty"`
+	Minimum    *float64           `json:"minimum,omitempty"`
+	Maximum    *float64           `json:"maximum,omitempty"`
+	MinItems   *int               `json:"minItems,omitempty"`
+	MaxItems   *int               `json:"maxItems,omitempty"`
+}
+
+// SchemaType is the type keyword of a schema, which may be a single type or a list of them.
+type SchemaType []string
+
+// UnmarshalJSON accepts both a single type and a list of them.
+func (t *SchemaType) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = SchemaType{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("schema type must be a string or a list of strings")
+	}
+	*t = list
+	return nil
+}
+
+// LoadSchema reads a JSON Schema from a file.
+func LoadSchema(file string) (*Schema, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var schema Schema
+	if err := json.Unmarshal(content, &schema); err != nil {
+		return nil, fmt.Errorf("parsing JSON schema %s: %v", file, err)
+	}
+	if err := schema.validate("#"); err != nil {
+		return nil, fmt.Errorf("invalid JSON schema %s: %v", file, err)
+	}
+	if schema.size() > maxSchemaSize {
+		return nil, fmt.Errorf("invalid JSON schema %s: generated values could exceed %d bytes", file, maxSchemaSize)
+	}
+	return &schema, nil
+}
+
+const (
+	// maxSchemaLength bounds minLength, maxLength, minItems and maxItems.
+	maxSchemaLength = 10000
+	// maxSchemaBound bounds minimum and maximum, so that integers between them are exact and their span fits an int.
+	maxSchemaBound = 1 << 53
+	// maxSchemaSize bounds the approximate size in bytes of generated values, which are generated on every request.
+	maxSchemaSize = 1 << 20
+)
+
+// validate ensures the sizes and ranges of the schema at path and its subschemas are bounded, so that generating
+// values neither panics nor allocates without bound.
+func (s *Schema) validate(path string) error {
+	if err := validateSizes(path, "minLength", s.MinLength, "maxLength", s.MaxLength); err != nil {
+		return err
+	}
+	if err := validateSizes(path, "minItems", s.MinItems, "maxItems", s.MaxItems); err != nil {
+		return err
+	}
+	for keyword, bound := range map[string]*float64{"minimum": s.Minimum, "maximum": s.Maximum} {
+		if bound != nil && math.Abs(*bound) > maxSchemaBound {
+			return fmt.Errorf("%s: %s must be within ±%d", path, keyword, int64(maxSchemaBound))
+		}
+	}
+	if s.Minimum != nil && s.Maximum != nil && *s.Minimum > *s.Maximum {
+		return fmt.Errorf("%s: minimum is greater than maximum", path)
+	}
+	if s.schemaType() == "integer" && s.Minimum != nil && s.Maximum != nil &&
+		math.Ceil(*s.Minimum) > math.Floor(*s.Maximum) {
+		return fmt.Errorf("%s: no integer is between minimum and maximum", path)
+	}
+
+	for name, property := range s.Properties {
+		if err := property.validate(path + "/properties/" + name); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		if err := s.Items.validate(path + "/items"); err != nil {
+			return err
+		}
+	}
+	for keyword, schemas := range map[string][]*Schema{"oneOf": s.OneOf, "anyOf": s.AnyOf} {
+		for i, schema := range schemas {
+			if err := schema.validate(fmt.Sprintf("%s/%s/%d", path, keyword, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateSizes ensures a minimum and maximum size of a schema at path are within 0 and maxSchemaLength, and ordered.
+func validateSizes(path, minKeyword string, minimum *int, maxKeyword string, maximum *int) error {
+	for keyword, size := range map[string]*int{minKeyword: minimum, maxKeyword: maximum} {
+		if size != nil && (*size < 0 || *size > maxSchemaLength) {
+			return fmt.Errorf("%s: %s must be between 0 and %d", path, keyword, maxSchemaLength)
+		}
+	}
+	if minimum != nil && maximum != nil && *minimum > *maximum {
+		return fmt.Errorf("%s: %s is greater than %s", path, minKeyword, maxKeyword)
+	}
+	return nil
+}
+
+// size returns the approximate size in bytes of the largest value generated from a valid schema, or a size beyond
+// maxSchemaSize.
+func (s *Schema) size() int {
+	switch {
+	case s.Const != nil:
+		return jsonSize(s.Const)
+	case len(s.Enum) > 0:
+		size := 0
+		for _, value := range s.Enum {
+			size = max(size, jsonSize(value))
+		}
+		return size
+	case len(s.OneOf) > 0 || len(s.AnyOf) > 0:
+		size := 0
+		for _, schema := range append(slices.Clip(s.OneOf), s.AnyOf...) {
+			size = max(size, schema.size())
+		}
+		return size
+	}
+
+	switch s.schemaType() {
+	case "object":
+		size := 2
+		for name, property := range s.Properties {
+			size = min(size+len(name)+4+property.size(), maxSchemaSize+1)
+		}
+		return size
+	case "array":
+		items := s.Items
+		if items == nil {
+			items = &Schema{Type: SchemaType{"string"}}
+		}
+		count := max(intOr(s.MinItems, 1), intOr(s.MaxItems, 5))
+		return min(count*(items.size()+1)+2, maxSchemaSize+1)
+	case "integer", "number", "boolean", "null":
+		return 24
+	default:
+		// Phrases are appended until strings are long enough
+		size := intOr(s.MinLength, 0) + 128
+		if s.MaxLength != nil {
+			size = min(size, *s.MaxLength+2)
+		}
+		return size * utf8.UTFMax
+	}
+}
+
+// jsonSize returns the size of a value encoded as JSON.
+func jsonSize(value any) int {
+	encoded, _ := json.Marshal(value)
+	return len(encoded)
+}
+
+// defaultSchema shapes JSON when no schema is configured, like a typical API listing.
+var defaultSchema = &Schema{
+	Type: SchemaType{"object"},
+	Properties: map[string]*Schema{
+		"items": {
+			Type:     SchemaType{"array"},
+			MinItems: intPtr(3),
+			MaxItems: intPtr(10),
+			Items: &Schema{
+				Type: SchemaType{"object"},
+				Properties: map[string]*Schema{
+					"id":      {Type: SchemaType{"integer"}, Minimum: floatPtr(1), Maximum: floatPtr(100000)},
+					"title":   {Type: SchemaType{"string"}},
+					"summary": {Type: SchemaType{"string"}, MinLength: intPtr(80)},
+					"author":  {Type: SchemaType{"string"}, MaxLength: intPtr(24)},
+					"created": {Type: SchemaType{"string"}, Format: "date-time"},
+					"url":     {Type: SchemaType{"string"}, Format: "uri"},
+				},
+			},
+		},
+		"page":  {Type: SchemaType{"integer"}, Minimum: floatPtr(1), Maximum: floatPtr(50)},
+		"total": {Type: SchemaType{"integer"}, Minimum: floatPtr(50), Maximum: floatPtr(5000)},
+	},
+}
+
+// Generate returns a value valid against the schema, with strings taken from phrase. A nil schema generates a
+// typical API listing.
+func (s *Schema) Generate(rng *rand.Rand, phrase PhraseFunc) any {
+	if s == nil {
+		s = defaultSchema
+	}
+	return s.generate(rng, phrase)
+}
+
+func (s *Schema) generate(rng *rand.Rand, phrase PhraseFunc) any {
+	switch {
+	case s.Const != nil:
+		return s.Const
+	case len(s.Enum) > 0:
+		return s.Enum[rng.IntN(len(s.Enum))]
+	case len(s.OneOf) > 0:
+		return s.OneOf[rng.IntN(len(s.OneOf))].generate(rng, phrase)
+	case len(s.AnyOf) > 0:
+		return s.AnyOf[rng.IntN(len(s.AnyOf))].generate(rng, phrase)
+	}
+
+	switch s.schemaType() {
+	case "object":
+		// Properties are generated in a fixed order so the output only depends on rng
+		object := make(map[string]any, len(s.Properties))
+		names := make([]string, 0, len(s.Properties))
+		for name := range s.Properties {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			object[name] = s.Properties[name].generate(rng, phrase)
+		}
+		return object
+	case "array":
+		minItems, maxItems := intOr(s.MinItems, 1), intOr(s.MaxItems, 5)
+		array := make([]any, minItems+rng.IntN(max(maxItems-minItems, 0)+1))
+		items := s.Items
+		if items == nil {
+			items = &Schema{Type: SchemaType{"string"}}
+		}
+		for i := range array {
+			array[i] = items.generate(rng, phrase)
+		}
+		return array
+	case "integer":
+		// Fractional bounds are rounded inwards, so values stay within them
+		low, high := s.bounds()
+		first, last := int(math.Ceil(low)), int(math.Floor(high))
+		return first + rng.IntN(max(last-first, 0)+1)
+	case "number":
+		low, high := s.bounds()
+		return low + rng.Float64()*(high-low)
+	case "boolean":
+		return rng.IntN(2) == 0
+	case "null":
+		return nil
+	default:
+		return s.generateString(rng, phrase)
+	}
+}
+
+// schemaType returns the first non-null type of the schema, or the one implied by its keywords.
+func (s *Schema) schemaType() string {
+	for _, t := range s.Type {
+		if t != "null" || len(s.Type) == 1 {
+			return t
+		}
+	}
+	switch {
+	case s.Properties != nil:
+		return "object"
+	case s.Items != nil:
+		return "array"
+	default:
+		return "string"
+	}
+}
+
+// bounds returns the minimum and maximum of a numeric schema. Without both, values are between 0 and 1000, or within
+// 1000 of the only bound beyond them.
+func (s *Schema) bounds() (float64, float64) {
+	low, high := floatOr(s.Minimum, 0), floatOr(s.Maximum, 1000)
+	if s.Maximum == nil && high < low {
+		high = low + 1000
+	}
+	if s.Minimum == nil && low > high {
+		low = high - 1000
+	}
+	return low, high
+}
+
+func (s *Schema) generateString(rng *rand.Rand, phrase PhraseFunc) string {
+	var value string
+	switch s.Format {
+	case "date-time":
+		value = randomTime(rng).Format(time.RFC3339)
+	case "date":
+		value = randomTime(rng).Format(time.DateOnly)
+	case "email":
+		value = strings.ReplaceAll(phrase(rng, 1), " ", "") + "@example.com"
+	case "uri", "url":
+		value = "https://example.com/" + strings.ReplaceAll(strings.ToLower(phrase(rng, 3)), " ", "-")
+	case "uuid":
+		value = fmt.Sprintf("%08x-%04x-4%03x-%04x-%012x", rng.Uint32(), rng.IntN(1<<16), rng.IntN(1<<12),
+			0x8000|rng.IntN(1<<14), rng.Uint64()&(1<<48-1))
+	default:
+		value = phrase(rng, 2+rng.IntN(6))
+	}
+
+	// Lengths are in characters, as in JSON Schema
+	minLength := intOr(s.MinLength, 0)
+	for utf8.RuneCountInString(value) < minLength {
+		value += " " + phrase(rng, 8)
+	}
+	runes := []rune(value)
+	if s.MaxLength != nil && len(runes) > *s.MaxLength {
+		runes = runes[:*s.MaxLength]
+	}
+	// Trailing spaces left by cutting the value are trimmed, unless that makes it too short
+	for len(runes) > minLength && unicode.IsSpace(runes[len(runes)-1]) {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes)
+}
+
+// randomTime returns a time within about three years before 2025.
+func randomTime(rng *rand.Rand) time.Time {
+	base := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+	return base.Add(-time.Duration(rng.Int64N(int64(3 * 365 * 24 * time.Hour)))).Truncate(time.Second)
+}
+
+func intPtr(v int) *int { return &v }
+
+func floatPtr(v float64) *float64 { return &v }
+
+func intOr(v *int, fallback int) int {
+	if v == nil {
+		return fallback
+	}
+	return *v
+}
+
+func floatOr(v *float64, fallback float64) float64 {
+	if v == nil {
+		return fallback
+	}
+	return *v
+}
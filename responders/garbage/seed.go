@@ -0,0 +1,18 @@
+//nolint:gosec
+package garbage
+
+import (
+	"hash/fnv"
+	"math/rand/v2"
+	"net/http"
+)
+
+// RequestRand returns a random number generator seeded by the request's host and URI, so that the same URL always
+// produces the same garbage and recrawls see stable pages.
+func RequestRand(r *http.Request) *rand.Rand {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(r.Host))
+	_, _ = h.Write([]byte(r.URL.RequestURI()))
+	seed := h.Sum64()
+	return rand.New(rand.NewPCG(seed, seed^0x9e3779b97f4a7c15))
+}
@@ -0,0 +1,187 @@
+package responders
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
+)
+
+func serveGarbage(t *testing.T, g *GarbageResponder, url string) string {
+	rec := httptest.NewRecorder()
+	require.NoError(t, g.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil), nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	return rec.Body.String()
+}
+
+func TestGarbageResponder(t *testing.T) {
+	t.Run("Nonsense without a corpus", func(t *testing.T) {
+		g := &GarbageResponder{}
+		require.NoError(t, g.Provision(caddy.Context{}))
+
+		page := serveGarbage(t, g, "http://example.com/a")
+		require.Len(t, strings.Split(strings.TrimSpace(page), "\n"), garbageNonsenseLines)
+		require.Equal(t, page, serveGarbage(t, g, "http://example.com/a"))
+		require.NotEqual(t, page, serveGarbage(t, g, "http://example.com/b"))
+	})
+
+	t.Run("Prose from a corpus", func(t *testing.T) {
+		corpus := filepath.Join(t.TempDir(), "corpus.txt")
+		require.NoError(t, os.WriteFile(corpus, []byte(
+			"The river runs past the old mill. The old mill grinds the grain. "+
+				"The grain feeds the town. The town sleeps by the river."), 0o600))
+
+		g := &GarbageResponder{Config: &GarbageConfig{Corpus: []string{corpus}, Words: 40}}
+		require.NoError(t, g.Provision(caddy.Context{}))
+
+		page := serveGarbage(t, g, "http://example.com/a")
+		require.Len(t, strings.Fields(page), 40)
+		require.Contains(t, page, "The")
+		require.Equal(t, page, serveGarbage(t, g, "http://example.com/a"))
+	})
+
+	t.Run("Capturing upstream responses", func(t *testing.T) {
+		const text = "Welcome to the bakery. Fresh bread is baked every morning."
+		g := &GarbageResponder{Config: &GarbageConfig{CaptureUpstream: true, MaxCorpusSize: 100, Words: 20}}
+		require.NoError(t, g.Provision(caddy.Context{}))
+
+		// Captured text is only used once the corpus is complete, so pages don't change with every capture
+		nonsense := serveGarbage(t, g, "http://example.com/a")
+		captureText(t, g, httptest.NewRequest(http.MethodGet, "/", nil), text)
+		require.Equal(t, nonsense, serveGarbage(t, g, "http://example.com/a"))
+
+		captureText(t, g, httptest.NewRequest(http.MethodGet, "/", nil), text)
+		page := serveGarbage(t, g, "http://example.com/a")
+		require.Len(t, strings.Fields(page), 20)
+		for _, word := range strings.Fields(page) {
+			require.Contains(t, text, word)
+		}
+
+		// The complete corpus is frozen
+		rec := httptest.NewRecorder()
+		w, _ := g.CaptureUpstream(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		require.Same(t, rec, w)
+		require.Equal(t, page, serveGarbage(t, g, "http://example.com/a"))
+	})
+
+	t.Run("Capturing skips requests with credentials", func(t *testing.T) {
+		g := &GarbageResponder{Config: &GarbageConfig{CaptureUpstream: true}}
+		require.NoError(t, g.Provision(caddy.Context{}))
+
+		for header, value := range map[string]string{"Authorization": "Bearer secret", "Cookie": "session=secret"} {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(header, value)
+			rec := httptest.NewRecorder()
+			w, _ := g.CaptureUpstream(rec, req)
+			require.Same(t, rec, w, header)
+		}
+	})
+
+	t.Run("Capturing stops at the maximum corpus size", func(t *testing.T) {
+		corpus := filepath.Join(t.TempDir(), "corpus.txt")
+		require.NoError(t, os.WriteFile(corpus, []byte("Enough text to fill the corpus."), 0o600))
+		g := &GarbageResponder{Config: &GarbageConfig{Corpus: []string{corpus}, CaptureUpstream: true, MaxCorpusSize: 10}}
+		require.NoError(t, g.Provision(caddy.Context{}))
+
+		rec := httptest.NewRecorder()
+		w, _ := g.CaptureUpstream(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		require.Same(t, rec, w)
+	})
+
+	t.Run("Capturing disabled", func(t *testing.T) {
+		g := &GarbageResponder{}
+		require.NoError(t, g.Provision(caddy.Context{}))
+
+		rec := httptest.NewRecorder()
+		w, _ := g.CaptureUpstream(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		require.Same(t, rec, w)
+	})
+}
+
+// captureText passes an upstream HTML response with text to a garbage responder's capture.
+func captureText(t *testing.T, g *GarbageResponder, r *http.Request, text string) {
+	w, done := g.CaptureUpstream(httptest.NewRecorder(), r)
+	w.Header().Set("Content-Type", "text/html")
+	_, err := w.Write([]byte("<p>" + text + "</p>"))
+	require.NoError(t, err)
+	done()
+}
+
+func TestGarbageFormats(t *testing.T) {
+	g := &GarbageResponder{}
+	require.NoError(t, g.Provision(caddy.Context{}))
+
+	serve := func(url, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		req.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		require.NoError(t, g.ServeHTTP(rec, req, nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, strconv.Itoa(rec.Body.Len()), rec.Header().Get("Content-Length"))
+		return rec
+	}
+
+	t.Run("HTML", func(t *testing.T) {
+		rec := serve("http://example.com/", "text/html")
+		require.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+		_, err := html.Parse(rec.Body)
+		require.NoError(t, err)
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		rec := serve("http://example.com/api/posts", "")
+		require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+		var value map[string]any
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &value))
+		require.NotEmpty(t, value["items"])
+	})
+
+	t.Run("JSON matching a schema", func(t *testing.T) {
+		schema := filepath.Join(t.TempDir(), "schema.json")
+		require.NoError(t, os.WriteFile(schema, []byte(`{"type": "array", "items": {"type": "integer"}}`), 0o600))
+		g := &GarbageResponder{Config: &GarbageConfig{JSONSchema: schema}}
+		require.NoError(t, g.Provision(caddy.Context{}))
+
+		rec := httptest.NewRecorder()
+		require.NoError(t, g.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example.com/ids.json", nil), nil))
+		var value []int
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &value))
+	})
+
+	t.Run("RSS", func(t *testing.T) {
+		rec := serve("http://example.com/feed.xml", "")
+		require.Equal(t, "application/rss+xml; charset=utf-8", rec.Header().Get("Content-Type"))
+		var feed garbageFeed
+		require.NoError(t, xml.Unmarshal(rec.Body.Bytes(), &feed))
+		require.NotEmpty(t, feed.Channel.Items)
+		require.True(t, strings.HasPrefix(feed.Channel.Items[0].Link, "http://example.com/"))
+	})
+
+	t.Run("Images", func(t *testing.T) {
+		rec := serve("http://example.com/logo.png", "")
+		require.Equal(t, "image/png", rec.Header().Get("Content-Type"))
+		_, err := png.Decode(rec.Body)
+		require.NoError(t, err)
+
+		rec = serve("http://example.com/photo", "image/jpeg")
+		require.Equal(t, "image/jpeg", rec.Header().Get("Content-Type"))
+		_, err = jpeg.Decode(rec.Body)
+		require.NoError(t, err)
+	})
+
+	t.Run("Invalid schema file", func(t *testing.T) {
+		g := &GarbageResponder{Config: &GarbageConfig{JSONSchema: filepath.Join(t.TempDir(), "missing.json")}}
+		require.Error(t, g.Provision(caddy.Context{}))
+	})
+}
@@ -0,0 +1,180 @@
+package responders
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// limitResult is the outcome of a rate limit check.
+type limitResult struct {
+	allowed   bool
+	remaining int
+	// reset is the time until the limit is fully replenished.
+	reset time.Duration
+	// retryAfter is the time until the next request would be allowed.
+	retryAfter time.Duration
+}
+
+// limiter is a rate limiting algorithm tracking a single key.
+type limiter interface {
+	allow(now time.Time) limitResult
+	idle(now time.Time) bool
+}
+
+// limiterStore holds the limiters for each key and periodically forgets idle ones.
+type limiterStore struct {
+	config    *RateLimitConfig
+	limiters  map[string]limiter
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+func newLimiterStore(config *RateLimitConfig) *limiterStore {
+	return &limiterStore{
+		config:   config,
+		limiters: make(map[string]limiter),
+	}
+}
+
+// allow checks and records a request for key.
+func (s *limiterStore) allow(key string, now time.Time) limitResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) > s.config.Window {
+		for k, l := range s.limiters {
+			if l.idle(now) {
+				delete(s.limiters, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	l, ok := s.limiters[key]
+	if !ok {
+		l = s.newLimiter(now)
+		s.limiters[key] = l
+	}
+	return l.allow(now)
+}
+
+func (s *limiterStore) newLimiter(now time.Time) limiter {
+	if s.config.Algorithm == "sliding_window" {
+		return &slidingWindow{
+			limit:  s.config.Requests,
+			window: s.config.Window,
+			start:  now,
+		}
+	}
+	return &tokenBucket{
+		capacity: float64(s.config.Burst),
+		tokens:   float64(s.config.Burst),
+		// tokens replenished per second
+		rate: float64(s.config.Requests) / s.config.Window.Seconds(),
+		last: now,
+	}
+}
+
+// tokenBucket allows bursts of up to capacity requests, replenished at a constant rate.
+type tokenBucket struct {
+	last     time.Time
+	capacity float64
+	tokens   float64
+	rate     float64
+}
+
+func (b *tokenBucket) allow(now time.Time) limitResult {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.capacity, b.tokens+elapsed*b.rate)
+	}
+	b.last = now
+
+	result := limitResult{allowed: b.tokens >= 1}
+	if result.allowed {
+		b.tokens--
+	} else {
+		result.retryAfter = b.duration(1 - b.tokens)
+	}
+	result.remaining = int(b.tokens)
+	result.reset = b.duration(b.capacity - b.tokens)
+	return result
+}
+
+func (b *tokenBucket) idle(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.capacity
+}
+
+// duration returns the time needed to replenish the given number of tokens.
+func (b *tokenBucket) duration(tokens float64) time.Duration {
+	return time.Duration(tokens / b.rate * float64(time.Second))
+}
+
+// slidingWindow approximates the number of requests in the last window by weighting the count of the previous
+// fixed window by how much of it still overlaps with the sliding window.
+type slidingWindow struct {
+	start    time.Time
+	window   time.Duration
+	limit    int
+	previous int
+	current  int
+}
+
+func (s *slidingWindow) allow(now time.Time) limitResult {
+	s.advance(now)
+
+	elapsed := now.Sub(s.start)
+	weight := 1 - float64(elapsed)/float64(s.window)
+	count := float64(s.previous)*weight + float64(s.current)
+
+	result := limitResult{allowed: count+1 <= float64(s.limit)}
+	if result.allowed {
+		s.current++
+		count++
+	} else {
+		result.retryAfter = s.retryAfter(elapsed)
+	}
+	result.remaining = max(0, s.limit-int(math.Ceil(count)))
+	result.reset = s.window - elapsed
+	if s.current > 0 {
+		// Requests in the current window keep counting until they have slid out of the next one
+		result.reset += s.window
+	}
+	return result
+}
+
+// advance moves the fixed windows forward so that now falls within the current one.
+func (s *slidingWindow) advance(now time.Time) {
+	elapsed := now.Sub(s.start)
+	if elapsed < s.window {
+		return
+	}
+	windows := int64(elapsed / s.window)
+	if windows == 1 {
+		s.previous = s.current
+	} else {
+		s.previous = 0
+	}
+	s.current = 0
+	s.start = s.start.Add(time.Duration(windows) * s.window)
+}
+
+// retryAfter returns the time until the weighted count allows another request.
+func (s *slidingWindow) retryAfter(elapsed time.Duration) time.Duration {
+	free := float64(s.limit - s.current - 1)
+	if free < 0 {
+		// The current window alone is at the limit. Wait for it to roll over and then
+		// decay enough: current*(1-t/window) <= limit-1
+		decay := time.Duration(float64(s.window) * (1 - float64(s.limit-1)/float64(s.current)))
+		return s.window - elapsed + decay
+	}
+	if s.previous == 0 {
+		return 0
+	}
+	// previous*(1-(elapsed+t)/window) <= free
+	return max(time.Duration(float64(s.window)*(1-free/float64(s.previous)))-elapsed, 0)
+}
+
+func (s *slidingWindow) idle(now time.Time) bool {
+	return now.Sub(s.start) >= 2*s.window
+}
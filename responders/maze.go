@@ -0,0 +1,152 @@
+//nolint:gosec
+package responders
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/jasonlovesdoggo/caddy-defender/responders/garbage"
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultMazePrefix         = "/maze/"
+	defaultMazeLinks          = 5
+	defaultMazePagesPerSecond = 20
+	// mazeSitemapLinks is the number of maze pages listed in the fake sitemap.
+	mazeSitemapLinks = 50
+	// mazeRetryAfter is the Retry-After value in seconds sent when the generation limit is exceeded.
+	mazeRetryAfter = 5
+)
+
+// MazeConfig holds the maze responder's configuration.
+type MazeConfig struct {
+	// Prefix is the path the maze pages are served under.
+	// Default: "/maze/"
+	Prefix string `json:"prefix,omitempty"`
+	// Links is the number of links to further maze pages on every page.
+	// Default: 5
+	Links int `json:"links,omitempty"`
+	// Sitemap serves a fake sitemap.xml listing maze pages.
+	// Default: false
+	Sitemap bool `json:"sitemap,omitempty"`
+	// PagesPerSecond is the maximum number of pages generated per second for all clients combined.
+	// Requests above it get a 503 response.
+	// Default: 20
+	PagesPerSecond float64 `json:"pages_per_second,omitempty"`
+	// Burst is the number of pages that may be generated at once above PagesPerSecond.
+	// Default: PagesPerSecond
+	Burst int `json:"burst,omitempty"`
+}
+
+// Validate ensures the maze configuration is valid.
+func (c *MazeConfig) Validate() error {
+	if c.Links < 0 || c.PagesPerSecond < 0 || c.Burst < 0 {
+		return errors.New("maze links, pages_per_second and burst must not be negative")
+	}
+	if c.Prefix != "" && (!strings.HasPrefix(c.Prefix, "/") || !strings.HasSuffix(c.Prefix, "/")) {
+		return fmt.Errorf("maze prefix must start and end with '/': '%s'", c.Prefix)
+	}
+	return nil
+}
+
+// MazeResponder traps crawlers in an endless maze of generated HTML pages. Every page under the prefix contains
+// garbage text and links to further maze pages, and is derived from the URL so that it is the same on every visit.
+// Requests outside the prefix get the maze's entrance page. The text is generated like the garbage responder's.
+type MazeResponder struct {
+	Config *MazeConfig
+	// Garbage is the configuration the page text is generated with.
+	Garbage *GarbageConfig
+
+	garbage *GarbageResponder
+	limiter *rate.Limiter
+}
+
+// Provision sets defaults, trains the text model and sets up the generation limit.
+func (m *MazeResponder) Provision(ctx caddy.Context) error {
+	if m.Config == nil {
+		m.Config = &MazeConfig{}
+	}
+	if m.Config.Prefix == "" {
+		m.Config.Prefix = defaultMazePrefix
+	}
+	if m.Config.Links == 0 {
+		m.Config.Links = defaultMazeLinks
+	}
+	if m.Config.PagesPerSecond == 0 {
+		m.Config.PagesPerSecond = defaultMazePagesPerSecond
+	}
+	if m.Config.Burst == 0 {
+		m.Config.Burst = max(int(m.Config.PagesPerSecond), 1)
+	}
+	m.limiter = rate.NewLimiter(rate.Limit(m.Config.PagesPerSecond), m.Config.Burst)
+
+	m.garbage = &GarbageResponder{Config: m.Garbage}
+	return m.garbage.Provision(ctx)
+}
+
+func (m *MazeResponder) ServeHTTP(w http.ResponseWriter, r *http.Request, _ caddyhttp.Handler) error {
+	if !m.limiter.Allow() {
+		w.Header().Set("Retry-After", strconv.Itoa(mazeRetryAfter))
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return nil
+	}
+
+	rng := garbage.RequestRand(r)
+	if m.Config.Sitemap && r.URL.Path == "/sitemap.xml" {
+		return m.serveSitemap(w, r, rng)
+	}
+	return m.servePage(w, rng)
+}
+
+func (m *MazeResponder) servePage(w http.ResponseWriter, rng *rand.Rand) error {
+	page := m.garbage.page(rng)
+	page.Links = make([]garbageLink, m.Config.Links)
+	for i := range page.Links {
+		page.Links[i] = garbageLink{URL: m.link(rng), Text: m.garbage.phrase(rng, 2+rng.IntN(3))}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	return garbagePageTemplate.Execute(w, page)
+}
+
+var mazeSitemapTemplate = template.Must(template.New("sitemap").Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+{{range .}}<url><loc>{{.}}</loc></url>
+{{end}}</urlset>
+`))
+
+func (m *MazeResponder) serveSitemap(w http.ResponseWriter, r *http.Request, rng *rand.Rand) error {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	urls := make([]string, mazeSitemapLinks)
+	for i := range urls {
+		urls[i] = scheme + "://" + r.Host + m.link(rng)
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	return mazeSitemapTemplate.Execute(w, urls)
+}
+
+// link returns the path of a random maze page.
+func (m *MazeResponder) link(rng *rand.Rand) string {
+	words := strings.Fields(garbage.NonsenseWords(rng, 2+rng.IntN(3)))
+	return m.Config.Prefix + strings.Join(words, "-") + "-" + strconv.FormatUint(rng.Uint64()%100000, 10)
+}
+
+// CaptureUpstream adds the site's own text responses to the corpus, see GarbageResponder.CaptureUpstream.
+func (m *MazeResponder) CaptureUpstream(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, func()) {
+	return m.garbage.CaptureUpstream(w, r)
+}
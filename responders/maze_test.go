@@ -0,0 +1,82 @@
+package responders
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/stretchr/testify/require"
+)
+
+var mazeLinkPattern = regexp.MustCompile(`href="([^"]+)"`)
+
+func serveMaze(t *testing.T, m *MazeResponder, url string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	require.NoError(t, m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil), nil))
+	return rec
+}
+
+func TestMazeResponder(t *testing.T) {
+	t.Run("Pages link deeper into the maze", func(t *testing.T) {
+		m := &MazeResponder{Config: &MazeConfig{Links: 4}}
+		require.NoError(t, m.Provision(caddy.Context{}))
+
+		url := "http://example.com/"
+		for i := 0; i < 5; i++ {
+			rec := serveMaze(t, m, url)
+			require.Equal(t, http.StatusOK, rec.Code)
+			require.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+			require.Contains(t, rec.Body.String(), "<p>")
+
+			links := mazeLinkPattern.FindAllStringSubmatch(rec.Body.String(), -1)
+			require.Len(t, links, 4)
+			for _, link := range links {
+				require.True(t, strings.HasPrefix(link[1], "/maze/"), link[1])
+			}
+			url = "http://example.com" + links[0][1]
+		}
+	})
+
+	t.Run("Pages are deterministic", func(t *testing.T) {
+		m := &MazeResponder{}
+		require.NoError(t, m.Provision(caddy.Context{}))
+
+		page := serveMaze(t, m, "http://example.com/maze/a").Body.String()
+		require.Equal(t, page, serveMaze(t, m, "http://example.com/maze/a").Body.String())
+		require.NotEqual(t, page, serveMaze(t, m, "http://example.com/maze/b").Body.String())
+	})
+
+	t.Run("Sitemap", func(t *testing.T) {
+		m := &MazeResponder{Config: &MazeConfig{Prefix: "/archive/", Sitemap: true}}
+		require.NoError(t, m.Provision(caddy.Context{}))
+
+		rec := serveMaze(t, m, "http://example.com/sitemap.xml")
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, "application/xml; charset=utf-8", rec.Header().Get("Content-Type"))
+		require.Equal(t, mazeSitemapLinks, strings.Count(rec.Body.String(), "<loc>http://example.com/archive/"))
+	})
+
+	t.Run("Sitemap is a maze page when disabled", func(t *testing.T) {
+		m := &MazeResponder{}
+		require.NoError(t, m.Provision(caddy.Context{}))
+
+		rec := serveMaze(t, m, "http://example.com/sitemap.xml")
+		require.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+	})
+
+	t.Run("Generation is rate limited", func(t *testing.T) {
+		m := &MazeResponder{Config: &MazeConfig{PagesPerSecond: 0.001, Burst: 3}}
+		require.NoError(t, m.Provision(caddy.Context{}))
+
+		for i := 0; i < 3; i++ {
+			require.Equal(t, http.StatusOK, serveMaze(t, m, "http://example.com/maze/a").Code)
+		}
+		rec := serveMaze(t, m, "http://example.com/maze/a")
+		require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		require.Equal(t, "5", rec.Header().Get("Retry-After"))
+		require.Empty(t, rec.Body.String())
+	})
+}
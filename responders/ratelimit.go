@@ -1,16 +1,189 @@
 package responders
 
 import (
-	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
 )
 
+const (
+	// DefaultRateLimitHeader is the request header set by the ratelimit responder when no limit is configured.
+	DefaultRateLimitHeader = "X-RateLimit-Apply"
+
+	defaultRateLimitAlgorithm  = "token_bucket"
+	defaultRateLimitKey        = "ip"
+	defaultRateLimitWindow     = time.Minute
+	defaultRateLimitIPv4Prefix = 24
+	defaultRateLimitIPv6Prefix = 64
+)
+
+var (
+	rateLimitAlgorithms = []string{"token_bucket", "sliding_window"}
+	rateLimitKeys       = []string{"ip", "prefix", "group"}
+)
+
+// RateLimitConfig holds the ratelimit responder's configuration.
+// If Requests is 0, no limit is enforced by Defender and matched requests are only tagged with a header
+// for a separate rate limiting module such as caddy-ratelimit.
+type RateLimitConfig struct {
+	// Algorithm is either "token_bucket" or "sliding_window".
+	// Default: token_bucket
+	Algorithm string `json:"algorithm,omitempty"`
+	// Key determines which requests share a limit: the client "ip", the client's "prefix" or the
+	// matched range "group".
+	// Default: ip
+	Key string `json:"key,omitempty"`
+	// Requests is the number of requests allowed per Window.
+	Requests int `json:"requests,omitempty"`
+	// Window is the period Requests are allowed in.
+	// Default: 1m
+	Window time.Duration `json:"window,omitempty"`
+	// Burst is the maximum number of requests a token bucket allows at once.
+	// Default: Requests
+	Burst int `json:"burst,omitempty"`
+	// IPv4Prefix is the prefix length IPv4 clients are grouped by when Key is "prefix".
+	// Default: 24
+	IPv4Prefix int `json:"ipv4_prefix,omitempty"`
+	// IPv6Prefix is the prefix length IPv6 clients are grouped by when Key is "prefix".
+	// Default: 64
+	IPv6Prefix int `json:"ipv6_prefix,omitempty"`
+}
+
+// Validate ensures the rate limit configuration is valid.
+func (c *RateLimitConfig) Validate() error {
+	if c.Algorithm != "" && !slices.Contains(rateLimitAlgorithms, c.Algorithm) {
+		return fmt.Errorf("invalid ratelimit algorithm '%s'", c.Algorithm)
+	}
+	if c.Key != "" && !slices.Contains(rateLimitKeys, c.Key) {
+		return fmt.Errorf("invalid ratelimit key '%s'", c.Key)
+	}
+	if c.Requests < 0 || c.Burst < 0 || c.Window < 0 {
+		return errors.New("ratelimit requests, burst and window must not be negative")
+	}
+	if c.IPv4Prefix < 0 || c.IPv4Prefix > 32 {
+		return fmt.Errorf("invalid ratelimit ipv4_prefix %d", c.IPv4Prefix)
+	}
+	if c.IPv6Prefix < 0 || c.IPv6Prefix > 128 {
+		return fmt.Errorf("invalid ratelimit ipv6_prefix %d", c.IPv6Prefix)
+	}
+	return nil
+}
+
+// RateLimitResponder limits the rate of matched requests. Requests within the limit are passed on to the next
+// handler, others are rejected with 429 Too Many Requests.
+// If no limit is configured, matched requests are tagged with a header and passed on instead.
 type RateLimitResponder struct {
+	Config *RateLimitConfig
+	// Header is the request header set to "true" when no limit is configured.
+	// Default: X-RateLimit-Apply
+	Header string
+
+	limiters *limiterStore
+	now      func() time.Time
+}
+
+// Provision sets defaults and initializes the limiter state.
+func (r *RateLimitResponder) Provision(_ caddy.Context) error {
+	if r.Header == "" {
+		r.Header = DefaultRateLimitHeader
+	}
+	if r.Config == nil {
+		r.Config = &RateLimitConfig{}
+	}
+	if r.Config.Algorithm == "" {
+		r.Config.Algorithm = defaultRateLimitAlgorithm
+	}
+	if r.Config.Key == "" {
+		r.Config.Key = defaultRateLimitKey
+	}
+	if r.Config.Window == 0 {
+		r.Config.Window = defaultRateLimitWindow
+	}
+	if r.Config.Burst == 0 {
+		r.Config.Burst = r.Config.Requests
+	}
+	if r.Config.IPv4Prefix == 0 {
+		r.Config.IPv4Prefix = defaultRateLimitIPv4Prefix
+	}
+	if r.Config.IPv6Prefix == 0 {
+		r.Config.IPv6Prefix = defaultRateLimitIPv6Prefix
+	}
+	if r.now == nil {
+		r.now = time.Now
+	}
+	r.limiters = newLimiterStore(r.Config)
+	return nil
 }
 
 func (r *RateLimitResponder) ServeHTTP(w http.ResponseWriter, req *http.Request, next caddyhttp.Handler) error {
-	req.Header.Set("X-RateLimit-Apply", "true")
+	if r.Config == nil || r.Config.Requests == 0 || r.limiters == nil {
+		header := r.Header
+		if header == "" {
+			header = DefaultRateLimitHeader
+		}
+		req.Header.Set(header, "true")
+
+		// Continue with the handler chain
+		return next.ServeHTTP(w, req)
+	}
+
+	result := r.limiters.allow(r.key(req), r.now())
+
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(r.Config.Requests))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.reset)))
+
+	if !result.allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.retryAfter)))
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, err := w.Write([]byte(http.StatusText(http.StatusTooManyRequests)))
+		return err
+	}
 
-	// Continue with the handler chain
 	return next.ServeHTTP(w, req)
 }
+
+// key returns the limiter key of a request.
+func (r *RateLimitResponder) key(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+
+	switch r.Config.Key {
+	case "group":
+		if group := MatchedGroup(req); group != "" {
+			return "group:" + group
+		}
+	case "prefix":
+		if addr, err := netip.ParseAddr(host); err == nil {
+			addr = addr.Unmap()
+			bits := r.Config.IPv6Prefix
+			if addr.Is4() {
+				bits = r.Config.IPv4Prefix
+			}
+			if prefix, err := addr.Prefix(bits); err == nil {
+				return "prefix:" + prefix.String()
+			}
+		}
+	}
+
+	return "ip:" + host
+}
+
+// ceilSeconds rounds a duration up to whole seconds, as used by the Retry-After and RateLimit-Reset headers.
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,186 @@
+package responders
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is a manually advanced clock for deterministic limits.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func newTestRateLimitResponder(t *testing.T, config *RateLimitConfig) (*RateLimitResponder, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	r := &RateLimitResponder{Config: config, now: clock.Now}
+	require.NoError(t, r.Provision(caddy.Context{}))
+	return r, clock
+}
+
+func newRateLimitRequest(remoteAddr, group string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = remoteAddr
+	ctx := context.WithValue(req.Context(), caddyhttp.VarsCtxKey, map[string]any{})
+	req = req.WithContext(ctx)
+	if group != "" {
+		caddyhttp.SetVar(req.Context(), GroupVarKey, group)
+	}
+	return req
+}
+
+// serve sends a request through the responder and returns the response and whether it was passed on.
+func serve(t *testing.T, r *RateLimitResponder, req *http.Request) (*httptest.ResponseRecorder, bool) {
+	passed := false
+	next := caddyhttp.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) error {
+		passed = true
+		w.WriteHeader(http.StatusOK)
+		return nil
+	})
+	rec := httptest.NewRecorder()
+	require.NoError(t, r.ServeHTTP(rec, req, next))
+	return rec, passed
+}
+
+func TestRateLimitHeaderMode(t *testing.T) {
+	t.Run("Default header", func(t *testing.T) {
+		r, _ := newTestRateLimitResponder(t, &RateLimitConfig{})
+		req := newRateLimitRequest("192.168.1.10:1234", "")
+
+		_, passed := serve(t, r, req)
+		require.True(t, passed)
+		require.Equal(t, "true", req.Header.Get(DefaultRateLimitHeader))
+	})
+
+	t.Run("Custom header", func(t *testing.T) {
+		r := &RateLimitResponder{Config: &RateLimitConfig{}, Header: "X-API-RateLimit"}
+		require.NoError(t, r.Provision(caddy.Context{}))
+		req := newRateLimitRequest("192.168.1.10:1234", "")
+
+		rec, passed := serve(t, r, req)
+		require.True(t, passed)
+		require.Equal(t, "true", req.Header.Get("X-API-RateLimit"))
+		require.Empty(t, rec.Header().Get("RateLimit-Limit"))
+	})
+}
+
+func TestRateLimitTokenBucket(t *testing.T) {
+	r, clock := newTestRateLimitResponder(t, &RateLimitConfig{Requests: 2, Window: 10 * time.Second})
+
+	for i := 0; i < 2; i++ {
+		rec, passed := serve(t, r, newRateLimitRequest("192.168.1.10:1234", ""))
+		require.True(t, passed)
+		require.Equal(t, "2", rec.Header().Get("RateLimit-Limit"))
+	}
+
+	rec, passed := serve(t, r, newRateLimitRequest("192.168.1.10:1234", ""))
+	require.False(t, passed)
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	require.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"))
+	require.Equal(t, "10", rec.Header().Get("RateLimit-Reset"))
+	// One token is replenished every 5 seconds
+	require.Equal(t, "5", rec.Header().Get("Retry-After"))
+
+	// Other clients have their own bucket
+	_, passed = serve(t, r, newRateLimitRequest("192.168.1.11:1234", ""))
+	require.True(t, passed)
+
+	clock.now = clock.now.Add(5 * time.Second)
+	rec, passed = serve(t, r, newRateLimitRequest("192.168.1.10:1234", ""))
+	require.True(t, passed)
+	require.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"))
+}
+
+func TestRateLimitBurst(t *testing.T) {
+	r, _ := newTestRateLimitResponder(t, &RateLimitConfig{Requests: 1, Window: time.Second, Burst: 3})
+
+	for i := 0; i < 3; i++ {
+		_, passed := serve(t, r, newRateLimitRequest("192.168.1.10:1234", ""))
+		require.True(t, passed)
+	}
+	_, passed := serve(t, r, newRateLimitRequest("192.168.1.10:1234", ""))
+	require.False(t, passed)
+}
+
+func TestRateLimitSlidingWindow(t *testing.T) {
+	r, clock := newTestRateLimitResponder(t, &RateLimitConfig{
+		Algorithm: "sliding_window",
+		Requests:  4,
+		Window:    time.Minute,
+	})
+
+	for i := 0; i < 4; i++ {
+		_, passed := serve(t, r, newRateLimitRequest("192.168.1.10:1234", ""))
+		require.True(t, passed)
+	}
+	rec, passed := serve(t, r, newRateLimitRequest("192.168.1.10:1234", ""))
+	require.False(t, passed)
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	require.NotEmpty(t, rec.Header().Get("Retry-After"))
+
+	// Halfway into the next window, half of the previous window's requests still count
+	clock.now = clock.now.Add(90 * time.Second)
+	for i := 0; i < 2; i++ {
+		_, passed = serve(t, r, newRateLimitRequest("192.168.1.10:1234", ""))
+		require.True(t, passed)
+	}
+	rec, passed = serve(t, r, newRateLimitRequest("192.168.1.10:1234", ""))
+	require.False(t, passed)
+	require.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"))
+
+	// After two full windows, the limit is fully replenished
+	clock.now = clock.now.Add(2 * time.Minute)
+	rec, passed = serve(t, r, newRateLimitRequest("192.168.1.10:1234", ""))
+	require.True(t, passed)
+	require.Equal(t, "3", rec.Header().Get("RateLimit-Remaining"))
+}
+
+func TestRateLimitKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		key        string
+		remoteAddr string
+		group      string
+		expected   string
+	}{
+		{name: "ip", key: "ip", remoteAddr: "192.168.1.10:1234", expected: "ip:192.168.1.10"},
+		{name: "ipv4 prefix", key: "prefix", remoteAddr: "192.168.1.10:1234", expected: "prefix:192.168.1.0/24"},
+		{name: "ipv6 prefix", key: "prefix", remoteAddr: "[2001:db8:1:2::1]:1234", expected: "prefix:2001:db8:1:2::/64"},
+		{name: "group", key: "group", remoteAddr: "192.168.1.10:1234", group: "openai", expected: "group:openai"},
+		{name: "group falls back to ip", key: "group", remoteAddr: "192.168.1.10:1234", expected: "ip:192.168.1.10"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := newTestRateLimitResponder(t, &RateLimitConfig{Key: tt.key, Requests: 1})
+			require.Equal(t, tt.expected, r.key(newRateLimitRequest(tt.remoteAddr, tt.group)))
+		})
+	}
+
+	t.Run("Shared group limit", func(t *testing.T) {
+		r, _ := newTestRateLimitResponder(t, &RateLimitConfig{Key: "group", Requests: 1})
+
+		_, passed := serve(t, r, newRateLimitRequest("192.168.1.10:1234", "openai"))
+		require.True(t, passed)
+		_, passed = serve(t, r, newRateLimitRequest("10.0.0.1:1234", "openai"))
+		require.False(t, passed)
+	})
+}
+
+func TestRateLimitConfigValidate(t *testing.T) {
+	require.NoError(t, (&RateLimitConfig{Requests: 10}).Validate())
+	require.ErrorContains(t, (&RateLimitConfig{Algorithm: "leaky"}).Validate(), "invalid ratelimit algorithm")
+	require.ErrorContains(t, (&RateLimitConfig{Key: "path"}).Validate(), "invalid ratelimit key")
+	require.ErrorContains(t, (&RateLimitConfig{Requests: -1}).Validate(), "must not be negative")
+	require.ErrorContains(t, (&RateLimitConfig{IPv4Prefix: 33}).Validate(), "invalid ratelimit ipv4_prefix")
+}
@@ -1,17 +1,164 @@
+//nolint:gosec
 package responders
 
 import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"net"
 	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
 
+	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
 )
 
-// RedirectResponder redirects a request with a 308 permanent redirect response.
+// RedirectStatusCodes are the status codes the redirect responder can respond with.
+var RedirectStatusCodes = []int{
+	http.StatusMovedPermanently,
+	http.StatusFound,
+	http.StatusSeeOther,
+	http.StatusTemporaryRedirect,
+	http.StatusPermanentRedirect,
+}
+
+// RedirectConfig holds the redirect responder's configuration.
+type RedirectConfig struct {
+	// Targets are further URLs to redirect to in addition to the Defender's URL. They may contain placeholders.
+	Targets []string `json:"targets,omitempty"`
+	// Selection is how a target is chosen for a request: "random", or "hash" to always send a client to the same
+	// target.
+	// Default: "random"
+	Selection string `json:"selection,omitempty"`
+	// PreservePath appends the request's path to the target's.
+	// Default: false
+	PreservePath bool `json:"preserve_path,omitempty"`
+	// PreserveQuery appends the request's query to the target's.
+	// Default: false
+	PreserveQuery bool `json:"preserve_query,omitempty"`
+}
+
+// Validate ensures the redirect configuration is valid.
+func (c *RedirectConfig) Validate() error {
+	if c.Selection != "" && c.Selection != "random" && c.Selection != "hash" {
+		return fmt.Errorf("invalid redirect selection '%s'", c.Selection)
+	}
+	for _, target := range c.Targets {
+		if err := ValidateRedirectTarget(target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// placeholderPattern matches Caddy placeholders.
+var placeholderPattern = regexp.MustCompile(`\{[^{}]+\}`)
+
+// ValidateRedirectTarget ensures a redirect target is an absolute http(s) URL or an absolute path, once its
+// placeholders are replaced.
+func ValidateRedirectTarget(target string) error {
+	u, err := url.Parse(placeholderPattern.ReplaceAllString(target, "placeholder"))
+	if err != nil {
+		return fmt.Errorf("invalid redirect target '%s': %v", target, err)
+	}
+	if u.IsAbs() {
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("invalid redirect target '%s': scheme must be http or https", target)
+		}
+		if u.Host == "" {
+			return fmt.Errorf("invalid redirect target '%s': missing host", target)
+		}
+		return nil
+	}
+	if !strings.HasPrefix(u.Path, "/") {
+		return fmt.Errorf("invalid redirect target '%s': must be an absolute URL or path", target)
+	}
+	return nil
+}
+
+// RedirectResponder redirects a request to one of its targets, with a 308 permanent redirect response by default.
 type RedirectResponder struct {
 	URL string
+	// ResponseCode is one of RedirectStatusCodes, or 0 for 308.
+	ResponseCode int
+	Config       *RedirectConfig
+
+	targets []string
+}
+
+// Provision sets defaults and collects the targets.
+func (r *RedirectResponder) Provision(_ caddy.Context) error {
+	if r.Config == nil {
+		r.Config = &RedirectConfig{}
+	}
+	if r.ResponseCode == 0 {
+		r.ResponseCode = http.StatusPermanentRedirect
+	}
+
+	r.targets = nil
+	if r.URL != "" {
+		r.targets = append(r.targets, r.URL)
+	}
+	r.targets = append(r.targets, r.Config.Targets...)
+	return nil
 }
 
 func (r *RedirectResponder) ServeHTTP(w http.ResponseWriter, req *http.Request, _ caddyhttp.Handler) error {
-	http.Redirect(w, req, r.URL, http.StatusPermanentRedirect)
+	if len(r.targets) == 0 {
+		return caddyhttp.Error(http.StatusInternalServerError, errors.New("redirect responder has no targets"))
+	}
+
+	repl, ok := req.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+	if !ok {
+		repl = caddy.NewReplacer()
+	}
+
+	target, err := url.Parse(repl.ReplaceKnown(r.target(req), ""))
+	if err != nil {
+		return caddyhttp.Error(http.StatusInternalServerError, fmt.Errorf("redirect target: %v", err))
+	}
+	if r.Config.PreservePath {
+		target.Path = strings.TrimSuffix(target.Path, "/") + cleanPath(req.URL.Path)
+		target.RawPath = ""
+	}
+	if r.Config.PreserveQuery && req.URL.RawQuery != "" {
+		if target.RawQuery != "" {
+			target.RawQuery += "&"
+		}
+		target.RawQuery += req.URL.RawQuery
+	}
+
+	http.Redirect(w, req, target.String(), r.ResponseCode)
 	return nil
 }
+
+// target chooses the target for a request.
+func (r *RedirectResponder) target(req *http.Request) string {
+	if len(r.targets) == 1 {
+		return r.targets[0]
+	}
+	if r.Config.Selection == "hash" {
+		host, _, err := net.SplitHostPort(req.RemoteAddr)
+		if err != nil {
+			host = req.RemoteAddr
+		}
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(host))
+		return r.targets[h.Sum32()%uint32(len(r.targets))]
+	}
+	return r.targets[rand.IntN(len(r.targets))]
+}
+
+// cleanPath returns a request path cleaned of dot segments and repeated slashes, keeping a trailing slash. Once
+// appended to a path-only target, a path like //evil.com would otherwise redirect to another host.
+func cleanPath(p string) string {
+	cleaned := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
@@ -0,0 +1,138 @@
+package responders
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/stretchr/testify/require"
+)
+
+func serveRedirect(t *testing.T, r *RedirectResponder, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	require.NoError(t, r.ServeHTTP(rec, req, nil))
+	return rec
+}
+
+func TestRedirectResponder(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		r := &RedirectResponder{URL: "https://example.com/away"}
+		require.NoError(t, r.Provision(caddy.Context{}))
+
+		rec := serveRedirect(t, r, httptest.NewRequest(http.MethodGet, "/page?a=1", nil))
+		require.Equal(t, http.StatusPermanentRedirect, rec.Code)
+		require.Equal(t, "https://example.com/away", rec.Header().Get("Location"))
+	})
+
+	t.Run("Status code", func(t *testing.T) {
+		r := &RedirectResponder{URL: "https://example.com/", ResponseCode: http.StatusFound}
+		require.NoError(t, r.Provision(caddy.Context{}))
+		require.Equal(t, http.StatusFound, serveRedirect(t, r, httptest.NewRequest(http.MethodGet, "/", nil)).Code)
+
+	})
+
+	t.Run("Placeholders", func(t *testing.T) {
+		r := &RedirectResponder{URL: "https://decoy.example.com/{http.vars.defender_group}"}
+		require.NoError(t, r.Provision(caddy.Context{}))
+
+		rec := serveRedirect(t, r, newTemplateRequest(""))
+		require.Equal(t, "https://decoy.example.com/openai", rec.Header().Get("Location"))
+	})
+
+	t.Run("Preserve path and query", func(t *testing.T) {
+		r := &RedirectResponder{
+			URL:    "https://decoy.example.com/mirror/?src=defender",
+			Config: &RedirectConfig{PreservePath: true, PreserveQuery: true},
+		}
+		require.NoError(t, r.Provision(caddy.Context{}))
+
+		rec := serveRedirect(t, r, httptest.NewRequest(http.MethodGet, "/blog/post?page=2", nil))
+		require.Equal(t, "https://decoy.example.com/mirror/blog/post?src=defender&page=2", rec.Header().Get("Location"))
+	})
+
+	t.Run("Preserved paths stay on the target's host", func(t *testing.T) {
+		r := &RedirectResponder{URL: "/", Config: &RedirectConfig{PreservePath: true}}
+		require.NoError(t, r.Provision(caddy.Context{}))
+
+		for path, expected := range map[string]string{
+			"//evil.com/x":            "/evil.com/x",
+			"///evil.com/":            "/evil.com/",
+			"/%2F%2Fevil.com":         "/evil.com",
+			"/..//evil.com/x":         "/evil.com/x",
+			"/blog/../docs/page.html": "/docs/page.html",
+		} {
+			rec := serveRedirect(t, r, httptest.NewRequest(http.MethodGet, path, nil))
+			require.Equal(t, http.StatusPermanentRedirect, rec.Code)
+			require.Equal(t, expected, rec.Header().Get("Location"), path)
+		}
+	})
+
+	t.Run("Random selection uses every target", func(t *testing.T) {
+		r := &RedirectResponder{
+			URL:    "https://a.example.com/",
+			Config: &RedirectConfig{Targets: []string{"https://b.example.com/", "https://c.example.com/"}},
+		}
+		require.NoError(t, r.Provision(caddy.Context{}))
+
+		seen := map[string]bool{}
+		for i := 0; i < 200; i++ {
+			seen[serveRedirect(t, r, httptest.NewRequest(http.MethodGet, "/", nil)).Header().Get("Location")] = true
+		}
+		require.Len(t, seen, 3)
+	})
+
+	t.Run("Hash selection is stable per client", func(t *testing.T) {
+		r := &RedirectResponder{Config: &RedirectConfig{
+			Targets:   []string{"https://a.example.com/", "https://b.example.com/", "https://c.example.com/"},
+			Selection: "hash",
+		}}
+		require.NoError(t, r.Provision(caddy.Context{}))
+
+		seen := map[string]bool{}
+		for i := 0; i < 50; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = fmt.Sprintf("198.51.100.%d:1234", i)
+			location := serveRedirect(t, r, req).Header().Get("Location")
+			seen[location] = true
+
+			req.RemoteAddr = fmt.Sprintf("198.51.100.%d:5678", i)
+			require.Equal(t, location, serveRedirect(t, r, req).Header().Get("Location"))
+		}
+		require.Len(t, seen, 3)
+	})
+
+	t.Run("No targets", func(t *testing.T) {
+		r := &RedirectResponder{}
+		require.NoError(t, r.Provision(caddy.Context{}))
+
+		err := r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), nil)
+		var handlerErr caddyhttp.HandlerError
+		require.ErrorAs(t, err, &handlerErr)
+		require.Equal(t, http.StatusInternalServerError, handlerErr.StatusCode)
+	})
+}
+
+func TestValidateRedirectTarget(t *testing.T) {
+	for _, target := range []string{
+		"https://example.com/",
+		"http://example.com:8080/path?q=1",
+		"https://{http.request.host}/{http.vars.defender_group}",
+		"/local/path",
+	} {
+		require.NoError(t, ValidateRedirectTarget(target), target)
+	}
+
+	for target, msg := range map[string]string{
+		"ftp://example.com/": "scheme must be http or https",
+		"https:///path":      "missing host",
+		"relative/path":      "must be an absolute URL or path",
+		"http://[::1":        "invalid redirect target",
+	} {
+		require.ErrorContains(t, ValidateRedirectTarget(target), msg, target)
+	}
+
+	require.ErrorContains(t, (&RedirectConfig{Selection: "roundrobin"}).Validate(), "invalid redirect selection")
+}
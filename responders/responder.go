@@ -1,11 +1,22 @@
 package responders
 
 import (
-	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
 	"net/http"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
 )
 
+// GroupVarKey is the name of the request variable holding the range group matched by the client IP.
+// It is available as the {http.vars.defender_group} placeholder.
+const GroupVarKey = "defender_group"
+
 // Responder defines the interface for handling responses.
 type Responder interface {
 	ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error
 }
+
+// MatchedGroup returns the range group matched by the client IP of the request, if any.
+func MatchedGroup(r *http.Request) string {
+	group, _ := caddyhttp.GetVar(r.Context(), GroupVarKey).(string)
+	return group
+}
@@ -0,0 +1,44 @@
+package tarpit
+
+import (
+	"io"
+	"net"
+	"syscall"
+	"time"
+)
+
+// serveConn writes a body at the configured rate over a hijacked connection until the body or the time is up, the
+// client disconnects or the config is unloaded, then closes the connection. It returns the number of bytes written.
+func (r *Responder) serveConn(conn net.Conn, body io.Reader, scheduler *Scheduler, start time.Time) int64 {
+	defer conn.Close()
+
+	// A hijacked request's context isn't canceled once the client disconnects, so reading notices it instead. A client
+	// which only half-closed the connection may still be reading, so the end of what it sends isn't a disconnect: if
+	// it is gone, writing to it fails.
+	gone := make(chan struct{})
+	read := make(chan struct{})
+	go func() {
+		defer close(read)
+		if _, err := io.Copy(io.Discard, conn); err != nil {
+			close(gone)
+		}
+	}()
+
+	s := r.newStream(conn, connController{conn}, body, start)
+	// Unlike a TLS connection, a plain one can still be written to after a write timed out
+	_, s.resumable = conn.(syscall.Conn)
+	r.serveStream(s, scheduler, gone)
+	conn.Close()
+	<-read
+	return s.written
+}
+
+// connController controls a hijacked connection, which is written to unbuffered.
+type connController struct {
+	net.Conn
+}
+
+// Flush does nothing, as writes aren't buffered.
+func (c connController) Flush() error {
+	return nil
+}
@@ -0,0 +1,61 @@
+package tarpit
+
+import (
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DirReader implements the ContentReader interface and reads a random file of a directory on disk per request.
+// Files are listed on every read, so files added to or removed from the directory are picked up.
+type DirReader struct {
+	Path string
+}
+
+// Read opens a random file of the directory for streaming.
+func (d DirReader) Read() (io.ReadCloser, error) {
+	files, err := d.files()
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(files[rand.IntN(len(files))])
+}
+
+// Size returns -1, as the size depends on the file picked.
+func (d DirReader) Size() int64 {
+	return -1
+}
+
+// Validate ensures the directory holds at least one readable file.
+func (d DirReader) Validate() error {
+	_, err := d.files()
+	return err
+}
+
+// files returns the paths of the regular files of the directory, leaving out hidden ones.
+func (d DirReader) files() ([]string, error) {
+	entries, err := os.ReadDir(d.Path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(d.Path, entry.Name())
+		// Follow symlinks to files
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, path)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files in tarpit content directory '%s'", d.Path)
+	}
+	return files, nil
+}
@@ -0,0 +1,44 @@
+package tarpit
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirReader(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"a.txt": "a", "b.txt": "b", ".hidden": "hidden"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "subdir"), 0o700))
+
+	reader := DirReader{Path: dir}
+	require.NoError(t, reader.Validate())
+	require.Equal(t, int64(-1), reader.Size())
+
+	// Every visible file is picked sooner or later, and nothing else
+	seen := map[string]bool{}
+	for range 100 {
+		content, err := reader.Read()
+		require.NoError(t, err)
+		data, err := io.ReadAll(content)
+		require.NoError(t, err)
+		require.NoError(t, content.Close())
+		seen[string(data)] = true
+	}
+	require.Equal(t, map[string]bool{"a": true, "b": true}, seen)
+}
+
+func TestDirReaderInvalid(t *testing.T) {
+	require.Error(t, DirReader{Path: filepath.Join(t.TempDir(), "missing")}.Validate())
+
+	empty := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(empty, ".hidden"), nil, 0o600))
+	require.ErrorContains(t, DirReader{Path: empty}.Validate(), "no files in tarpit content directory")
+	_, err := DirReader{Path: empty}.Read()
+	require.Error(t, err)
+}
@@ -15,6 +15,15 @@ func (f FileReader) Read() (io.ReadCloser, error) {
 	return os.Open(f.Path) // Returns a file handle for streaming
 }
 
+// Size returns the size of the file, or -1 if it can't be read.
+func (f FileReader) Size() int64 {
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		return -1
+	}
+	return info.Size()
+}
+
 // Validate ensures the content path is readable
 func (f FileReader) Validate() error {
 	_, err := os.Stat(f.Path)
@@ -0,0 +1,191 @@
+//nolint:gosec
+package tarpit
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"slices"
+	"strings"
+
+	"github.com/jasonlovesdoggo/caddy-defender/responders/garbage"
+)
+
+const (
+	// GeneratorText generates random prose-like text of made-up words.
+	GeneratorText = "text"
+	// GeneratorWords generates nonsense words and symbols like the garbage responder does.
+	GeneratorWords = "words"
+	// GeneratorHTML generates a never-ending HTML document of nested elements.
+	GeneratorHTML = "html"
+
+	// maxHTMLDepth is the depth of elements, below body, which generated HTML doesn't nest beyond.
+	maxHTMLDepth = 64
+)
+
+// Generators are the content generators of the generate protocol.
+var Generators = []string{GeneratorText, GeneratorWords, GeneratorHTML}
+
+// GenerateReader implements the ContentReader interface and generates an endless stream of junk, so responses last
+// until the timeout without any content on disk.
+type GenerateReader struct {
+	Generator string
+}
+
+// Read starts a newly seeded stream of generated content.
+func (g GenerateReader) Read() (io.ReadCloser, error) {
+	rng := rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	switch g.Generator {
+	case GeneratorText:
+		return &generatedStream{next: func(b *bytes.Buffer) { writeParagraph(b, rng) }}, nil
+	case GeneratorWords:
+		return &generatedStream{next: func(b *bytes.Buffer) { b.WriteString(garbage.Nonsense(rng, 10)) }}, nil
+	case GeneratorHTML:
+		return &generatedStream{next: (&htmlGenerator{rng: rng}).next}, nil
+	default:
+		return nil, fmt.Errorf("unknown tarpit content generator '%s'", g.Generator)
+	}
+}
+
+// Size returns -1, as the content never ends.
+func (g GenerateReader) Size() int64 {
+	return -1
+}
+
+// Validate ensures the generator exists.
+func (g GenerateReader) Validate() error {
+	if !slices.Contains(Generators, g.Generator) {
+		return fmt.Errorf("unknown tarpit content generator '%s', expected one of %s", g.Generator,
+			strings.Join(Generators, ", "))
+	}
+	return nil
+}
+
+// generatedStream is an endless io.ReadCloser, generating content a piece at a time as it is read.
+type generatedStream struct {
+	buffer bytes.Buffer
+	// next writes the next piece of content.
+	next func(b *bytes.Buffer)
+}
+
+// Read implements the io.Reader interface.
+func (s *generatedStream) Read(b []byte) (int, error) {
+	for s.buffer.Len() < len(b) {
+		s.next(&s.buffer)
+	}
+	return s.buffer.Read(b)
+}
+
+// Close implements the io.Closer interface.
+func (s *generatedStream) Close() error {
+	return nil
+}
+
+// writeParagraph writes a paragraph of made-up words.
+func writeParagraph(b *bytes.Buffer, rng *rand.Rand) {
+	for range 3 + rng.IntN(5) {
+		writeSentence(b, rng)
+		b.WriteByte(' ')
+	}
+	b.Truncate(b.Len() - 1)
+	b.WriteString("\n\n")
+}
+
+// writeSentence writes a sentence of made-up words.
+func writeSentence(b *bytes.Buffer, rng *rand.Rand) {
+	words := 5 + rng.IntN(15)
+	for i := range words {
+		word := randomWord(rng)
+		if i == 0 {
+			word = capitalize(word)
+		}
+		b.WriteString(word)
+		switch {
+		case i == words-1 && rng.IntN(6) == 0:
+			b.WriteByte("!?"[rng.IntN(2)])
+		case i == words-1:
+			b.WriteByte('.')
+		case rng.IntN(8) == 0:
+			b.WriteString(", ")
+		default:
+			b.WriteByte(' ')
+		}
+	}
+}
+
+// randomWord returns a pronounceable made-up word.
+func randomWord(rng *rand.Rand) string {
+	const (
+		consonants = "bcdfghjklmnprstvwz"
+		vowels     = "aeiou"
+	)
+	var sb strings.Builder
+	for range 1 + rng.IntN(3) {
+		sb.WriteByte(consonants[rng.IntN(len(consonants))])
+		sb.WriteByte(vowels[rng.IntN(len(vowels))])
+	}
+	if rng.IntN(2) == 0 {
+		sb.WriteByte(consonants[rng.IntN(len(consonants))])
+	}
+	return sb.String()
+}
+
+// containers are the elements generated HTML nests.
+var containers = []string{"div", "section", "article", "main", "aside", "blockquote", "ul"}
+
+// htmlGenerator generates a never-ending HTML document, randomly opening, filling and closing nested elements but
+// never closing the body.
+type htmlGenerator struct {
+	rng     *rand.Rand
+	started bool
+	// open are the elements opened below body, innermost last.
+	open []string
+}
+
+// next writes the next piece of the document.
+func (h *htmlGenerator) next(b *bytes.Buffer) {
+	if !h.started {
+		h.started = true
+		b.WriteString("<!DOCTYPE html>\n<html lang=\"en\">\n<head><meta charset=\"utf-8\"><title>")
+		writeSentence(b, h.rng)
+		b.WriteString("</title></head>\n<body>\n")
+		return
+	}
+
+	inList := len(h.open) > 0 && h.open[len(h.open)-1] == "ul"
+	switch n := h.rng.IntN(10); {
+	case n < 3 && len(h.open) < maxHTMLDepth:
+		element := containers[h.rng.IntN(len(containers))]
+		if inList {
+			element = "li"
+		}
+		h.open = append(h.open, element)
+		fmt.Fprintf(b, "<%s>\n", element)
+	case n < 5 && len(h.open) > 0:
+		fmt.Fprintf(b, "</%s>\n", h.open[len(h.open)-1])
+		h.open = h.open[:len(h.open)-1]
+	case inList:
+		b.WriteString("<li>")
+		h.writeLink(b)
+		b.WriteString("</li>\n")
+	case n < 6:
+		b.WriteString("<h2>")
+		writeSentence(b, h.rng)
+		b.WriteString("</h2>\n")
+	default:
+		b.WriteString("<p>")
+		writeSentence(b, h.rng)
+		b.WriteByte(' ')
+		h.writeLink(b)
+		b.WriteByte(' ')
+		writeSentence(b, h.rng)
+		b.WriteString("</p>\n")
+	}
+}
+
+// writeLink writes a link to a made-up page.
+func (h *htmlGenerator) writeLink(b *bytes.Buffer) {
+	text := garbage.NonsenseWords(h.rng, 1+h.rng.IntN(3))
+	fmt.Fprintf(b, `<a href="/%s">%s</a>`, strings.ReplaceAll(text, " ", "-"), text)
+}
@@ -0,0 +1,109 @@
+package tarpit
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
+)
+
+func TestGenerateReader(t *testing.T) {
+	for _, generator := range Generators {
+		t.Run(generator, func(t *testing.T) {
+			reader := GenerateReader{Generator: generator}
+			require.NoError(t, reader.Validate())
+			require.Equal(t, int64(-1), reader.Size())
+
+			content, err := reader.Read()
+			require.NoError(t, err)
+			defer content.Close()
+
+			// The content doesn't end, and reads of any size are filled
+			for _, size := range []int{1, 512, 64 * 1024, 1 << 20} {
+				n, err := io.ReadFull(content, make([]byte, size))
+				require.NoError(t, err)
+				require.Equal(t, size, n)
+			}
+		})
+	}
+
+	// Each read is seeded anew
+	reader := GenerateReader{Generator: GeneratorText}
+	first, second := make([]byte, 256), make([]byte, 256)
+	a, err := reader.Read()
+	require.NoError(t, err)
+	b, err := reader.Read()
+	require.NoError(t, err)
+	_, _ = io.ReadFull(a, first)
+	_, _ = io.ReadFull(b, second)
+	require.NotEqual(t, first, second)
+}
+
+func TestGenerateReaderHTML(t *testing.T) {
+	content, err := GenerateReader{Generator: GeneratorHTML}.Read()
+	require.NoError(t, err)
+	data := make([]byte, 1<<20)
+	_, err = io.ReadFull(content, data)
+	require.NoError(t, err)
+	require.Equal(t, "text/html; charset=utf-8", http.DetectContentType(data[:512]))
+
+	// Nested elements are properly closed, and the body never is
+	nested := append([]string{"li"}, containers...)
+	tokenizer := html.NewTokenizer(bytes.NewReader(data))
+	var open []string
+	deepest := 0
+	for tokenizer.Next() != html.ErrorToken {
+		token := tokenizer.Token()
+		switch token.Type {
+		case html.StartTagToken:
+			if slices.Contains(nested, token.Data) {
+				open = append(open, token.Data)
+				deepest = max(deepest, len(open))
+			}
+		case html.EndTagToken:
+			require.NotContains(t, []string{"body", "html"}, token.Data)
+			if slices.Contains(nested, token.Data) {
+				require.NotEmpty(t, open)
+				require.Equal(t, open[len(open)-1], token.Data)
+				open = open[:len(open)-1]
+			}
+		}
+	}
+	require.Greater(t, deepest, 3)
+	// List items of links are one deeper
+	require.LessOrEqual(t, deepest, maxHTMLDepth+1)
+	require.Contains(t, string(data), "<a href=")
+}
+
+func TestGenerateReaderInvalid(t *testing.T) {
+	require.ErrorContains(t, GenerateReader{Generator: "lorem"}.Validate(), "unknown tarpit content generator 'lorem'")
+	_, err := GenerateReader{Generator: "lorem"}.Read()
+	require.Error(t, err)
+
+	responder := newTestResponder(Content{Protocol: "generate", Path: "lorem"}, time.Second)
+	require.Error(t, responder.ConfigureContentReader())
+	responder.Config.Content.Path = GeneratorHTML
+	require.NoError(t, responder.ConfigureContentReader())
+	require.Equal(t, GenerateReader{Generator: GeneratorHTML}, responder.ContentReader)
+}
+
+func TestServeHTTPGenerated(t *testing.T) {
+	responder := &Responder{
+		Config: &Config{
+			Timeout:        time.Second,
+			BytesPerSecond: 1000,
+			ResponseCode:   http.StatusOK,
+		},
+		ContentReader: GenerateReader{Generator: GeneratorWords},
+	}
+	// The content lasts until the timeout
+	rec := serveScheduled(t, responder, 10)
+	require.Equal(t, 900, rec.Len())
+	require.True(t, strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain"))
+}
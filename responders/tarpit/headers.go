@@ -0,0 +1,73 @@
+//nolint:gosec
+package tarpit
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// serveHeaders dribbles a status line and endless headers over a hijacked connection until the timeout, the client
+// disconnects or the config is unloaded. It returns the number of bytes written.
+func (r *Responder) serveHeaders(conn net.Conn, scheduler *Scheduler, start time.Time) int64 {
+	return r.serveConn(conn, newHeaderReader(r.Config), scheduler, start)
+}
+
+// newHeaderReader returns an endless stream of the status line, the configured headers and plausible generated
+// headers, never ending the header section.
+func newHeaderReader(config *Config) io.ReadCloser {
+	header := http.Header{}
+	header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	for key, value := range config.Headers {
+		header.Set(key, value)
+	}
+
+	var preamble bytes.Buffer
+	fmt.Fprintf(&preamble, "HTTP/1.1 %d %s\r\n", config.ResponseCode, http.StatusText(config.ResponseCode))
+	_ = header.Write(&preamble)
+
+	rng := rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	return &generatedStream{next: func(b *bytes.Buffer) {
+		if preamble.Len() > 0 {
+			_, _ = preamble.WriteTo(b)
+			return
+		}
+		writeHeaderLine(b, rng)
+	}}
+}
+
+// writeHeaderLine writes a plausible header line, such as a cookie or a preload link.
+func writeHeaderLine(b *bytes.Buffer, rng *rand.Rand) {
+	switch rng.IntN(8) {
+	case 0:
+		fmt.Fprintf(b, "Set-Cookie: %s_%x=%x; Path=/; Max-Age=%d; HttpOnly; SameSite=Lax\r\n",
+			randomWord(rng), rng.Uint32(), rng.Uint64(), 60*(1+rng.IntN(1440)))
+	case 1:
+		fmt.Fprintf(b, "Link: </%s/%s.css>; rel=preload; as=style\r\n", randomWord(rng), randomWord(rng))
+	case 2:
+		fmt.Fprintf(b, "X-Request-Id: %08x-%04x-%04x-%04x-%012x\r\n",
+			rng.Uint32(), rng.Uint32N(1<<16), rng.Uint32N(1<<16), rng.Uint32N(1<<16), rng.Uint64N(1<<48))
+	case 3:
+		fmt.Fprintf(b, "Server-Timing: %s;dur=%.1f\r\n", randomWord(rng), rng.Float64()*100)
+	case 4:
+		fmt.Fprintf(b, "ETag: W/\"%x\"\r\n", rng.Uint64())
+	case 5:
+		fmt.Fprintf(b, "X-Cache: %s from %s-%d\r\n", []string{"HIT", "MISS"}[rng.IntN(2)], randomWord(rng),
+			rng.IntN(100))
+	case 6:
+		fmt.Fprintf(b, "Vary: %s\r\n", []string{"Accept-Encoding", "Cookie", "Origin", "User-Agent"}[rng.IntN(4)])
+	default:
+		fmt.Fprintf(b, "X-%s-%s: %s\r\n", capitalize(randomWord(rng)), capitalize(randomWord(rng)), randomWord(rng))
+	}
+}
+
+// capitalize returns a word with its first letter in uppercase.
+func capitalize(word string) string {
+	return strings.ToUpper(word[:1]) + word[1:]
+}
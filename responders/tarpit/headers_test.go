@@ -0,0 +1,226 @@
+package tarpit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/stretchr/testify/require"
+)
+
+// headerLine matches a header line, as opposed to the blank line ending the header section.
+var headerLine = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9-]*: [\x20-\x7e]+\r\n$`)
+
+// newHeaderResponder returns a responder dribbling headers, on a scheduler of its own.
+func newHeaderResponder(bytesPerSecond float64, timeout time.Duration) *Responder {
+	return &Responder{
+		Config: &Config{
+			Headers:        map[string]string{"X-You-Got": "Played"},
+			Timeout:        timeout,
+			BytesPerSecond: bytesPerSecond,
+			ResponseCode:   http.StatusOK,
+			Mode:           ModeHeaders,
+		},
+		ContentReader: &mockReadCloser{data: []byte("Hello, World!")},
+		Scheduler:     NewScheduler(RealClock, 10*time.Millisecond, 1),
+	}
+}
+
+// newHeaderServer returns a test server of a responder, which reports on finished once each response ends.
+func newHeaderServer(t *testing.T, responder *Responder, finished chan<- error) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		finished <- responder.ServeHTTP(w, r, nil)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// dialRequest opens a raw connection to a server and sends an HTTP/1.1 request over it.
+func dialRequest(t *testing.T, server *httptest.Server) net.Conn {
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(10*time.Second)))
+	_, err = fmt.Fprint(conn, "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	require.NoError(t, err)
+	return conn
+}
+
+func TestServeHeaders(t *testing.T) {
+	t.Run("EndlessHeaders", func(t *testing.T) {
+		finished := make(chan error, 1)
+		server := newHeaderServer(t, newHeaderResponder(500, time.Second), finished)
+		conn := dialRequest(t, server)
+
+		start := time.Now()
+		reader := bufio.NewReader(conn)
+		status, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		require.Equal(t, "HTTP/1.1 200 OK\r\n", status)
+
+		// Headers keep coming until the timeout closes the connection, and never end
+		var headers []string
+		total := len(status)
+		for {
+			line, err := reader.ReadString('\n')
+			total += len(line)
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			require.Regexp(t, headerLine, line)
+			headers = append(headers, line)
+		}
+		require.Contains(t, headers, "X-You-Got: Played\r\n")
+		require.Contains(t, headers, "Content-Type: text/html; charset=utf-8\r\n")
+		// Beyond the Date, Content-Type and configured headers
+		require.Greater(t, len(headers), 5)
+
+		// Headers are paced like content
+		require.GreaterOrEqual(t, time.Since(start), 900*time.Millisecond)
+		require.LessOrEqual(t, total, 600)
+		require.NoError(t, requireFinished(t, finished))
+	})
+
+	t.Run("ClientHeaderTimeout", func(t *testing.T) {
+		finished := make(chan error, 1)
+		server := newHeaderServer(t, newHeaderResponder(100, time.Minute), finished)
+		client := &http.Client{Transport: &http.Transport{ResponseHeaderTimeout: 200 * time.Millisecond}}
+
+		// However short their header timeout, clients never get a response
+		_, err := client.Get(server.URL)
+		require.ErrorContains(t, err, "timeout awaiting response headers")
+		require.NoError(t, requireFinished(t, finished))
+	})
+
+	t.Run("ClientDisconnect", func(t *testing.T) {
+		before := runtime.NumGoroutine()
+		finished := make(chan error, 1)
+		responder := newHeaderResponder(100, time.Minute)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			finished <- responder.ServeHTTP(w, r, nil)
+		}))
+
+		conn := dialRequest(t, server)
+		_, err := io.ReadFull(conn, make([]byte, 16))
+		require.NoError(t, err)
+		conn.Close()
+
+		require.NoError(t, requireFinished(t, finished))
+		require.Eventually(t, func() bool { return responder.Scheduler.Active() == 0 }, time.Second, time.Millisecond)
+		server.Close()
+		requireGoroutinesExit(t, before)
+	})
+
+	t.Run("ConfigUnloaded", func(t *testing.T) {
+		finished := make(chan error, 1)
+		responder := newHeaderResponder(100, time.Minute)
+		ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+		require.NoError(t, responder.Provision(ctx))
+		server := newHeaderServer(t, responder, finished)
+
+		conn := dialRequest(t, server)
+		_, err := io.ReadFull(conn, make([]byte, 16))
+		require.NoError(t, err)
+		cancel()
+
+		require.NoError(t, requireFinished(t, finished))
+		_, err = io.ReadAll(conn)
+		require.NoError(t, err, "expected the connection to be closed")
+	})
+
+	t.Run("ServerTimeouts", func(t *testing.T) {
+		finished := make(chan error, 1)
+		responder := newHeaderResponder(100, 500*time.Millisecond)
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			finished <- responder.ServeHTTP(w, r, nil)
+		}))
+		// The tarpit outlasts the server's timeouts, which a taken over connection doesn't keep
+		server.Config.ReadTimeout = 100 * time.Millisecond
+		server.Config.WriteTimeout = 100 * time.Millisecond
+		server.Start()
+		t.Cleanup(server.Close)
+
+		conn := dialRequest(t, server)
+		start := time.Now()
+		_, err := io.ReadAll(conn)
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, time.Since(start), 450*time.Millisecond)
+		require.NoError(t, requireFinished(t, finished))
+	})
+
+	t.Run("ClientHalfClose", func(t *testing.T) {
+		finished := make(chan error, 1)
+		server := newHeaderServer(t, newHeaderResponder(100, 500*time.Millisecond), finished)
+
+		// The client is done sending, but still reads the headers until the timeout
+		conn := dialRequest(t, server)
+		require.NoError(t, conn.(*net.TCPConn).CloseWrite())
+		start := time.Now()
+		data, err := io.ReadAll(conn)
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, time.Since(start), 450*time.Millisecond)
+		require.Greater(t, len(data), 20)
+		require.NoError(t, requireFinished(t, finished))
+	})
+
+	t.Run("HTTP2Fallback", func(t *testing.T) {
+		// HTTP/2 frames headers and multiplexes connections, so the content is tarpitted instead
+		for _, mode := range []string{ModeHeaders, ModeSocket} {
+			finished := make(chan error, 1)
+			responder := newHeaderResponder(1000, time.Second)
+			responder.Config.Mode = mode
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				finished <- responder.ServeHTTP(w, r, nil)
+			}))
+			server.EnableHTTP2 = true
+			server.StartTLS()
+			t.Cleanup(server.Close)
+
+			resp, err := server.Client().Get(server.URL)
+			require.NoError(t, err)
+			require.Equal(t, 2, resp.ProtoMajor)
+			require.Equal(t, "Played", resp.Header.Get("X-You-Got"))
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			require.NoError(t, err)
+			require.Equal(t, "Hello, World!", string(body), mode)
+			require.NoError(t, requireFinished(t, finished))
+		}
+	})
+}
+
+func TestHeaderReader(t *testing.T) {
+	reader := newHeaderReader(&Config{ResponseCode: http.StatusNotFound})
+	lines := bufio.NewReader(io.LimitReader(reader, 64<<10))
+	status, err := lines.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "HTTP/1.1 404 Not Found\r\n", status)
+	for {
+		line, err := lines.ReadString('\n')
+		if err == io.EOF {
+			// Cut off by the limit
+			require.False(t, strings.HasSuffix(line, "\n"))
+			break
+		}
+		require.NoError(t, err)
+		require.Regexp(t, headerLine, line)
+	}
+}
+
+func TestValidateMode(t *testing.T) {
+	responder := newHeaderResponder(1, time.Second)
+	require.NoError(t, responder.Validate())
+	responder.Config.Mode = "trailers"
+	require.ErrorContains(t, responder.Validate(), "unknown tarpit mode 'trailers'")
+}
@@ -1,65 +1,248 @@
 package tarpit
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/jasonlovesdoggo/caddy-defender/cache"
 )
 
-// HTTPReader implements the ContentReader interface and reads remote files over http.
+const (
+	// DefaultCacheTTL is how long a cached remote file is used before it is revalidated.
+	DefaultCacheTTL = 24 * time.Hour
+	// DefaultFetchTimeout is how long fetching a remote file may take.
+	DefaultFetchTimeout = 30 * time.Second
+	// DefaultMaxContentSize is the size of the largest remote file fetched.
+	DefaultMaxContentSize = 100 << 20
+	// staleRetryInterval is how long a stale cached file is used without trying the origin again after failing to
+	// revalidate it, so requests don't each wait on another fetch while the origin is down.
+	staleRetryInterval = time.Minute
+)
+
+// ErrContentTooLarge is returned when a remote file is larger than the maximum content size.
+var ErrContentTooLarge = errors.New("tarpit content is larger than max_content_size")
+
+// HTTPReader implements the ContentReader interface and reads remote files over http. Files are cached, and
+// revalidated with the origin with their ETag or Last-Modified date once the TTL has passed.
 type HTTPReader struct {
 	Cache *cache.Cache
 	URL   string
+	// TTL is how long a cached file is used before it is revalidated. Default: DefaultCacheTTL
+	TTL time.Duration
+	// Timeout is how long fetching the file may take. Default: DefaultFetchTimeout
+	Timeout time.Duration
+	// MaxSize is the size of the largest file fetched. Default: DefaultMaxContentSize
+	MaxSize int64
+	// StaleIfError uses the cached file, however old, when the origin is unreachable or fails, so Caddy can start
+	// and keep tarpitting while it is down.
+	StaleIfError bool
+}
+
+// httpMetadata is what is cached alongside a remote file to revalidate it.
+type httpMetadata struct {
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Fetched      time.Time `json:"fetched"`
+	// RetryAfter is when the origin is tried again after failing to revalidate a stale file.
+	RetryAfter time.Time `json:"retry_after"`
 }
 
-// Read opens a file for streaming.
+// fresh reports whether the cached file is used as is, being fresh or waiting for the origin to be retried.
+func (m httpMetadata) fresh(ttl time.Duration) bool {
+	return time.Since(m.Fetched) < ttl || time.Now().Before(m.RetryAfter)
+}
+
+// Read opens the cached file for streaming, fetching it first if it isn't cached or is stale.
 func (h HTTPReader) Read() (io.ReadCloser, error) {
+	if err := h.refresh(); err != nil {
+		return nil, err
+	}
+
 	reader, ok, err := h.Cache.Get(h.URL)
+	if err == nil && !ok {
+		// Found corrupt and removed, so it is fetched again
+		if err := h.refresh(); err != nil {
+			return nil, err
+		}
+		reader, ok, err = h.Cache.Get(h.URL)
+	}
 	if err != nil {
 		return nil, err
 	}
+	if !ok {
+		return nil, fmt.Errorf("tarpit content '%s' is missing from the cache", h.URL)
+	}
+	return reader, nil
+}
 
-	// Return if in the cache
-	if ok {
-		return reader, nil
+// Size returns the size of the remote file once it is cached, or -1.
+func (h HTTPReader) Size() int64 {
+	reader, ok, err := h.Cache.Get(h.URL)
+	if err != nil || !ok {
+		return -1
 	}
+	defer reader.Close()
+	return sizeOf(reader)
+}
 
-	// If not in cache, set it
-	// Get the data
-	resp, err := http.Get(h.URL)
+// Validate ensures the remote file can be fetched, caching it. With StaleIfError, a cached copy is enough when the
+// origin is unreachable.
+func (h HTTPReader) Validate() error {
+	u, err := url.Parse(h.URL)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer resp.Body.Close()
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid tarpit content URL '%s'", h.URL)
+	}
+	return h.refresh()
+}
 
-	// Check server response
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("bad status: %s", resp.Status)
+// refresh fetches the remote file into the cache, unless the cached copy is fresh or still valid. Concurrent
+// refreshes fetch the file once.
+func (h HTTPReader) refresh() error {
+	if meta, cached := h.metadata(); cached && meta.fresh(h.ttl()) {
+		return nil
 	}
 
-	// If not in cache, set it, then return reader
-	err = h.Cache.Set(h.URL, resp.Body)
+	unlock, err := h.Cache.Lock(h.URL)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	defer unlock()
+	// Refreshed while waiting for the lock
+	meta, cached := h.metadata()
+	if cached && meta.fresh(h.ttl()) {
+		return nil
 	}
 
-	// After setting the cache, try again
-	reader, _, err = h.Cache.Get(h.URL)
+	err = h.fetch(meta, cached)
+	if err != nil && cached && h.StaleIfError {
+		// Failing to record the attempt only means the origin is tried again sooner
+		meta.RetryAfter = time.Now().Add(min(staleRetryInterval, h.ttl()))
+		_ = h.setMetadata(meta)
+		return nil
+	}
+	return err
+}
+
+// fetch requests the remote file, conditionally if it is cached, and caches the response.
+func (h HTTPReader) fetch(meta httpMetadata, cached bool) error {
+	req, err := http.NewRequest(http.MethodGet, h.URL, nil)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if cached {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
 	}
 
-	return reader, nil
+	resp, err := h.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached:
+		meta.Fetched, meta.RetryAfter = time.Now(), time.Time{}
+		return h.setMetadata(meta)
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("bad status: %s", resp.Status)
+	case resp.ContentLength > h.maxSize():
+		return ErrContentTooLarge
+	}
+
+	// A file cut off by the size cap isn't cached, leaving the previous version in place
+	err = h.Cache.Set(h.URL, io.NopCloser(&cappedReader{reader: resp.Body, remaining: h.maxSize()}))
+	if err != nil {
+		return err
+	}
+	return h.setMetadata(httpMetadata{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Fetched:      time.Now(),
+	})
 }
 
-// Validate ensures the remote file is accessible.
-func (h HTTPReader) Validate() error {
-	resp, err := http.Head(h.URL)
+// metadata returns the metadata of the cached file, and whether the file is cached.
+func (h HTTPReader) metadata() (httpMetadata, bool) {
+	var meta httpMetadata
+	reader, ok, err := h.Cache.Get(metadataKey(h.URL))
+	if err != nil || !ok {
+		return meta, false
+	}
+	defer reader.Close()
+	if err := json.NewDecoder(reader).Decode(&meta); err != nil {
+		return meta, false
+	}
+
+	// The file is only checked, as loading it for every request can be costly, such as from a shared storage
+	if ok, err := h.Cache.Exists(h.URL); err != nil || !ok {
+		return meta, false
+	}
+	return meta, true
+}
+
+func (h HTTPReader) setMetadata(meta httpMetadata) error {
+	data, err := json.Marshal(meta)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	return nil
+	return h.Cache.Set(metadataKey(h.URL), io.NopCloser(bytes.NewReader(data)))
+}
+
+// metadataKey returns the cache key of the metadata of a URL.
+func metadataKey(url string) string {
+	return "metadata:" + url
+}
+
+func (h HTTPReader) client() *http.Client {
+	timeout := h.Timeout
+	if timeout == 0 {
+		timeout = DefaultFetchTimeout
+	}
+	return &http.Client{Timeout: timeout}
+}
+
+func (h HTTPReader) ttl() time.Duration {
+	if h.TTL == 0 {
+		return DefaultCacheTTL
+	}
+	return h.TTL
+}
+
+func (h HTTPReader) maxSize() int64 {
+	if h.MaxSize == 0 {
+		return DefaultMaxContentSize
+	}
+	return h.MaxSize
+}
+
+// cappedReader reads up to a number of bytes, failing with ErrContentTooLarge rather than stopping after them.
+type cappedReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (c *cappedReader) Read(b []byte) (int, error) {
+	if int64(len(b)) > c.remaining+1 {
+		b = b[:c.remaining+1]
+	}
+	n, err := c.reader.Read(b)
+	c.remaining -= int64(n)
+	if c.remaining < 0 {
+		return 0, ErrContentTooLarge
+	}
+	return n, err
 }
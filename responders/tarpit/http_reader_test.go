@@ -1,22 +1,32 @@
 package tarpit
 
 import (
+	"context"
+	"crypto/md5" // nolint:gosec // The cache names files by the md5 of their key
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/caddyserver/certmagic"
 	"github.com/jasonlovesdoggo/caddy-defender/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // Helper function to create a test cache instance
-func newTestCache() *cache.Cache {
-	return cache.New(&cache.Config{Directory: "test_cache"})
+func newTestCache(t *testing.T) *cache.Cache {
+	return cache.New(&cache.Config{Root: t.TempDir(), Directory: "test_cache"})
 }
 
 func TestHTTPReader(t *testing.T) {
 	// Create a test cache
-	cache := newTestCache()
+	cache := newTestCache(t)
 
 	t.Run("ValidURL", func(t *testing.T) {
 		testValidURL(t, cache)
@@ -113,11 +123,11 @@ func testBadHTTPStatus(t *testing.T, cache *cache.Cache) {
 		Cache: cache,
 	}
 
-	// Test Validate method (should succeed, as the head request will pass)
+	// Test Validate method (should fail, as the content can't be fetched)
 	t.Run("Validate", func(t *testing.T) {
 		err := httpReader.Validate()
-		if err != nil {
-			t.Errorf("Expected no error from Validate, but got: %v", err)
+		if err == nil {
+			t.Errorf("Expected error from Validate with bad HTTP status, but got none")
 		}
 	})
 
@@ -188,3 +198,273 @@ func testCacheMissThenSet(t *testing.T, cache *cache.Cache) {
 		}
 	})
 }
+
+// origin is a test server of a revalidatable file.
+type origin struct {
+	mu       sync.Mutex
+	body     string
+	etag     string
+	down     bool
+	requests atomic.Int64
+	notMod   atomic.Int64
+}
+
+func (o *origin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	o.requests.Add(1)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.down {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	if r.Header.Get("If-None-Match") == o.etag {
+		o.notMod.Add(1)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", o.etag)
+	_, _ = io.WriteString(w, o.body)
+}
+
+func (o *origin) set(body, etag string, down bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.body, o.etag, o.down = body, etag, down
+}
+
+func readAll(t *testing.T, reader ContentReader) string {
+	t.Helper()
+	content, err := reader.Read()
+	require.NoError(t, err)
+	defer content.Close()
+	data, err := io.ReadAll(content)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestHTTPReaderTTL(t *testing.T) {
+	o := &origin{body: "v1", etag: `"1"`}
+	server := httptest.NewServer(o)
+	defer server.Close()
+
+	reader := HTTPReader{URL: server.URL, Cache: newTestCache(t), TTL: time.Hour}
+	require.NoError(t, reader.Validate())
+	require.Equal(t, "v1", readAll(t, reader))
+	require.Equal(t, "v1", readAll(t, reader))
+	// The file is fetched once while it is fresh
+	require.Equal(t, int64(1), o.requests.Load())
+	require.Equal(t, int64(2), reader.Size())
+}
+
+func TestHTTPReaderRevalidation(t *testing.T) {
+	o := &origin{body: "v1", etag: `"1"`}
+	server := httptest.NewServer(o)
+	defer server.Close()
+
+	// Always stale
+	reader := HTTPReader{URL: server.URL, Cache: newTestCache(t), TTL: time.Nanosecond}
+	require.Equal(t, "v1", readAll(t, reader))
+	require.Equal(t, "v1", readAll(t, reader))
+	require.Equal(t, int64(1), o.notMod.Load(), "unchanged file isn't revalidated with its ETag")
+
+	o.set("v2", `"2"`, false)
+	require.Equal(t, "v2", readAll(t, reader))
+}
+
+func TestHTTPReaderLastModified(t *testing.T) {
+	modified := time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC)
+	var conditional atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-Modified-Since") != "" {
+			conditional.Add(1)
+		}
+		http.ServeContent(w, r, "", modified, strings.NewReader("content"))
+	}))
+	defer server.Close()
+
+	reader := HTTPReader{URL: server.URL, Cache: newTestCache(t), TTL: time.Nanosecond}
+	require.Equal(t, "content", readAll(t, reader))
+	require.Equal(t, "content", readAll(t, reader))
+	require.Equal(t, int64(1), conditional.Load())
+}
+
+func TestHTTPReaderStaleIfError(t *testing.T) {
+	o := &origin{body: "v1", etag: `"1"`}
+	server := httptest.NewServer(o)
+	c := newTestCache(t)
+
+	reader := HTTPReader{URL: server.URL, Cache: c, TTL: time.Nanosecond}
+	require.NoError(t, reader.Validate())
+
+	// The origin fails
+	o.set("", "", true)
+	require.ErrorContains(t, reader.Validate(), "bad status: 502")
+	reader.StaleIfError = true
+	require.NoError(t, reader.Validate())
+	require.Equal(t, "v1", readAll(t, reader))
+
+	// The origin is unreachable, such as when Caddy starts offline
+	server.Close()
+	require.NoError(t, reader.Validate())
+	require.Equal(t, "v1", readAll(t, reader))
+
+	// Without a cached copy, there is nothing to start from
+	reader.Cache = newTestCache(t)
+	require.Error(t, reader.Validate())
+}
+
+func TestHTTPReaderStaleRetry(t *testing.T) {
+	o := &origin{body: "v1", etag: `"1"`}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if o.requests.Load() > 0 {
+			// Down, and slow to say so
+			time.Sleep(50 * time.Millisecond)
+			o.set("", "", true)
+		}
+		o.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	ttl := 200 * time.Millisecond
+	reader := HTTPReader{URL: server.URL, Cache: newTestCache(t), TTL: ttl, StaleIfError: true}
+	require.NoError(t, reader.Validate())
+	time.Sleep(ttl)
+
+	// Requests for the stale file don't each wait on another fetch from the failing origin
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			content, err := reader.Read()
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer content.Close()
+			data, err := io.ReadAll(content)
+			assert.NoError(t, err)
+			assert.Equal(t, "v1", string(data))
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, "v1", readAll(t, reader))
+	require.Equal(t, int64(2), o.requests.Load())
+
+	// The origin is tried again later
+	time.Sleep(ttl)
+	require.Equal(t, "v1", readAll(t, reader))
+	require.Equal(t, int64(3), o.requests.Load())
+}
+
+func TestHTTPReaderLimits(t *testing.T) {
+	big := strings.Repeat("a", 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		case "/chunked":
+			// Without a Content-Length, the size is only known once read
+			w.(http.Flusher).Flush()
+		default:
+			w.Header().Set("Content-Length", fmt.Sprint(len(big)))
+		}
+		_, _ = io.WriteString(w, big)
+	}))
+	defer server.Close()
+	c := newTestCache(t)
+
+	reader := HTTPReader{URL: server.URL + "/slow", Cache: c, Timeout: 50 * time.Millisecond}
+	require.Error(t, reader.Validate())
+
+	for _, path := range []string{"/sized", "/chunked"} {
+		reader = HTTPReader{URL: server.URL + path, Cache: c, MaxSize: 999}
+		require.ErrorIs(t, reader.Validate(), ErrContentTooLarge, path)
+		// Nothing is cached
+		_, ok, err := c.Get(reader.URL)
+		require.NoError(t, err)
+		require.False(t, ok, path)
+
+		reader.MaxSize = 1000
+		require.Equal(t, big, readAll(t, reader), path)
+
+		// A refresh failing on the cap leaves the previous version in place
+		reader.MaxSize = 999
+		reader.TTL = time.Nanosecond
+		reader.StaleIfError = true
+		require.Equal(t, big, readAll(t, reader), path)
+	}
+
+	require.ErrorContains(t, HTTPReader{URL: "ftp://example.com/file", Cache: c}.Validate(), "invalid tarpit content URL")
+}
+
+func TestHTTPReaderConcurrentFill(t *testing.T) {
+	o := &origin{body: "v1", etag: `"1"`}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		o.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	reader := HTTPReader{URL: server.URL, Cache: newTestCache(t), TTL: time.Hour}
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			content, err := reader.Read()
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer content.Close()
+			data, err := io.ReadAll(content)
+			assert.NoError(t, err)
+			assert.Equal(t, "v1", string(data))
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int64(1), o.requests.Load())
+}
+
+func TestHTTPReaderSharedStorage(t *testing.T) {
+	o := &origin{body: "v1", etag: `"1"`}
+	server := httptest.NewServer(o)
+	defer server.Close()
+
+	// Nodes of a cluster sharing Caddy's storage fetch the content once
+	storage := &certmagic.FileStorage{Path: t.TempDir()}
+	for range 2 {
+		content := Content{Protocol: "http", Path: strings.TrimPrefix(server.URL, "http://")}
+		responder := newTestResponder(content, time.Second)
+		responder.Config.Cache = &cache.Config{Backend: cache.BackendStorage}
+		responder.Storage = storage
+		require.NoError(t, responder.ConfigureContentReader())
+
+		reader, err := responder.ContentReader.Read()
+		require.NoError(t, err)
+		data, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		reader.Close()
+		require.Equal(t, "v1", string(data))
+		require.Equal(t, int64(2), responder.ContentReader.Size())
+	}
+	require.Equal(t, int64(1), o.requests.Load())
+
+	// Content found corrupt when read is fetched again
+	key := fmt.Sprintf("caddy-defender/cache/tarpit/%x", md5.Sum([]byte(server.URL)))
+	require.NoError(t, storage.Store(context.Background(), key, []byte("corrupt")))
+	responder := newTestResponder(Content{Protocol: "http", Path: strings.TrimPrefix(server.URL, "http://")}, time.Second)
+	responder.Config.Cache = &cache.Config{Backend: cache.BackendStorage}
+	responder.Storage = storage
+	require.NoError(t, responder.ConfigureContentReader())
+	reader, err := responder.ContentReader.Read()
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, "v1", string(data))
+	require.Equal(t, int64(2), o.requests.Load())
+
+	// Without Caddy's storage, the storage backend can't be used
+	responder = newTestResponder(Content{Protocol: "http", Path: "example.com"}, time.Second)
+	responder.Config.Cache = &cache.Config{Backend: cache.BackendStorage}
+	require.ErrorContains(t, responder.ConfigureContentReader(), "requires Caddy's storage")
+}
@@ -0,0 +1,112 @@
+package tarpit
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrCapacity is returned when a request exceeds the tarpit's connection limits and there is no fallback.
+var ErrCapacity = errors.New("tarpit connection limit reached")
+
+// Limiter caps the number of concurrently tarpitted connections, both in total and per client IP, and keeps track
+// of the current occupancy.
+type Limiter struct {
+	// max and maxPerIP are the limits. 0 means unlimited.
+	max      int
+	maxPerIP int
+
+	mu    sync.Mutex
+	total int
+	perIP map[string]int
+
+	// connections and rejected are nil unless metrics are registered.
+	connections prometheus.Gauge
+	rejected    prometheus.Counter
+}
+
+// NewLimiter returns a new Limiter. A limit of 0 means unlimited.
+func NewLimiter(max, maxPerIP int) *Limiter {
+	return &Limiter{max: max, maxPerIP: maxPerIP, perIP: make(map[string]int)}
+}
+
+// Acquire takes a connection slot for an IP. If none is left, it reports false, otherwise the returned function
+// must be called to give the slot back once the connection ends.
+func (l *Limiter) Acquire(ip string) (func(), bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if (l.max > 0 && l.total >= l.max) || (l.maxPerIP > 0 && l.perIP[ip] >= l.maxPerIP) {
+		if l.rejected != nil {
+			l.rejected.Inc()
+		}
+		return nil, false
+	}
+	l.total++
+	l.perIP[ip]++
+	if l.connections != nil {
+		l.connections.Inc()
+	}
+
+	var once sync.Once
+	return func() { once.Do(func() { l.release(ip) }) }, true
+}
+
+func (l *Limiter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.total--
+	if l.perIP[ip]--; l.perIP[ip] <= 0 {
+		delete(l.perIP, ip)
+	}
+	if l.connections != nil {
+		l.connections.Dec()
+	}
+}
+
+// Occupancy returns the number of connections currently tarpitted.
+func (l *Limiter) Occupancy() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.total
+}
+
+// OccupancyOf returns the number of connections of an IP currently tarpitted.
+func (l *Limiter) OccupancyOf(ip string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.perIP[ip]
+}
+
+// RegisterMetrics exposes the occupancy as the caddy_defender_tarpit_connections gauge and the rejected connections
+// as the caddy_defender_tarpit_rejected_total counter. Limiters of several handlers registering with the same
+// registry share them.
+func (l *Limiter) RegisterMetrics(registry prometheus.Registerer) {
+	l.connections = register(registry, prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "caddy",
+		Subsystem: "defender",
+		Name:      "tarpit_connections",
+		Help:      "Number of connections currently tarpitted.",
+	}))
+	l.rejected = register(registry, prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "caddy",
+		Subsystem: "defender",
+		Name:      "tarpit_rejected_total",
+		Help:      "Number of connections which exceeded the tarpit's connection limits.",
+	}))
+}
+
+// register registers a collector, or returns the one registered before under the same name.
+func register[T prometheus.Collector](registry prometheus.Registerer, collector T) T {
+	if err := registry.Register(collector); err != nil {
+		var registered prometheus.AlreadyRegisteredError
+		if errors.As(err, &registered) {
+			if existing, ok := registered.ExistingCollector.(T); ok {
+				return existing
+			}
+		}
+	}
+	return collector
+}
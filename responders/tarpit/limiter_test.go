@@ -0,0 +1,178 @@
+package tarpit
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(3, 2)
+
+	releaseA1, ok := l.Acquire("a")
+	require.True(t, ok)
+	_, ok = l.Acquire("a")
+	require.True(t, ok)
+	_, ok = l.Acquire("a")
+	require.False(t, ok, "per-IP limit")
+
+	_, ok = l.Acquire("b")
+	require.True(t, ok)
+	_, ok = l.Acquire("c")
+	require.False(t, ok, "global limit")
+	require.Equal(t, 3, l.Occupancy())
+
+	// Releasing twice only gives back one slot
+	releaseA1()
+	releaseA1()
+	require.Equal(t, 2, l.Occupancy())
+	require.Equal(t, 1, l.OccupancyOf("a"))
+	_, ok = l.Acquire("c")
+	require.True(t, ok)
+}
+
+func TestLimiterConcurrent(t *testing.T) {
+	const (
+		maxConnections = 20
+		maxPerIP       = 3
+		clients        = 50
+		attempts       = 200
+	)
+	l := NewLimiter(maxConnections, maxPerIP)
+
+	var peak, perIPExceeded atomic.Int64
+	var wg sync.WaitGroup
+	for i := range clients {
+		ip := fmt.Sprintf("192.0.2.%d", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range attempts {
+				release, ok := l.Acquire(ip)
+				if !ok {
+					continue
+				}
+				if occupancy := int64(l.Occupancy()); occupancy > peak.Load() {
+					peak.Store(occupancy)
+				}
+				if l.OccupancyOf(ip) > maxPerIP {
+					perIPExceeded.Add(1)
+				}
+				time.Sleep(time.Microsecond)
+				release()
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.LessOrEqual(t, peak.Load(), int64(maxConnections))
+	require.Zero(t, perIPExceeded.Load())
+	require.Zero(t, l.Occupancy())
+}
+
+func TestLimiterMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	l := NewLimiter(1, 0)
+	l.RegisterMetrics(registry)
+	// A second limiter registering with the same registry shares the metrics
+	other := NewLimiter(0, 0)
+	other.RegisterMetrics(registry)
+
+	release, ok := l.Acquire("a")
+	require.True(t, ok)
+	_, ok = l.Acquire("b")
+	require.False(t, ok)
+	_, ok = other.Acquire("c")
+	require.True(t, ok)
+	require.InDelta(t, 2, testutil.ToFloat64(l.connections), 0)
+	require.InDelta(t, 1, testutil.ToFloat64(l.rejected), 0)
+
+	release()
+	require.InDelta(t, 1, testutil.ToFloat64(other.connections), 0)
+}
+
+// fallbackHandler counts the requests handed to it.
+type fallbackHandler struct {
+	served atomic.Int64
+}
+
+func (f *fallbackHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request, _ caddyhttp.Handler) error {
+	f.served.Add(1)
+	w.WriteHeader(http.StatusForbidden)
+	return nil
+}
+
+func TestServeHTTPConnectionLimits(t *testing.T) {
+	newResponder := func(fallback caddyhttp.MiddlewareHandler) *Responder {
+		r := &Responder{
+			Config: &Config{
+				Timeout:             200 * time.Millisecond,
+				BytesPerSecond:      1024,
+				ResponseCode:        http.StatusOK,
+				MaxConnections:      4,
+				MaxConnectionsPerIP: 2,
+			},
+			ContentReader: TimeoutReader{},
+			Fallback:      fallback,
+		}
+		require.NoError(t, r.Provision(caddy.Context{}))
+		return r
+	}
+	serve := func(r *Responder, ip string) (int, error) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		err := r.ServeHTTP(rec, req, nil)
+		return rec.Code, err
+	}
+
+	t.Run("Fallback under concurrent load", func(t *testing.T) {
+		fallback := &fallbackHandler{}
+		r := newResponder(fallback)
+
+		var tarpitted atomic.Int64
+		var wg sync.WaitGroup
+		for i := range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				code, err := serve(r, fmt.Sprintf("192.0.2.%d", i%3))
+				require.NoError(t, err)
+				if code == http.StatusOK {
+					tarpitted.Add(1)
+				}
+			}()
+		}
+		require.Eventually(t, func() bool { return fallback.served.Load() == 6 }, time.Second, time.Millisecond)
+		require.Equal(t, 4, r.Limiter().Occupancy())
+		wg.Wait()
+
+		require.Equal(t, int64(4), tarpitted.Load())
+		require.Zero(t, r.Limiter().Occupancy())
+	})
+
+	t.Run("Without fallback", func(t *testing.T) {
+		r := newResponder(nil)
+		for range 2 {
+			go func() { _, _ = serve(r, "192.0.2.1") }()
+		}
+		require.Eventually(t, func() bool { return r.Limiter().OccupancyOf("192.0.2.1") == 2 }, time.Second,
+			time.Millisecond)
+
+		_, err := serve(r, "192.0.2.1")
+		var handlerErr caddyhttp.HandlerError
+		require.ErrorAs(t, err, &handlerErr)
+		require.Equal(t, http.StatusServiceUnavailable, handlerErr.StatusCode)
+		require.ErrorIs(t, err, ErrCapacity)
+	})
+}
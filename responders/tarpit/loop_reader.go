@@ -0,0 +1,36 @@
+package tarpit
+
+import (
+	"bytes"
+	"io"
+)
+
+// loopReader reads content over and over, opening it again from its ContentReader on EOF. A DirReader or
+// WeightedReader picks new content on every pass.
+type loopReader struct {
+	content ContentReader
+	current io.ReadCloser
+}
+
+// Read reads from the current pass of the content, starting the next one on EOF. It only returns io.EOF if a new
+// pass is empty, so empty content doesn't spin.
+func (l *loopReader) Read(b []byte) (int, error) {
+	n, err := l.current.Read(b)
+	if err != io.EOF || n > 0 {
+		return n, err
+	}
+	if err := l.current.Close(); err != nil {
+		return 0, err
+	}
+	if l.current, err = l.content.Read(); err != nil {
+		// Leave nothing to close
+		l.current = io.NopCloser(bytes.NewReader(nil))
+		return 0, err
+	}
+	return l.current.Read(b)
+}
+
+// Close closes the current pass of the content.
+func (l *loopReader) Close() error {
+	return l.current.Close()
+}
@@ -0,0 +1,133 @@
+package tarpit
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoopReader(t *testing.T) {
+	content := &mockReadCloser{data: []byte("abc")}
+	first, err := content.Read()
+	require.NoError(t, err)
+	reader := &loopReader{content: content, current: first}
+
+	data, err := io.ReadAll(io.LimitReader(reader, 10))
+	require.NoError(t, err)
+	require.Equal(t, "abcabcabca", string(data))
+	require.NoError(t, reader.Close())
+
+	// Empty content ends instead of spinning
+	empty := &mockReadCloser{}
+	first, err = empty.Read()
+	require.NoError(t, err)
+	data, err = io.ReadAll(&loopReader{content: empty, current: first})
+	require.NoError(t, err)
+	require.Empty(t, data)
+}
+
+// serveScheduled serves a request from a responder on a scheduler of its own, which must end within a number of
+// ticks.
+func serveScheduled(t *testing.T, responder *Responder, ticks int) *lockedRecorder {
+	t.Helper()
+	clock := newFakeClock()
+	responder.Scheduler = NewScheduler(clock, 100*time.Millisecond, 1)
+
+	rec := &lockedRecorder{ResponseRecorder: httptest.NewRecorder()}
+	done := make(chan error)
+	go func() {
+		done <- responder.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil), nil)
+	}()
+	require.Eventually(t, func() bool { return responder.Scheduler.Active() == 1 }, time.Second, time.Millisecond)
+	advance(t, clock, responder.Scheduler, ticks)
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("still serving")
+	}
+	return rec
+}
+
+func TestServeHTTPLoop(t *testing.T) {
+	responder := &Responder{
+		Config: &Config{
+			Timeout:        time.Second,
+			BytesPerSecond: 100,
+			ResponseCode:   http.StatusOK,
+			Loop:           true,
+		},
+		ContentReader: &mockReadCloser{data: []byte("abc")},
+	}
+	// 10 bytes are written every 100ms until the timeout, over and over again
+	rec := serveScheduled(t, responder, 10)
+	require.Equal(t, strings.Repeat("abc", 30), rec.String())
+}
+
+func TestServeHTTPContentLength(t *testing.T) {
+	newResponder := func(length string, loop bool) *Responder {
+		return &Responder{
+			Config: &Config{
+				Timeout:        time.Second,
+				BytesPerSecond: 100,
+				ResponseCode:   http.StatusOK,
+				Loop:           loop,
+				ContentLength:  length,
+			},
+			ContentReader: &mockReadCloser{data: []byte("abc")},
+		}
+	}
+
+	t.Run("Auto", func(t *testing.T) {
+		rec := serveScheduled(t, newResponder("auto", false), 2)
+		require.Equal(t, "3", rec.Header().Get("Content-Length"))
+		require.Equal(t, "abc", rec.String())
+	})
+
+	t.Run("Auto per file", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0o600))
+		r := newResponder("auto", false)
+		r.ContentReader = DirReader{Path: dir}
+		rec := serveScheduled(t, r, 2)
+		require.Equal(t, "5", rec.Header().Get("Content-Length"))
+	})
+
+	t.Run("Cut off", func(t *testing.T) {
+		rec := serveScheduled(t, newResponder("5", true), 2)
+		require.Equal(t, "5", rec.Header().Get("Content-Length"))
+		require.Equal(t, "abcab", rec.String())
+	})
+
+	t.Run("Misleading", func(t *testing.T) {
+		// The client waits for bytes which never come until the timeout
+		rec := serveScheduled(t, newResponder("1000000", false), 10)
+		require.Equal(t, "1000000", rec.Header().Get("Content-Length"))
+		require.Equal(t, "abc", rec.String())
+	})
+
+	t.Run("None", func(t *testing.T) {
+		rec := serveScheduled(t, newResponder("", false), 2)
+		require.Empty(t, rec.Header().Get("Content-Length"))
+	})
+}
+
+func TestValidateContent(t *testing.T) {
+	r := &Responder{Config: &Config{Timeout: time.Second, BytesPerSecond: 1, ContentLength: "lots"}}
+	require.ErrorContains(t, r.Validate(), "content_length must be auto or a number of bytes")
+
+	r.Config.ContentLength = "auto"
+	r.Config.Loop = true
+	require.ErrorContains(t, r.Validate(), "can't be used with loop")
+
+	r.Config.ContentLength = ""
+	r.Config.Sources = []Source{{Weight: -1}}
+	require.ErrorContains(t, r.Validate(), "weights must not be negative")
+}
@@ -0,0 +1,117 @@
+package tarpit
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minWriteInterval is the shortest time between two writes to a stream. Faster rates write more bytes at once.
+const minWriteInterval = 100 * time.Millisecond
+
+// maxChunkSize caps the bytes written to a stream at once. A stream behind its rate catches up over several writes.
+const maxChunkSize = 64 * 1024
+
+// pacer is the rate model of a stream. It schedules bytes on a timeline since the start of the stream, independent
+// of when the scheduler steps the stream, so rates of any speed are kept on average:
+//   - The rate changes linearly from initial to rate over ramp, then stays at rate.
+//   - Each wait between writes is stretched or shortened by a random fraction of up to jitter.
+type pacer struct {
+	rate    float64
+	initial float64
+	ramp    time.Duration
+	jitter  float64
+	// random returns a number in [0, 1).
+	random func() float64
+}
+
+// newPacer returns the pacer of a config.
+func newPacer(config *Config) *pacer {
+	p := &pacer{rate: config.BytesPerSecond, jitter: config.Jitter, random: rand.Float64}
+	if config.RampDuration > 0 {
+		p.initial = config.InitialBytesPerSecond
+		p.ramp = config.RampDuration
+	}
+	return p
+}
+
+// due returns the number of bytes due by an elapsed time.
+func (p *pacer) due(elapsed time.Duration) int64 {
+	t := elapsed.Seconds()
+	if t <= 0 {
+		return 0
+	}
+	var bytes float64
+	if ramp := p.ramp.Seconds(); t <= ramp {
+		bytes = p.initial*t + (p.rate-p.initial)*t*t/(2*ramp)
+	} else {
+		bytes = p.rampBytes() + p.rate*(t-ramp)
+	}
+	// The epsilon absorbs rounding errors, so a byte is due at the time dueAt returns for it
+	return int64(bytes + 1e-9)
+}
+
+// dueAt returns the elapsed time by which n bytes are due.
+func (p *pacer) dueAt(n int64) time.Duration {
+	if n <= 0 {
+		return 0
+	}
+	bytes := float64(n)
+	ramp := p.ramp.Seconds()
+	var t float64
+	if rampBytes := p.rampBytes(); bytes <= rampBytes {
+		// Solve initial*t + (rate-initial)*t²/(2*ramp) = bytes for the first t
+		a := (p.rate - p.initial) / (2 * ramp)
+		if math.Abs(a) < 1e-12 {
+			t = bytes / p.initial
+		} else {
+			t = (-p.initial + math.Sqrt(p.initial*p.initial+4*a*bytes)) / (2 * a)
+		}
+	} else {
+		t = ramp + (bytes-rampBytes)/p.rate
+	}
+	// Rounding up keeps due(dueAt(n)) from falling short of n
+	return time.Duration(math.Ceil(t * float64(time.Second)))
+}
+
+// rampBytes returns the number of bytes due over the ramp.
+func (p *pacer) rampBytes() float64 {
+	return (p.initial + p.rate) / 2 * p.ramp.Seconds()
+}
+
+// next returns the elapsed time of the write after one scheduled at last, once sent bytes have been written.
+func (p *pacer) next(last time.Duration, sent int64) time.Duration {
+	next := max(p.dueAt(sent+1), last+minWriteInterval)
+	if p.jitter > 0 {
+		wait := next - last
+		next = last + time.Duration(float64(wait)*(1+p.jitter*(2*p.random()-1)))
+	}
+	return next
+}
+
+// maxChunk returns the size of the largest chunk written at once at the fastest rate.
+func (p *pacer) maxChunk() int {
+	fastest := max(p.rate, p.initial) * minWriteInterval.Seconds() * (1 + p.jitter)
+	return min(max(int(math.Ceil(fastest))*2, 1), maxChunkSize)
+}
+
+// ParseRate parses a rate in bytes per second, given either as a number such as "24" or "0.5", or as a number of
+// bytes per duration such as "1/5s".
+func ParseRate(s string) (float64, error) {
+	bytes, per, found := strings.Cut(s, "/")
+	rate, err := strconv.ParseFloat(bytes, 64)
+	if err != nil || rate <= 0 || math.IsInf(rate, 0) {
+		return 0, fmt.Errorf("invalid rate '%s'", s)
+	}
+	if !found {
+		return rate, nil
+	}
+	duration, err := time.ParseDuration(per)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("invalid rate '%s'", s)
+	}
+	return rate / duration.Seconds(), nil
+}
@@ -0,0 +1,143 @@
+package tarpit
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPacerDueAt(t *testing.T) {
+	for _, p := range []*pacer{
+		{rate: 24},
+		{rate: 0.2},
+		{rate: 3000},
+		{rate: 1, initial: 100, ramp: 10 * time.Second},
+		{rate: 50, initial: 5, ramp: 3 * time.Second},
+	} {
+		for n := int64(1); n < 1000; n++ {
+			at := p.dueAt(n)
+			require.GreaterOrEqual(t, p.due(at), n, "%+v: byte %d isn't due at %s", p, n, at)
+			require.Less(t, p.due(at-time.Microsecond), n, "%+v: byte %d is due before %s", p, n, at)
+		}
+	}
+}
+
+func TestPacerSlowRate(t *testing.T) {
+	p := &pacer{rate: 0.2}
+	require.Equal(t, 5*time.Second, p.dueAt(1))
+	require.Equal(t, 10*time.Second, p.dueAt(2))
+	require.Equal(t, 2, p.maxChunk())
+
+	// A byte every 5 seconds, not more often
+	require.Equal(t, 10*time.Second, p.next(5*time.Second, 1))
+}
+
+func TestPacerRamp(t *testing.T) {
+	p := &pacer{rate: 1, initial: 100, ramp: 10 * time.Second}
+
+	// The rate falls from 100 to 1 byte per second over 10 seconds, so 505 bytes are due by then
+	require.Equal(t, int64(505), p.due(10*time.Second))
+	require.Equal(t, int64(515), p.due(20*time.Second))
+	// The first bytes come fast
+	require.Equal(t, int64(95), p.due(time.Second))
+	require.Equal(t, 100*time.Millisecond, p.next(0, 1))
+	// The last ones slowly
+	require.Equal(t, 11*time.Second, p.next(10*time.Second, 505))
+}
+
+func TestPacerMinWriteInterval(t *testing.T) {
+	p := &pacer{rate: 1000}
+	require.Equal(t, 200*time.Millisecond, p.next(100*time.Millisecond, 100))
+	require.Equal(t, 200, p.maxChunk())
+}
+
+func TestPacerJitter(t *testing.T) {
+	p := &pacer{rate: 0.5, jitter: 0.5}
+
+	p.random = func() float64 { return 0 }
+	require.Equal(t, 3*time.Second, p.next(2*time.Second, 1))
+	p.random = func() float64 { return 0.9999999 }
+	require.InDelta(t, 5*time.Second, p.next(2*time.Second, 1), float64(time.Millisecond))
+
+	// On average, the rate is kept
+	rng := rand.New(rand.NewPCG(1, 2))
+	p = &pacer{rate: 24, jitter: 0.9, random: rng.Float64}
+	var last time.Duration
+	var sent int64
+	for last < time.Minute {
+		last = p.next(last, sent)
+		sent = p.due(last)
+	}
+	require.InDelta(t, 24*60, sent, 24)
+}
+
+func TestParseRate(t *testing.T) {
+	for input, expected := range map[string]float64{
+		"24":     24,
+		"0.5":    0.5,
+		"1/5s":   0.2,
+		"3/1m":   0.05,
+		"100/1s": 100,
+	} {
+		rate, err := ParseRate(input)
+		require.NoError(t, err, input)
+		require.InDelta(t, expected, rate, 1e-9, input)
+	}
+	for _, input := range []string{"", "fast", "0", "-1", "1/0s", "1/fast", "Inf"} {
+		_, err := ParseRate(input)
+		require.Error(t, err, input)
+	}
+}
+
+func TestServeHTTPSlowRate(t *testing.T) {
+	clock := newFakeClock()
+	scheduler := NewScheduler(clock, 100*time.Millisecond, 1)
+	responder := &Responder{
+		Config: &Config{
+			Timeout:        time.Minute,
+			BytesPerSecond: 0.2,
+			ResponseCode:   http.StatusOK,
+		},
+		ContentReader: &mockReadCloser{data: []byte(strings.Repeat("a", 100))},
+		Scheduler:     scheduler,
+	}
+
+	rec := &lockedRecorder{ResponseRecorder: httptest.NewRecorder()}
+	go func() {
+		_ = responder.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil), nil)
+	}()
+	require.Eventually(t, func() bool { return scheduler.Active() == 1 }, time.Second, time.Millisecond)
+
+	advance(t, clock, scheduler, 49)
+	require.Zero(t, rec.Len())
+	advance(t, clock, scheduler, 1)
+	require.Equal(t, 1, rec.Len())
+	advance(t, clock, scheduler, 49)
+	require.Equal(t, 1, rec.Len())
+	advance(t, clock, scheduler, 1)
+	require.Equal(t, 2, rec.Len())
+}
+
+func TestValidateRate(t *testing.T) {
+	valid := func() *Responder {
+		return &Responder{Config: &Config{Timeout: time.Second, BytesPerSecond: 0.1}}
+	}
+	require.NoError(t, valid().Validate())
+
+	r := valid()
+	r.Config.BytesPerSecond = 0
+	require.ErrorContains(t, r.Validate(), "bytes_per_second must be greater than 0")
+
+	r = valid()
+	r.Config.RampDuration = time.Second
+	require.ErrorContains(t, r.Validate(), "ramp requires initial_bytes_per_second")
+
+	r = valid()
+	r.Config.Jitter = 1
+	require.ErrorContains(t, r.Validate(), "jitter must be")
+}
@@ -0,0 +1,203 @@
+package tarpit
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTick is the resolution of the default scheduler.
+	DefaultTick = 100 * time.Millisecond
+	// wheelSlots is the number of slots of the timer wheel. Streams due more than one revolution ahead stay in their
+	// slot for further rounds.
+	wheelSlots = 512
+	// queueSize is the number of due streams which may wait for a worker before further ones are put off to the
+	// next tick.
+	queueSize = 16384
+)
+
+// Clock is the source of time of a Scheduler.
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks like a time.Ticker.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// RealClock is the Clock of the wall time.
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTicker(d time.Duration) Ticker { return realTicker{time.NewTicker(d)} }
+
+type realTicker struct{ *time.Ticker }
+
+func (t realTicker) C() <-chan time.Time { return t.Ticker.C }
+
+// Stream is a tarpitted connection serviced by a Scheduler.
+type Stream interface {
+	// Step writes to the connection once it is due. It returns when it is due again, or false once it is done.
+	Step(now time.Time) (time.Time, bool)
+}
+
+// Scheduler services any number of streams from a timer wheel driven by a single ticker, and steps due streams on a
+// fixed pool of workers. It only runs while it has streams.
+type Scheduler struct {
+	clock   Clock
+	tick    time.Duration
+	workers int
+
+	mu    sync.Mutex
+	wheel [wheelSlots][]entry
+	// epoch is when the ticker was started, so tick n is due at epoch + n * tick.
+	epoch    time.Time
+	ticks    uint64
+	streams  int
+	inFlight int
+	running  bool
+	queue    chan Stream
+}
+
+type entry struct {
+	stream Stream
+	due    uint64
+}
+
+// NewScheduler returns a new Scheduler stepping due streams every tick. A workers count of 0 uses four per CPU.
+func NewScheduler(clock Clock, tick time.Duration, workers int) *Scheduler {
+	if workers <= 0 {
+		workers = 4 * runtime.GOMAXPROCS(0)
+	}
+	return &Scheduler{clock: clock, tick: tick, workers: workers}
+}
+
+var (
+	defaultScheduler     *Scheduler
+	defaultSchedulerOnce sync.Once
+)
+
+// DefaultScheduler returns the scheduler shared by all tarpit responders which don't have their own.
+func DefaultScheduler() *Scheduler {
+	defaultSchedulerOnce.Do(func() {
+		defaultScheduler = NewScheduler(RealClock, DefaultTick, 0)
+	})
+	return defaultScheduler
+}
+
+// Now returns the time of the scheduler's clock.
+func (s *Scheduler) Now() time.Time {
+	return s.clock.Now()
+}
+
+// Add schedules a stream to be stepped at the first tick not before a time.
+func (s *Scheduler) Add(stream Stream, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.running {
+		s.start()
+	}
+	s.insert(stream, at)
+}
+
+// Active returns the number of streams being serviced.
+func (s *Scheduler) Active() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.streams + s.inFlight
+}
+
+// insert puts a stream in the wheel. The lock must be held.
+func (s *Scheduler) insert(stream Stream, at time.Time) {
+	due := s.ticks + 1
+	if offset := at.Sub(s.epoch); offset > 0 {
+		due = max(due, uint64((offset+s.tick-1)/s.tick))
+	}
+	s.put(stream, due)
+}
+
+// put puts a stream in the wheel at a tick. The lock must be held.
+func (s *Scheduler) put(stream Stream, due uint64) {
+	s.wheel[due%wheelSlots] = append(s.wheel[due%wheelSlots], entry{stream: stream, due: due})
+	s.streams++
+}
+
+// start starts the ticker and the workers. The lock must be held.
+func (s *Scheduler) start() {
+	s.running = true
+	s.epoch = s.clock.Now()
+	s.ticks = 0
+	s.queue = make(chan Stream, queueSize)
+	for range s.workers {
+		go s.work(s.queue)
+	}
+	go s.run(s.clock.NewTicker(s.tick))
+}
+
+func (s *Scheduler) run(ticker Ticker) {
+	defer ticker.Stop()
+	for range ticker.C() {
+		if !s.advance() {
+			return
+		}
+	}
+}
+
+// advance moves the wheel on by a tick and hands the streams due to the workers. It reports false once the
+// scheduler has stopped because there are no streams left.
+func (s *Scheduler) advance() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.streams == 0 && s.inFlight == 0 {
+		s.running = false
+		close(s.queue)
+		return false
+	}
+
+	s.ticks++
+	slot := &s.wheel[s.ticks%wheelSlots]
+	later := (*slot)[:0]
+	var waiting []Stream
+	for _, e := range *slot {
+		if e.due > s.ticks {
+			later = append(later, e)
+			continue
+		}
+		s.streams--
+		select {
+		case s.queue <- e.stream:
+			s.inFlight++
+		default:
+			// All workers are busy, so the stream waits for the next tick
+			waiting = append(waiting, e.stream)
+		}
+	}
+	clear((*slot)[len(later):])
+	*slot = later
+	for _, stream := range waiting {
+		s.put(stream, s.ticks+1)
+	}
+	return true
+}
+
+func (s *Scheduler) work(queue <-chan Stream) {
+	for stream := range queue {
+		next, ok := stream.Step(s.clock.Now())
+
+		s.mu.Lock()
+		s.inFlight--
+		if ok {
+			s.insert(stream, next)
+		}
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,96 @@
+//go:build unix
+
+package tarpit
+
+import (
+	"io"
+	"runtime"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const (
+	benchmarkConnections = 10000
+	benchmarkTick        = 10 * time.Millisecond
+)
+
+// cpuTime returns the CPU time used by the process so far.
+func cpuTime(b *testing.B) time.Duration {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		b.Fatal(err)
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
+
+// benchmarkStreams reports the CPU time per round of stepping every connection once, and the goroutines needed.
+func benchmarkStreams(b *testing.B, run func(rounds int, goroutines func())) {
+	before := runtime.NumGoroutine()
+	var peak int
+	goroutines := func() { peak = max(peak, runtime.NumGoroutine()-before) }
+
+	b.ResetTimer()
+	start := cpuTime(b)
+	run(b.N, goroutines)
+	b.StopTimer()
+
+	b.ReportMetric(float64(cpuTime(b)-start)/float64(b.N)/float64(time.Millisecond), "cpu-ms/round")
+	b.ReportMetric(float64(peak), "goroutines")
+}
+
+// BenchmarkTickerPerConnection drives every connection with its own ticker, like the tarpit did before the
+// scheduler.
+func BenchmarkTickerPerConnection(b *testing.B) {
+	benchmarkStreams(b, func(rounds int, goroutines func()) {
+		chunk := make([]byte, 2)
+		var wg sync.WaitGroup
+		wg.Add(benchmarkConnections)
+		for range benchmarkConnections {
+			go func() {
+				defer wg.Done()
+				ticker := time.NewTicker(benchmarkTick)
+				defer ticker.Stop()
+				for range rounds {
+					<-ticker.C
+					_, _ = io.Discard.Write(chunk)
+				}
+			}()
+		}
+		goroutines()
+		wg.Wait()
+	})
+}
+
+// discardStream writes a chunk to io.Discard every tick for a number of rounds.
+type discardStream struct {
+	chunk  []byte
+	rounds int
+	next   time.Time
+	done   *sync.WaitGroup
+}
+
+func (d *discardStream) Step(time.Time) (time.Time, bool) {
+	_, _ = io.Discard.Write(d.chunk)
+	if d.rounds--; d.rounds == 0 {
+		d.done.Done()
+		return time.Time{}, false
+	}
+	d.next = d.next.Add(benchmarkTick)
+	return d.next, true
+}
+
+func BenchmarkScheduler(b *testing.B) {
+	benchmarkStreams(b, func(rounds int, goroutines func()) {
+		s := NewScheduler(RealClock, benchmarkTick, 0)
+		var wg sync.WaitGroup
+		wg.Add(benchmarkConnections)
+		now := time.Now()
+		for range benchmarkConnections {
+			s.Add(&discardStream{chunk: make([]byte, 2), rounds: rounds, next: now, done: &wg}, now)
+		}
+		goroutines()
+		wg.Wait()
+	})
+}
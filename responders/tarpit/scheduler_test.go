@@ -0,0 +1,301 @@
+package tarpit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is a Clock whose time only moves on when advanced.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1_700_000_000, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) Ticker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTicker{c: make(chan time.Time), stopped: make(chan struct{}), period: d, next: c.now.Add(d)}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+// Advance moves the time on, delivering the ticks due on the way. Each tick is delivered once the previous one has
+// been received.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	c.mu.Unlock()
+	for {
+		c.mu.Lock()
+		var next *fakeTicker
+		for _, t := range c.tickers {
+			if !t.isStopped() && !t.next.After(end) && (next == nil || t.next.Before(next.next)) {
+				next = t
+			}
+		}
+		if next == nil {
+			c.now = end
+			c.mu.Unlock()
+			return
+		}
+		c.now = next.next
+		next.next = next.next.Add(next.period)
+		now := c.now
+		c.mu.Unlock()
+
+		select {
+		case next.c <- now:
+		case <-next.stopped:
+		}
+	}
+}
+
+type fakeTicker struct {
+	c       chan time.Time
+	stopped chan struct{}
+	once    sync.Once
+	period  time.Duration
+	next    time.Time
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.c }
+
+func (t *fakeTicker) Stop() { t.once.Do(func() { close(t.stopped) }) }
+
+func (t *fakeTicker) isStopped() bool {
+	select {
+	case <-t.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+// settle waits until the scheduler has stepped all streams handed to its workers.
+func settle(t testing.TB, s *Scheduler) {
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.inFlight == 0
+	}, 5*time.Second, time.Millisecond)
+}
+
+// advance moves the clock on by ticks one at a time, letting the scheduler settle after each.
+func advance(t testing.TB, clock *fakeClock, s *Scheduler, ticks int) {
+	for range ticks {
+		clock.Advance(s.tick)
+		settle(t, s)
+	}
+}
+
+// recordingStream records when it was stepped, and is due every interval for a number of steps.
+type recordingStream struct {
+	mu       sync.Mutex
+	interval time.Duration
+	steps    int
+	next     time.Time
+	stepped  []time.Time
+}
+
+func (r *recordingStream) Step(now time.Time) (time.Time, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stepped = append(r.stepped, now)
+	r.next = r.next.Add(r.interval)
+	return r.next, len(r.stepped) < r.steps
+}
+
+func (r *recordingStream) Stepped() []time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]time.Time(nil), r.stepped...)
+}
+
+func TestSchedulerDueTimes(t *testing.T) {
+	clock := newFakeClock()
+	s := NewScheduler(clock, 100*time.Millisecond, 2)
+	start := clock.Now()
+
+	stream := &recordingStream{interval: 250 * time.Millisecond, steps: 3, next: start.Add(250 * time.Millisecond)}
+	s.Add(stream, stream.next)
+
+	advance(t, clock, s, 2)
+	require.Empty(t, stream.Stepped(), "stepped before it was due")
+
+	advance(t, clock, s, 6)
+	// Due at 250ms, 500ms and 750ms, stepped at the first tick not before
+	require.Equal(t, []time.Time{
+		start.Add(300 * time.Millisecond),
+		start.Add(500 * time.Millisecond),
+		start.Add(800 * time.Millisecond),
+	}, stream.Stepped())
+	require.Zero(t, s.Active())
+}
+
+func TestSchedulerLongDelays(t *testing.T) {
+	clock := newFakeClock()
+	s := NewScheduler(clock, 100*time.Millisecond, 1)
+	start := clock.Now()
+
+	// Further ahead than a revolution of the wheel
+	due := start.Add(wheelSlots*100*time.Millisecond + 150*time.Millisecond)
+	stream := &recordingStream{steps: 1, next: due}
+	s.Add(stream, due)
+
+	advance(t, clock, s, wheelSlots+1)
+	require.Empty(t, stream.Stepped())
+	advance(t, clock, s, 1)
+	require.Equal(t, []time.Time{start.Add(wheelSlots*100*time.Millisecond + 200*time.Millisecond)}, stream.Stepped())
+}
+
+func TestSchedulerManyStreams(t *testing.T) {
+	const streams = 10000
+	clock := newFakeClock()
+	s := NewScheduler(clock, 100*time.Millisecond, 8)
+	before := runtime.NumGoroutine()
+
+	var steps atomic.Int64
+	for range streams {
+		s.Add(&countingStream{steps: &steps, rounds: 5, interval: 100 * time.Millisecond, next: clock.Now()},
+			clock.Now())
+	}
+	require.Equal(t, streams, s.Active())
+	// One ticker and a fixed pool of workers service all streams
+	require.LessOrEqual(t, runtime.NumGoroutine()-before, 8+1)
+
+	advance(t, clock, s, 1)
+	require.Equal(t, int64(streams), steps.Load())
+	advance(t, clock, s, 4)
+	require.Equal(t, int64(5*streams), steps.Load())
+	require.Zero(t, s.Active())
+
+	// Without streams, the scheduler stops
+	clock.Advance(s.tick)
+	for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > before && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	require.LessOrEqual(t, runtime.NumGoroutine(), before)
+
+	// And starts again with the next one
+	stream := &recordingStream{steps: 1, next: clock.Now()}
+	s.Add(stream, stream.next)
+	advance(t, clock, s, 1)
+	require.Len(t, stream.Stepped(), 1)
+}
+
+// countingStream counts its steps, and is due every interval for a number of rounds.
+type countingStream struct {
+	steps    *atomic.Int64
+	rounds   int
+	interval time.Duration
+	next     time.Time
+}
+
+func (c *countingStream) Step(time.Time) (time.Time, bool) {
+	c.steps.Add(1)
+	c.rounds--
+	c.next = c.next.Add(c.interval)
+	return c.next, c.rounds > 0
+}
+
+func TestServeHTTPScheduled(t *testing.T) {
+	clock := newFakeClock()
+	scheduler := NewScheduler(clock, 100*time.Millisecond, 1)
+	content := strings.Repeat("a", 25)
+	responder := &Responder{
+		Config: &Config{
+			Timeout:        10 * time.Second,
+			BytesPerSecond: 100,
+			ResponseCode:   http.StatusOK,
+		},
+		ContentReader: &mockReadCloser{data: []byte(content)},
+		Scheduler:     scheduler,
+	}
+	var finished time.Duration
+	responder.OnFinish = func(_ *http.Request, duration time.Duration, _ int64) { finished = duration }
+
+	rec := &lockedRecorder{ResponseRecorder: httptest.NewRecorder()}
+	done := make(chan error)
+	go func() {
+		done <- responder.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil), nil)
+	}()
+
+	// Headers are sent right away, then 10 bytes every 100ms
+	require.Eventually(t, func() bool { return scheduler.Active() == 1 }, time.Second, time.Millisecond)
+	require.Zero(t, rec.Len())
+	advance(t, clock, scheduler, 2)
+	require.Equal(t, 20, rec.Len())
+
+	advance(t, clock, scheduler, 2)
+	require.NoError(t, <-done)
+	require.Equal(t, content, rec.String())
+	require.Equal(t, 400*time.Millisecond, finished)
+}
+
+func TestServeHTTPScheduledTimeout(t *testing.T) {
+	clock := newFakeClock()
+	scheduler := NewScheduler(clock, 100*time.Millisecond, 1)
+	responder := &Responder{
+		Config:        &Config{Timeout: time.Second, BytesPerSecond: 100, ResponseCode: http.StatusOK},
+		ContentReader: TimeoutReader{},
+		Scheduler:     scheduler,
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- responder.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), nil)
+	}()
+	require.Eventually(t, func() bool { return scheduler.Active() == 1 }, time.Second, time.Millisecond)
+
+	advance(t, clock, scheduler, 9)
+	select {
+	case <-done:
+		t.Fatal("finished before the timeout")
+	default:
+	}
+	advance(t, clock, scheduler, 1)
+	require.NoError(t, <-done)
+}
+
+// lockedRecorder is a ResponseRecorder which may be read while the scheduler writes to it.
+type lockedRecorder struct {
+	mu sync.Mutex
+	*httptest.ResponseRecorder
+}
+
+func (l *lockedRecorder) Write(b []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.ResponseRecorder.Write(b)
+}
+
+func (l *lockedRecorder) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.Body.Len()
+}
+
+func (l *lockedRecorder) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.Body.String()
+}
@@ -0,0 +1,50 @@
+package tarpit
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// serveSocket writes a response over a hijacked connection whose socket is tuned to crawl, sending the headers at
+// once and the content at the configured rate until it or the time is up, the client disconnects or the config is
+// unloaded. It returns the number of bytes of content written.
+func (r *Responder) serveSocket(conn net.Conn, header http.Header, body io.Reader, scheduler *Scheduler,
+	start time.Time) int64 {
+	// Tuning is best effort: a connection which isn't over TCP, such as over a unix socket, is tarpitted without it
+	_ = tuneSocket(conn)
+
+	// The connection is closed once the response ends, which also ends a body without Content-Length
+	header.Set("Connection", "close")
+	if header.Get("Date") == "" {
+		header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	}
+	var head bytes.Buffer
+	fmt.Fprintf(&head, "HTTP/1.1 %d %s\r\n", r.Config.ResponseCode, http.StatusText(r.Config.ResponseCode))
+	_ = header.Write(&head)
+	head.WriteString("\r\n")
+
+	_ = conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := head.WriteTo(conn); err != nil {
+		conn.Close()
+		return 0
+	}
+	return r.serveConn(conn, body, scheduler, start)
+}
+
+// tcpConn returns the TCP connection a hijacked connection is over, such as under TLS.
+func tcpConn(conn net.Conn) (*net.TCPConn, bool) {
+	for {
+		switch c := conn.(type) {
+		case *net.TCPConn:
+			return c, true
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return nil, false
+		}
+	}
+}
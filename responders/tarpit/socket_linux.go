@@ -0,0 +1,44 @@
+//go:build linux
+
+package tarpit
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// tuneSocket shrinks the send and receive buffers of a connection's socket and clamps its TCP window to the minimum,
+// so little is ever in flight and the client's TCP stack waits on every few segments, and disables Nagle's algorithm,
+// so each drip is sent as its own segment rather than coalesced.
+func tuneSocket(conn net.Conn) error {
+	tcp, ok := tcpConn(conn)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	if err := tcp.SetNoDelay(true); err != nil {
+		return err
+	}
+	raw, err := tcp.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var optionErr error
+	err = raw.Control(func(fd uintptr) {
+		// The kernel raises each of them to its minimum
+		for _, option := range []struct{ level, name int }{
+			{syscall.SOL_SOCKET, syscall.SO_SNDBUF},
+			{syscall.SOL_SOCKET, syscall.SO_RCVBUF},
+			{syscall.IPPROTO_TCP, syscall.TCP_WINDOW_CLAMP},
+		} {
+			if optionErr = syscall.SetsockoptInt(int(fd), option.level, option.name, 1); optionErr != nil {
+				return
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return optionErr
+}
@@ -0,0 +1,161 @@
+//go:build linux
+
+package tarpit
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newSocketServer returns a test server of a responder tarpitting sockets, and the server side of its connections.
+func newSocketServer(t *testing.T, responder *Responder, finished chan<- error) (*httptest.Server, func() []net.Conn) {
+	var mu sync.Mutex
+	var conns []net.Conn
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "Caddy")
+		finished <- responder.ServeHTTP(w, r, nil)
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+	return server, func() []net.Conn {
+		mu.Lock()
+		defer mu.Unlock()
+		return conns
+	}
+}
+
+// socketOption returns the value of an option of a connection's socket.
+func socketOption(t *testing.T, conn net.Conn, level, name int) int {
+	t.Helper()
+	raw, err := conn.(*net.TCPConn).SyscallConn()
+	require.NoError(t, err)
+	var value int
+	var optionErr error
+	require.NoError(t, raw.Control(func(fd uintptr) {
+		value, optionErr = syscall.GetsockoptInt(int(fd), level, name)
+	}))
+	require.NoError(t, optionErr)
+	return value
+}
+
+func TestServeSocket(t *testing.T) {
+	t.Run("TunedSocket", func(t *testing.T) {
+		finished := make(chan error, 1)
+		responder := newHeaderResponder(100, time.Minute)
+		responder.Config.Mode = ModeSocket
+		responder.ContentReader = &mockReadCloser{data: []byte(strings.Repeat("Hello, World! ", 4))}
+		server, conns := newSocketServer(t, responder, finished)
+
+		conn := dialRequest(t, server)
+		start := time.Now()
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "Played", resp.Header.Get("X-You-Got"))
+		require.Equal(t, "Caddy", resp.Header.Get("Server"))
+		require.True(t, resp.Close)
+
+		// The socket of the server's side of the connection is tuned once it is taken over
+		require.Len(t, conns(), 1)
+		tuned := conns()[0]
+		require.Equal(t, 1, socketOption(t, tuned, syscall.IPPROTO_TCP, syscall.TCP_NODELAY))
+		require.LessOrEqual(t, socketOption(t, tuned, syscall.SOL_SOCKET, syscall.SO_SNDBUF), 8192)
+		require.LessOrEqual(t, socketOption(t, tuned, syscall.SOL_SOCKET, syscall.SO_RCVBUF), 8192)
+		require.LessOrEqual(t, socketOption(t, tuned, syscall.IPPROTO_TCP, syscall.TCP_WINDOW_CLAMP), 8192)
+
+		// The content is paced, and ends the response by closing the connection
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, strings.Repeat("Hello, World! ", 4), string(body))
+		require.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+		require.NoError(t, requireFinished(t, finished))
+	})
+
+	t.Run("ServerTimeouts", func(t *testing.T) {
+		finished := make(chan error, 1)
+		responder := newHeaderResponder(100, 500*time.Millisecond)
+		responder.Config.Mode = ModeSocket
+		responder.Config.Loop = true
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			finished <- responder.ServeHTTP(w, r, nil)
+		}))
+		// The tarpit outlasts the server's timeouts, which a taken over connection doesn't keep
+		server.Config.ReadTimeout = 100 * time.Millisecond
+		server.Config.WriteTimeout = 100 * time.Millisecond
+		server.Start()
+		t.Cleanup(server.Close)
+
+		conn := dialRequest(t, server)
+		start := time.Now()
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		require.NoError(t, err)
+		_, err = io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, time.Since(start), 450*time.Millisecond)
+		require.NoError(t, requireFinished(t, finished))
+	})
+
+	t.Run("StalledClient", func(t *testing.T) {
+		timeout := writeTimeout
+		writeTimeout = 300 * time.Millisecond
+		t.Cleanup(func() { writeTimeout = timeout })
+
+		finished := make(chan error, 1)
+		responder := newStoppingResponder(nil)
+		responder.Config.Mode = ModeSocket
+		responder.OnFinish = nil
+		server, _ := newSocketServer(t, responder, finished)
+
+		// The client sends a request, but never reads the response, so the tuned socket's buffers are soon full
+		start := time.Now()
+		conn := dialRequest(t, server)
+		require.NoError(t, conn.(*net.TCPConn).SetReadBuffer(4096))
+
+		// Writes which time out skip a tick rather than ending the response, until it stalled for the write timeout
+		require.NoError(t, requireFinished(t, finished))
+		require.GreaterOrEqual(t, time.Since(start), writeTimeout)
+		require.Eventually(t, func() bool { return responder.Scheduler.Active() == 0 }, time.Second, time.Millisecond)
+	})
+
+	t.Run("ClientDisconnect", func(t *testing.T) {
+		before := runtime.NumGoroutine()
+		finished := make(chan error, 1)
+		responder := newHeaderResponder(100, time.Minute)
+		responder.Config.Mode = ModeSocket
+		responder.Config.Loop = true
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			finished <- responder.ServeHTTP(w, r, nil)
+		}))
+
+		conn := dialRequest(t, server)
+		reader := bufio.NewReader(conn)
+		_, err := http.ReadResponse(reader, nil)
+		require.NoError(t, err)
+		_, err = io.ReadFull(reader, make([]byte, 16))
+		require.NoError(t, err)
+		conn.Close()
+
+		require.NoError(t, requireFinished(t, finished))
+		require.Eventually(t, func() bool { return responder.Scheduler.Active() == 0 }, time.Second, time.Millisecond)
+		server.Close()
+		requireGoroutinesExit(t, before)
+	})
+}
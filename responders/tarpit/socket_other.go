@@ -0,0 +1,18 @@
+//go:build !linux
+
+package tarpit
+
+import (
+	"errors"
+	"net"
+)
+
+// tuneSocket shrinks the send and receive buffers of a connection's socket to the minimum the system allows, and
+// disables Nagle's algorithm, so each drip is sent as its own segment rather than coalesced.
+func tuneSocket(conn net.Conn) error {
+	tcp, ok := tcpConn(conn)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	return errors.Join(tcp.SetNoDelay(true), tcp.SetWriteBuffer(1), tcp.SetReadBuffer(1))
+}
@@ -1,19 +1,31 @@
 package tarpit
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"net"
 	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/caddyserver/certmagic"
 	"github.com/jasonlovesdoggo/caddy-defender/cache"
 )
 
 // ContentReader is an interface for fetching data from different data Contents to supply data to the tarpit.
 type ContentReader interface {
 	Read() (io.ReadCloser, error)
+	// Size returns the size of the content, or -1 if it is unknown or varies between reads.
+	Size() int64
 	Validate() error
 }
 
@@ -23,15 +35,88 @@ type Content struct {
 	Path     string
 }
 
+// Source is one of several contents of the tarpit, picked for a request in proportion to its weight.
+type Source struct {
+	Content
+	// Weight is how often the content is picked relative to the other sources.
+	// Default: 1
+	Weight int `json:"weight,omitempty"`
+}
+
 // Config holds the tarpit responder's configuration.
 type Config struct {
-	Headers        map[string]string `json:"headers"`
-	Content        Content
-	Timeout        time.Duration `json:"timeout"`
-	BytesPerSecond int           `json:"bytes_per_second"`
-	ResponseCode   int           `json:"code"`
+	Headers map[string]string `json:"headers"`
+	Content Content
+	Timeout time.Duration `json:"timeout"`
+	// BytesPerSecond is the rate content is written at. It may be below 1, such as 0.2 for a byte every 5 seconds.
+	BytesPerSecond float64 `json:"bytes_per_second"`
+	ResponseCode   int     `json:"code"`
+	// InitialBytesPerSecond is the rate at the start of a response, changing linearly to BytesPerSecond over
+	// RampDuration. A fast start followed by a slow crawl keeps clients hooked.
+	// Default: BytesPerSecond (no ramp)
+	InitialBytesPerSecond float64 `json:"initial_bytes_per_second,omitempty"`
+	// RampDuration is how long the rate takes to change from InitialBytesPerSecond to BytesPerSecond.
+	RampDuration time.Duration `json:"ramp_duration,omitempty"`
+	// Jitter is the fraction, below 1, by which the waits between writes randomly vary, so they aren't perfectly
+	// regular.
+	// Default: 0
+	Jitter float64 `json:"jitter,omitempty"`
+	// MaxConnections is the maximum number of connections tarpitted at once. 0 means unlimited.
+	MaxConnections int `json:"max_connections,omitempty"`
+	// MaxConnectionsPerIP is the maximum number of connections of a single client IP tarpitted at once.
+	// 0 means unlimited.
+	MaxConnectionsPerIP int `json:"max_connections_per_ip,omitempty"`
+	// Fallback is the responder type handling requests over the connection limits, such as "drop" or "block".
+	// Default: "" (respond with 503 Service Unavailable)
+	Fallback string `json:"fallback,omitempty"`
+	// Sources are contents picked at random for each request in proportion to their weights, instead of Content.
+	Sources []Source `json:"sources,omitempty"`
+	// Loop restarts the content once it ends, so responses are only ended by Timeout. A directory or list of sources
+	// picks new content each time.
+	Loop bool `json:"loop,omitempty"`
+	// ContentLength sets the Content-Length header, either to "auto" for the size of the content if it is known, or
+	// to a number of bytes. Responses claiming more than the content holds keep clients waiting for the rest; the
+	// content is cut off at the length.
+	// Default: "" (no Content-Length)
+	ContentLength string `json:"content_length,omitempty"`
+	// CacheTTL is how long http and https content is cached before it is revalidated with the origin.
+	// Default: 24h
+	CacheTTL time.Duration `json:"cache_ttl,omitempty"`
+	// FetchTimeout is how long fetching http and https content may take.
+	// Default: 30s
+	FetchTimeout time.Duration `json:"fetch_timeout,omitempty"`
+	// MaxContentSize is the size in bytes of the largest http or https content fetched.
+	// Default: 100MiB
+	MaxContentSize int64 `json:"max_content_size,omitempty"`
+	// StaleIfError uses the cached copy of http and https content, however old, when the origin is unreachable,
+	// including when Caddy starts.
+	// Default: false
+	StaleIfError bool `json:"stale_if_error,omitempty"`
+	// Cache configures where and for how long http and https content is cached.
+	// Default: the tarpit directory of the cache in Caddy's data directory, without limits
+	Cache *cache.Config `json:"cache,omitempty"`
+	// Mode is how requests are tarpitted: "body" sends the headers at once and paces the content, "headers" paces an
+	// endless stream of headers over HTTP/1 connections, at the same rate and for up to Timeout, and "socket" paces
+	// the content over HTTP/1 connections whose socket buffers are shrunk. Both fall back to "body" for HTTP/2 and
+	// HTTP/3.
+	// Default: body
+	Mode string `json:"mode,omitempty"`
 }
 
+const (
+	// ModeBody sends the headers at once, then tarpits the content.
+	ModeBody = "body"
+	// ModeHeaders hijacks HTTP/1 connections and dribbles the status line and endless headers, so clients never
+	// get a complete response however short their header timeout. Other protocols fall back to ModeBody.
+	ModeHeaders = "headers"
+	// ModeSocket hijacks HTTP/1 connections and shrinks their socket buffers, so the client's TCP stack crawls along
+	// with the tarpitted content. Other protocols fall back to ModeBody.
+	ModeSocket = "socket"
+)
+
+// Modes are the modes of the tarpit.
+var Modes = []string{ModeBody, ModeHeaders, ModeSocket}
+
 // ConfigureContentReader checks the content protocol configuration
 // and configures the appropriate content reader for the tarpit responder.
 func (r *Responder) ConfigureContentReader() error {
@@ -39,58 +124,186 @@ func (r *Responder) ConfigureContentReader() error {
 	if err != nil {
 		return err
 	}
-	if r.Config.Content.Protocol == "" && r.Config.Content.Path != "" {
-		return fmt.Errorf("missing tarpit Content protocol")
+	if len(r.Config.Sources) > 0 {
+		if r.Config.Content != (Content{}) {
+			return errors.New("tarpit content and sources are mutually exclusive")
+		}
+		weighted := WeightedReader{}
+		for _, source := range r.Config.Sources {
+			reader, err := r.newContentReader(source.Content)
+			if err != nil {
+				return err
+			}
+			weight := source.Weight
+			if weight == 0 {
+				weight = 1
+			}
+			weighted.Readers = append(weighted.Readers, reader)
+			weighted.Weights = append(weighted.Weights, weight)
+		}
+		r.ContentReader = weighted
+		return weighted.Validate()
+	}
+
+	reader, err := r.newContentReader(r.Config.Content)
+	if err != nil {
+		return err
 	}
-	switch r.Config.Content.Protocol {
-	// If no content to provide, we'll just hold the connection open
-	case "":
-		r.ContentReader = TimeoutReader{}
-	case "file":
-		r.ContentReader = FileReader{
-			Path: r.Config.Content.Path,
+	r.ContentReader = reader
+	return reader.Validate()
+}
+
+// contentCache returns the cache of http and https content, shared by all the responder's content.
+func (r *Responder) contentCache() (*cache.Cache, error) {
+	if r.cache == nil {
+		config := cache.Config{}
+		if r.Config.Cache != nil {
+			config = *r.Config.Cache
 		}
-		err := r.ContentReader.Validate()
+		config.Directory = "tarpit"
+		c, err := cache.Open(&config, r.Storage)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		r.cache = c
+	}
+	return r.cache, nil
+}
+
+// newContentReader returns the content reader of a content protocol.
+func (r *Responder) newContentReader(content Content) (ContentReader, error) {
+	if content.Protocol == "" && content.Path != "" {
+		return nil, fmt.Errorf("missing tarpit Content protocol")
+	}
+	switch content.Protocol {
+	// If no content to provide, we'll just hold the connection open
+	case "":
+		return TimeoutReader{}, nil
+	case "file":
+		return FileReader{
+			Path: content.Path,
+		}, nil
+	case "dir":
+		return DirReader{
+			Path: content.Path,
+		}, nil
+	case "generate":
+		return GenerateReader{
+			Generator: content.Path,
+		}, nil
 	case "http", "https":
-		tarCache := cache.New(&cache.Config{
-			Directory: "tarpit",
-		})
-		r.ContentReader = HTTPReader{
-			URL:   r.Config.Content.Protocol + "://" + r.Config.Content.Path,
-			Cache: tarCache,
-		}
-		err := r.ContentReader.Validate()
+		c, err := r.contentCache()
 		if err != nil {
-			return err
+			return nil, err
 		}
+		return HTTPReader{
+			URL:          content.Protocol + "://" + content.Path,
+			Cache:        c,
+			TTL:          r.Config.CacheTTL,
+			Timeout:      r.Config.FetchTimeout,
+			MaxSize:      r.Config.MaxContentSize,
+			StaleIfError: r.Config.StaleIfError,
+		}, nil
 	default:
-		return fmt.Errorf("unsupported tarpit Content protocol '%s'", r.Config.Content.Protocol)
+		return nil, fmt.Errorf("unsupported tarpit Content protocol '%s'", content.Protocol)
 	}
-
-	return nil
 }
 
 // Responder returns a custom response.
 type Responder struct {
 	Config        *Config
 	ContentReader ContentReader
+	// OnFinish, if set, is called once a tarpitted response has ended with how long it was held open
+	// and how many bytes of content were written.
+	OnFinish func(req *http.Request, duration time.Duration, written int64)
+	// Fallback, if set, handles requests over the connection limits.
+	Fallback caddyhttp.MiddlewareHandler
+	// Scheduler writes the content of tarpitted responses. If nil, the scheduler shared by all responders is used.
+	Scheduler *Scheduler
+	// Storage is Caddy's configured storage, which the content cache is kept in with the storage backend.
+	Storage certmagic.Storage
+
+	limiter *Limiter
+	cache   *cache.Cache
+	// done is closed once Caddy's config the responder was provisioned with is unloaded, such as on a reload.
+	done <-chan struct{}
 }
 
-func (r *Responder) ServeHTTP(w http.ResponseWriter, req *http.Request, _ caddyhttp.Handler) error {
+// Provision sets up the connection limits, and ends tarpitted responses once the config is unloaded.
+func (r *Responder) Provision(ctx caddy.Context) error {
+	if ctx.Context != nil {
+		r.done = ctx.Done()
+	}
+	r.limiter = NewLimiter(r.Config.MaxConnections, r.Config.MaxConnectionsPerIP)
+	if registry := ctx.GetMetricsRegistry(); registry != nil {
+		r.limiter.RegisterMetrics(registry)
+	}
+	return nil
+}
+
+// Limiter returns the limiter keeping track of tarpitted connections, or nil if the responder isn't provisioned.
+func (r *Responder) Limiter() *Limiter {
+	return r.limiter
+}
+
+func (r *Responder) ServeHTTP(w http.ResponseWriter, req *http.Request, next caddyhttp.Handler) error {
+	if r.limiter != nil {
+		ip, _, err := net.SplitHostPort(req.RemoteAddr)
+		if err != nil {
+			ip = req.RemoteAddr
+		}
+		release, ok := r.limiter.Acquire(ip)
+		if !ok {
+			if r.Fallback != nil {
+				return r.Fallback.ServeHTTP(w, req, next)
+			}
+			return caddyhttp.Error(http.StatusServiceUnavailable, ErrCapacity)
+		}
+		defer release()
+	}
+
+	scheduler := r.Scheduler
+	if scheduler == nil {
+		scheduler = DefaultScheduler()
+	}
+	start := scheduler.Now()
+	var written int64
+	if r.OnFinish != nil {
+		defer func() {
+			r.OnFinish(req, scheduler.Now().Sub(start), written)
+		}()
+	}
+
+	if r.Config.Mode == ModeHeaders && req.ProtoMajor == 1 {
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err == nil {
+			// A hijacked connection may keep the server's deadlines, which would end the tarpit at its timeouts
+			_ = conn.SetDeadline(time.Time{})
+			written = r.serveHeaders(conn, scheduler, start)
+			return nil
+		}
+		if !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+	}
+	// HTTP/2 and HTTP/3 frame headers and multiplex connections, so they can't be taken over, and their content is
+	// tarpitted instead
+
 	// Open Content data stream
 	reader, err := r.ContentReader.Read()
 	if err != nil {
 		http.Error(w, "Failed to read Content", http.StatusInternalServerError)
 		return nil
 	}
-	defer reader.Close()
+	var content io.ReadCloser = reader
+	if r.Config.Loop {
+		content = &loopReader{content: r.ContentReader, current: reader}
+	}
+	defer content.Close()
 
 	// Read the first 512 bytes to detect content type
 	buffer := make([]byte, 512)
-	n, err := reader.Read(buffer)
+	n, err := content.Read(buffer)
 	if err != nil && err != io.EOF {
 		http.Error(w, "Error reading Content", http.StatusInternalServerError)
 		return nil
@@ -102,60 +315,314 @@ func (r *Responder) ServeHTTP(w http.ResponseWriter, req *http.Request, _ caddyh
 	}
 	// Auto-detect content type
 	w.Header().Set("Content-Type", http.DetectContentType(buffer[:n]))
+	// The sniffed content is paced like the rest
+	body := io.MultiReader(bytes.NewReader(buffer[:n]), content)
+	if length := r.contentLength(reader); length >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+		body = io.LimitReader(body, length)
+	}
+
+	if r.Config.Mode == ModeSocket && req.ProtoMajor == 1 {
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err == nil {
+			_ = conn.SetDeadline(time.Time{})
+			written = r.serveSocket(conn, w.Header(), body, scheduler, start)
+			return nil
+		}
+		if !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+	}
+
 	w.WriteHeader(r.Config.ResponseCode)
 
-	// Write the first chunk before starting the ticker
-	if n > 0 {
-		_, err = w.Write(buffer[:n])
+	controller := http.NewResponseController(w)
+	if err := controller.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+
+	s := r.newStream(w, controller, body, start)
+	r.serveStream(s, scheduler, req.Context().Done())
+	written += s.written
+	// The connection outlives the response, so it mustn't keep the deadline of its last write. Failing to clear it
+	// only matters to a connection which is broken already.
+	_ = controller.SetWriteDeadline(time.Time{})
+	return s.err
+}
+
+// newStream returns a stream writing a body at the configured rate, from a start until the timeout.
+func (r *Responder) newStream(w io.Writer, controller streamController, body io.Reader, start time.Time) *stream {
+	pacer := newPacer(r.Config)
+	return &stream{
+		w:          w,
+		controller: controller,
+		reader:     body,
+		chunk:      make([]byte, pacer.maxChunk()),
+		pacer:      pacer,
+		start:      start,
+		deadline:   start.Add(r.Config.Timeout),
+		last:       pacer.dueAt(1),
+		done:       make(chan struct{}),
+	}
+}
+
+// serveStream schedules a stream, and waits for it to end, for the client to go away or for the config to be
+// unloaded.
+func (r *Responder) serveStream(s *stream, scheduler *Scheduler, gone <-chan struct{}) {
+	s.writeTimeout = min(stepWriteTimeout, scheduler.tick/2)
+	if s.resumable {
+		s.writeTimeout = min(s.writeTimeout, resumableWriteTimeout)
+	}
+	scheduler.Add(s, s.start.Add(s.last))
+	select {
+	case <-s.done:
+	case <-gone:
+	case <-r.done:
+	}
+	// Once stopped, the scheduler doesn't touch the response anymore
+	s.stop()
+}
+
+// contentLength returns the Content-Length of a response with opened content, or -1 for none.
+func (r *Responder) contentLength(content io.Reader) int64 {
+	switch r.Config.ContentLength {
+	case "":
+		return -1
+	case "auto":
+		if size := sizeOf(content); size >= 0 {
+			return size
+		}
+		return r.ContentReader.Size()
+	default:
+		length, err := strconv.ParseInt(r.Config.ContentLength, 10, 64)
 		if err != nil {
-			return err
+			return -1
 		}
-		w.(http.Flusher).Flush()
+		return length
 	}
+}
 
-	chunk := make([]byte, r.Config.BytesPerSecond/10)
+// sizeOf returns the size of opened content if it is a file or reports its size, such as when cached in memory, or -1.
+func sizeOf(reader io.Reader) int64 {
+	if sized, ok := reader.(interface{ Size() int64 }); ok {
+		return sized.Size()
+	}
+	file, ok := reader.(*os.File)
+	if !ok {
+		return -1
+	}
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return -1
+	}
+	return info.Size()
+}
 
-	// Write data every 100ms
-	ticker := time.NewTicker(time.Millisecond * 100)
-	defer ticker.Stop()
+var (
+	// writeTimeout is how long writing a response may be blocked, such as for a client which stopped reading, before
+	// the response is ended.
+	writeTimeout = 5 * time.Second
+	// stepWriteTimeout is how long a write may block the scheduler worker stepping a stream, capped at half a tick.
+	// Tarpits write little, so a write only blocks once the client stopped reading and its buffers are full, which
+	// ends the response rather than holding up the streams due after it.
+	stepWriteTimeout = 20 * time.Millisecond
+	// resumableWriteTimeout is how long a write may block the scheduler worker stepping a resumable stream, which
+	// writes what is left on later steps rather than waiting for the client.
+	resumableWriteTimeout = time.Millisecond
+)
 
-	timeout := time.After(r.Config.Timeout)
+// streamController flushes and sets the write deadline of what a stream writes to, like an http.ResponseController.
+type streamController interface {
+	Flush() error
+	SetWriteDeadline(deadline time.Time) error
+}
 
-	for {
-		select {
-		case <-ticker.C:
-			// Stop if client disconnects to prevent panic
-			if req.Context().Err() != nil {
-				break
-			}
+// stream is a tarpitted response, written to by a Scheduler.
+type stream struct {
+	w          io.Writer
+	controller streamController
+	reader     io.Reader
+	chunk      []byte
+	pacer      *pacer
+	start      time.Time
+	deadline   time.Time
+	done       chan struct{}
+	// writeTimeout is how long a write may block the worker stepping the stream.
+	writeTimeout time.Duration
+	// resumable is whether the stream writes to a connection which survives write timeouts, unlike a buffered
+	// http.ResponseWriter or a TLS connection. A write which times out then only skips a step.
+	resumable bool
+	// pending is what is left of content a write timed out on, written before any more is read.
+	pending []byte
+	// stalled is when writes started timing out, or zero.
+	stalled time.Time
+	// last is when the stream was last scheduled, relative to its start. Scheduling from it rather than from when
+	// the stream was stepped keeps the rate steady.
+	last time.Duration
+	// sent is the number of bytes of content read so far.
+	sent int64
 
-			n, err := reader.Read(chunk)
-			if err == io.EOF {
-				// Graceful exit as we've reached the end of the content
-				return nil
-			} else if err != nil {
-				return err
-			}
-			if n > 0 {
-				_, err = w.Write(chunk[:n])
-				if err != nil {
-					return err
-				}
-				w.(http.Flusher).Flush()
+	mu      sync.Mutex
+	stopped bool
+	written int64
+	err     error
+}
+
+// Step writes the content due, until the content or the time is up.
+func (s *stream) Step(now time.Time) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return time.Time{}, false
+	}
+	if !now.Before(s.deadline) {
+		// Forcefully close response after timeout
+		s.finish(nil)
+		return time.Time{}, false
+	}
+
+	if len(s.pending) > 0 {
+		if err := s.write(now, s.pending); err != nil {
+			s.finish(err)
+			return time.Time{}, false
+		}
+		if len(s.pending) > 0 {
+			// The client still isn't reading, so the stream tries again next tick
+			return now, true
+		}
+	}
+
+	elapsed := now.Sub(s.start)
+	if due := min(s.pacer.due(elapsed)-s.sent, int64(len(s.chunk))); due > 0 {
+		n, err := fill(s.reader, s.chunk[:due])
+		s.sent += int64(n)
+		if err == io.EOF && n == 0 {
+			// Graceful exit as we've reached the end of the content
+			s.finish(nil)
+			return time.Time{}, false
+		} else if err != nil && err != io.EOF {
+			s.finish(err)
+			return time.Time{}, false
+		}
+		if n > 0 {
+			if err := s.write(now, s.chunk[:n]); err != nil {
+				s.finish(err)
+				return time.Time{}, false
 			}
-		case <-timeout:
-			// Forcefully close response after timeout
-			return nil
 		}
 	}
+
+	if s.last = s.pacer.next(s.last, s.sent); s.last < elapsed {
+		// The stream fell behind, so it carries on from now rather than catching up in a burst
+		s.last = s.pacer.next(elapsed, s.sent)
+	}
+	return s.start.Add(s.last), true
+}
+
+// write writes and flushes a chunk of content, within the stream's write timeout. A resumable stream keeps what a
+// write which timed out left for later, until nothing could be written for the write timeout. The lock must be held.
+func (s *stream) write(now time.Time, b []byte) error {
+	err := s.controller.SetWriteDeadline(time.Now().Add(s.writeTimeout))
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	n, err := s.w.Write(b)
+	s.written += int64(n)
+	if err != nil {
+		if !s.resumable || !errors.Is(err, os.ErrDeadlineExceeded) {
+			return err
+		}
+		// Only a client which reads nothing at all is stalled
+		if s.stalled.IsZero() || n > 0 {
+			s.stalled = now
+		} else if now.Sub(s.stalled) >= writeTimeout {
+			return err
+		}
+		s.pending = b[n:]
+		return nil
+	}
+	s.pending, s.stalled = nil, time.Time{}
+	if err := s.controller.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	// The deadline is only for this write: over HTTP/2, it resets the stream once passed, even between writes
+	_ = s.controller.SetWriteDeadline(time.Time{})
+	return nil
+}
+
+// fill reads into a buffer until it is full, or the reader has nothing more for now. Unlike io.ReadFull, it doesn't
+// spin on readers returning no bytes, such as a TimeoutReader's.
+func fill(reader io.Reader, b []byte) (int, error) {
+	total := 0
+	for total < len(b) {
+		n, err := reader.Read(b[total:])
+		total += n
+		if err != nil || n == 0 {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// finish ends the stream. The lock must be held.
+func (s *stream) finish(err error) {
+	s.err = err
+	s.stopped = true
+	close(s.done)
+}
+
+// stop keeps the scheduler from writing to the response anymore, waiting for a write in progress. The stream lets
+// go of the response and content, as the scheduler only drops it once it is next due.
+func (s *stream) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+	s.w, s.controller, s.reader, s.chunk, s.pending = nil, nil, nil, nil, nil
 }
 
 func (r *Responder) Validate() error {
 	if r.Config.Timeout <= 0 {
 		return errors.New("tarpit timeout must be greater than 0")
 	}
-	if r.Config.BytesPerSecond <= 10 {
-		return errors.New("tarpit bytes_per_second must be greater than 10")
+	if r.Config.BytesPerSecond <= 0 || math.IsInf(r.Config.BytesPerSecond, 0) {
+		return errors.New("tarpit bytes_per_second must be greater than 0")
+	}
+	if r.Config.RampDuration < 0 {
+		return errors.New("tarpit ramp duration must not be negative")
+	}
+	if r.Config.RampDuration > 0 && r.Config.InitialBytesPerSecond <= 0 {
+		return errors.New("tarpit ramp requires initial_bytes_per_second to be greater than 0")
+	}
+	if r.Config.Mode != "" && !slices.Contains(Modes, r.Config.Mode) {
+		return fmt.Errorf("unknown tarpit mode '%s', expected one of %s", r.Config.Mode, strings.Join(Modes, ", "))
+	}
+	if r.Config.Jitter < 0 || r.Config.Jitter >= 1 {
+		return errors.New("tarpit jitter must be at least 0 and less than 1")
+	}
+	if r.Config.ContentLength != "" && r.Config.ContentLength != "auto" {
+		if length, err := strconv.ParseInt(r.Config.ContentLength, 10, 64); err != nil || length < 0 {
+			return fmt.Errorf("tarpit content_length must be auto or a number of bytes: '%s'", r.Config.ContentLength)
+		}
+	}
+	if r.Config.ContentLength == "auto" && r.Config.Loop {
+		return errors.New("tarpit content_length auto can't be used with loop")
+	}
+	for _, source := range r.Config.Sources {
+		if source.Weight < 0 {
+			return errors.New("tarpit content weights must not be negative")
+		}
+	}
+	if r.Config.Cache != nil {
+		if err := r.Config.Cache.Validate(); err != nil {
+			return err
+		}
+	}
+	if r.Config.CacheTTL < 0 || r.Config.FetchTimeout < 0 || r.Config.MaxContentSize < 0 {
+		return errors.New("tarpit cache_ttl, fetch_timeout and max_content_size must not be negative")
+	}
+	if r.Config.MaxConnections < 0 || r.Config.MaxConnectionsPerIP < 0 {
+		return errors.New("tarpit max_connections and max_connections_per_ip must not be negative")
 	}
 	return nil
 }
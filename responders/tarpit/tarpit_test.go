@@ -2,14 +2,21 @@ package tarpit
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/caddyserver/caddy/v2"
 	"github.com/jasonlovesdoggo/caddy-defender/cache"
+	"github.com/stretchr/testify/require"
 )
 
 // Helper function to create a new responder
@@ -63,13 +70,15 @@ func TestConfigureContentReader(t *testing.T) {
 	})
 
 	t.Run("HTTP", func(t *testing.T) {
-		content := Content{Protocol: "http", Path: "example.com/data"}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "data")
+		}))
+		defer server.Close()
+
+		content := Content{Protocol: "http", Path: strings.TrimPrefix(server.URL, "http://") + "/data"}
 		responder := newTestResponder(content, time.Second*5)
+		responder.Config.Cache = &cache.Config{Root: t.TempDir()}
 
-		responder.ContentReader = HTTPReader{
-			URL:   "http://example.com/data",
-			Cache: cache.New(&cache.Config{Directory: "tarpit"}),
-		}
 		err := responder.ConfigureContentReader()
 		if err != nil {
 			t.Errorf("Expected no error, but got: %v", err)
@@ -80,13 +89,19 @@ func TestConfigureContentReader(t *testing.T) {
 	})
 
 	t.Run("HTTPS", func(t *testing.T) {
-		content := Content{Protocol: "https", Path: "example.com/data"}
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "data")
+		}))
+		defer server.Close()
+		// Trust the test server's certificate
+		transport := http.DefaultTransport
+		http.DefaultTransport = server.Client().Transport
+		t.Cleanup(func() { http.DefaultTransport = transport })
+
+		content := Content{Protocol: "https", Path: strings.TrimPrefix(server.URL, "https://") + "/data"}
 		responder := newTestResponder(content, time.Second*5)
+		responder.Config.Cache = &cache.Config{Root: t.TempDir()}
 
-		responder.ContentReader = HTTPReader{
-			URL:   "https://example.com/data",
-			Cache: cache.New(&cache.Config{Directory: "tarpit"}),
-		}
 		err := responder.ConfigureContentReader()
 		if err != nil {
 			t.Errorf("Expected no error, but got: %v", err)
@@ -185,6 +200,211 @@ func TestServeHTTP(t *testing.T) {
 	})
 }
 
+// newStoppingResponder returns a responder streaming endless content fast for a minute, on a scheduler of its own.
+func newStoppingResponder(finished chan<- error) *Responder {
+	return &Responder{
+		Config: &Config{
+			Timeout:        time.Minute,
+			BytesPerSecond: 1 << 30,
+			ResponseCode:   http.StatusOK,
+			Loop:           true,
+		},
+		ContentReader: &mockReadCloser{data: bytes.Repeat([]byte("tarpit "), 1<<16)},
+		Scheduler:     NewScheduler(RealClock, 10*time.Millisecond, 2),
+		OnFinish: func(*http.Request, time.Duration, int64) {
+			finished <- nil
+		},
+	}
+}
+
+// requireGoroutinesExit waits for the number of goroutines to fall back to what it was before a test.
+func requireGoroutinesExit(t *testing.T, before int) {
+	t.Helper()
+	// Polled here, as require.Eventually checks from goroutines of its own
+	for deadline := time.Now().Add(5 * time.Second); runtime.NumGoroutine() > before && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.LessOrEqual(t, runtime.NumGoroutine(), before, "goroutines were left running")
+}
+
+// requireFinished waits for a tarpitted response to end, well before its timeout, and returns its error.
+func requireFinished(t *testing.T, finished <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-finished:
+		return err
+	case <-time.After(10 * time.Second):
+		t.Fatal("still serving")
+		return nil
+	}
+}
+
+func TestServeHTTPStops(t *testing.T) {
+	t.Run("ClientDisconnect", func(t *testing.T) {
+		before := runtime.NumGoroutine()
+		finished := make(chan error, 1)
+		responder := newStoppingResponder(finished)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_ = responder.ServeHTTP(w, r, nil)
+		}))
+		client := server.Client()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		_, err = io.ReadFull(resp.Body, make([]byte, 1024))
+		require.NoError(t, err)
+		cancel()
+		resp.Body.Close()
+
+		requireFinished(t, finished)
+		require.Eventually(t, func() bool { return responder.Scheduler.Active() == 0 }, time.Second, time.Millisecond)
+		client.CloseIdleConnections()
+		server.Close()
+		requireGoroutinesExit(t, before)
+	})
+
+	t.Run("ConfigUnloaded", func(t *testing.T) {
+		before := runtime.NumGoroutine()
+		finished := make(chan error, 1)
+		responder := newStoppingResponder(finished)
+		ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+		require.NoError(t, responder.Provision(ctx))
+
+		rec := &lockedRecorder{ResponseRecorder: httptest.NewRecorder()}
+		done := make(chan error, 1)
+		go func() {
+			done <- responder.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil), nil)
+		}()
+		require.Eventually(t, func() bool { return rec.Len() > 0 }, time.Second, time.Millisecond)
+		// Caddy cancels the context of a config once it is replaced by a reload
+		cancel()
+
+		require.NoError(t, requireFinished(t, done))
+		require.Eventually(t, func() bool { return responder.Scheduler.Active() == 0 }, time.Second, time.Millisecond)
+		requireGoroutinesExit(t, before)
+	})
+
+	t.Run("StalledClient", func(t *testing.T) {
+		before := runtime.NumGoroutine()
+		finished := make(chan error, 1)
+		responder := newStoppingResponder(finished)
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			finished <- responder.ServeHTTP(w, r, nil)
+		}))
+		// Keep the connection's buffers small, so they are full sooner
+		server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+			if state == http.StateNew {
+				_ = conn.(*net.TCPConn).SetWriteBuffer(4096)
+			}
+		}
+		server.Start()
+		responder.OnFinish = nil
+
+		// The client sends a request, but never reads the response
+		conn, err := net.Dial("tcp", server.Listener.Addr().String())
+		require.NoError(t, err)
+		require.NoError(t, conn.(*net.TCPConn).SetReadBuffer(4096))
+		_, err = fmt.Fprint(conn, "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+		require.NoError(t, err)
+
+		// Once the connection's buffers are full, the write deadline ends the response
+		require.ErrorIs(t, requireFinished(t, finished), os.ErrDeadlineExceeded)
+		conn.Close()
+		require.Eventually(t, func() bool { return responder.Scheduler.Active() == 0 }, time.Second, time.Millisecond)
+		server.Close()
+		requireGoroutinesExit(t, before)
+	})
+
+	t.Run("WriterWithoutFlusher", func(t *testing.T) {
+		responder := &Responder{
+			Config: &Config{
+				Timeout:        time.Second,
+				BytesPerSecond: 100,
+				ResponseCode:   http.StatusOK,
+			},
+			ContentReader: &mockReadCloser{data: []byte("Hello, World!")},
+			Scheduler:     NewScheduler(RealClock, 10*time.Millisecond, 1),
+		}
+		w := &plainResponseWriter{header: http.Header{}}
+		require.NoError(t, responder.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil), nil))
+		require.Equal(t, "Hello, World!", w.body.String())
+	})
+}
+
+// stallingWriter blocks writes until their deadline, like a connection whose client stopped reading.
+type stallingWriter struct {
+	deadline time.Time
+	blocked  time.Duration
+	writes   int
+}
+
+func (s *stallingWriter) Write([]byte) (int, error) {
+	s.blocked = max(s.blocked, time.Until(s.deadline))
+	s.writes++
+	time.Sleep(time.Until(s.deadline))
+	return 0, os.ErrDeadlineExceeded
+}
+
+func (s *stallingWriter) Flush() error {
+	return nil
+}
+
+func (s *stallingWriter) SetWriteDeadline(deadline time.Time) error {
+	s.deadline = deadline
+	return nil
+}
+
+func TestStreamStalledWrite(t *testing.T) {
+	responder := newStoppingResponder(nil)
+	stalled := &stallingWriter{}
+	s := responder.newStream(stalled, stalled, strings.NewReader("tarpit"), time.Now())
+
+	// A stalled write ends the stream, having blocked the scheduler's only worker for no more than half a tick
+	responder.serveStream(s, responder.Scheduler, nil)
+	require.ErrorIs(t, s.err, os.ErrDeadlineExceeded)
+	require.Positive(t, stalled.blocked)
+	require.LessOrEqual(t, stalled.blocked, responder.Scheduler.tick/2)
+	require.Equal(t, 1, stalled.writes)
+}
+
+func TestStreamStalledWriteResumable(t *testing.T) {
+	timeout := writeTimeout
+	writeTimeout = 200 * time.Millisecond
+	t.Cleanup(func() { writeTimeout = timeout })
+
+	responder := newStoppingResponder(nil)
+	stalled := &stallingWriter{}
+	s := responder.newStream(stalled, stalled, strings.NewReader("tarpit"), time.Now())
+	s.resumable = true
+
+	// Writes which time out are retried every tick, barely blocking the worker, until stalled for the write timeout
+	start := time.Now()
+	responder.serveStream(s, responder.Scheduler, nil)
+	require.ErrorIs(t, s.err, os.ErrDeadlineExceeded)
+	require.GreaterOrEqual(t, time.Since(start), writeTimeout)
+	require.Greater(t, stalled.writes, 5)
+	require.LessOrEqual(t, stalled.blocked, resumableWriteTimeout)
+}
+
+// plainResponseWriter is an http.ResponseWriter which can't be flushed or have deadlines.
+type plainResponseWriter struct {
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (p *plainResponseWriter) Header() http.Header {
+	return p.header
+}
+
+func (p *plainResponseWriter) Write(b []byte) (int, error) {
+	return p.body.Write(b)
+}
+
+func (p *plainResponseWriter) WriteHeader(int) {}
+
 // Mock response writer for testing
 type mockResponseWriter struct {
 	header     http.Header
@@ -217,6 +437,10 @@ func (m *mockReadCloser) Read() (io.ReadCloser, error) {
 	return io.NopCloser(bytes.NewReader(m.data)), nil
 }
 
+func (m *mockReadCloser) Size() int64 {
+	return int64(len(m.data))
+}
+
 func (m *mockReadCloser) Validate() error {
 	return nil
 }
@@ -232,6 +456,10 @@ func (m *mockErrorReader) Read() (io.ReadCloser, error) {
 	return nil, fmt.Errorf("read error")
 }
 
+func (m *mockErrorReader) Size() int64 {
+	return -1
+}
+
 func (m *mockErrorReader) Validate() error {
 	return fmt.Errorf("validate error")
 }
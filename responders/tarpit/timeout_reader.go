@@ -14,6 +14,11 @@ func (n TimeoutReader) Read() (io.ReadCloser, error) {
 	return dumbReader, nil
 }
 
+// Size returns -1, as there is no content.
+func (n TimeoutReader) Size() int64 {
+	return -1
+}
+
 // Validate does nothing.
 func (n TimeoutReader) Validate() error {
 	return nil
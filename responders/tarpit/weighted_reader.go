@@ -0,0 +1,67 @@
+package tarpit
+
+import (
+	"errors"
+	"io"
+	"math/rand/v2"
+)
+
+// WeightedReader implements the ContentReader interface and reads from one of several content readers per request,
+// picked at random in proportion to their weights.
+type WeightedReader struct {
+	Readers []ContentReader
+	Weights []int
+}
+
+// Read opens the content of a randomly picked reader for streaming.
+func (w WeightedReader) Read() (io.ReadCloser, error) {
+	return w.pick(rand.IntN(w.total())).Read()
+}
+
+// Size returns the size of the content if all readers have content of the same size, or -1.
+func (w WeightedReader) Size() int64 {
+	size := int64(-1)
+	for i, reader := range w.Readers {
+		s := reader.Size()
+		if i > 0 && s != size {
+			return -1
+		}
+		size = s
+	}
+	return size
+}
+
+// Validate ensures there is a reader to pick, and all readers are valid.
+func (w WeightedReader) Validate() error {
+	if len(w.Readers) == 0 || len(w.Readers) != len(w.Weights) {
+		return errors.New("tarpit content sources require a weight per reader")
+	}
+	for i, reader := range w.Readers {
+		if w.Weights[i] <= 0 {
+			return errors.New("tarpit content weights must be greater than 0")
+		}
+		if err := reader.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pick returns the reader a number in [0, total) falls on.
+func (w WeightedReader) pick(n int) ContentReader {
+	for i, weight := range w.Weights {
+		if n < weight {
+			return w.Readers[i]
+		}
+		n -= weight
+	}
+	return w.Readers[len(w.Readers)-1]
+}
+
+func (w WeightedReader) total() int {
+	total := 0
+	for _, weight := range w.Weights {
+		total += weight
+	}
+	return total
+}
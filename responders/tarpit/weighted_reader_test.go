@@ -0,0 +1,76 @@
+package tarpit
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWeightedReader(t *testing.T) {
+	reader := WeightedReader{
+		Readers: []ContentReader{
+			&mockReadCloser{data: []byte("a")},
+			&mockReadCloser{data: []byte("b")},
+		},
+		Weights: []int{3, 1},
+	}
+	require.NoError(t, reader.Validate())
+	require.Equal(t, int64(1), reader.Size())
+
+	require.Equal(t, reader.Readers[0], reader.pick(0))
+	require.Equal(t, reader.Readers[0], reader.pick(2))
+	require.Equal(t, reader.Readers[1], reader.pick(3))
+
+	picked := map[string]int{}
+	for range 4000 {
+		content, err := reader.Read()
+		require.NoError(t, err)
+		data, err := io.ReadAll(content)
+		require.NoError(t, err)
+		picked[string(data)]++
+	}
+	require.InDelta(t, 3000, picked["a"], 200)
+	require.InDelta(t, 1000, picked["b"], 200)
+}
+
+func TestWeightedReaderInvalid(t *testing.T) {
+	require.Error(t, WeightedReader{}.Validate())
+	require.ErrorContains(t, WeightedReader{
+		Readers: []ContentReader{&mockReadCloser{}},
+		Weights: []int{0},
+	}.Validate(), "weights must be greater than 0")
+	require.ErrorContains(t, WeightedReader{
+		Readers: []ContentReader{&mockReadCloser{}, &mockErrorReader{}},
+		Weights: []int{1, 1},
+	}.Validate(), "validate error")
+	// Sizes differ
+	require.Equal(t, int64(-1), WeightedReader{
+		Readers: []ContentReader{&mockReadCloser{data: []byte("a")}, &mockReadCloser{data: []byte("bb")}},
+		Weights: []int{1, 1},
+	}.Size())
+}
+
+func TestConfigureContentReaderSources(t *testing.T) {
+	dir := t.TempDir()
+	responder := newTestResponder(Content{}, time.Second)
+	responder.Config.Sources = []Source{
+		{Content: Content{Protocol: "dir", Path: dir}, Weight: 2},
+		{},
+	}
+	// The directory is empty
+	require.ErrorContains(t, responder.ConfigureContentReader(), "no files")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0o600))
+	require.NoError(t, responder.ConfigureContentReader())
+	weighted, ok := responder.ContentReader.(WeightedReader)
+	require.True(t, ok)
+	require.Equal(t, []ContentReader{DirReader{Path: dir}, TimeoutReader{}}, weighted.Readers)
+	require.Equal(t, []int{2, 1}, weighted.Weights)
+
+	responder.Config.Content = Content{Protocol: "file", Path: "a.txt"}
+	require.ErrorContains(t, responder.ConfigureContentReader(), "mutually exclusive")
+}
@@ -0,0 +1,97 @@
+package responders
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// ProblemContentType is the media type of RFC 9457 problem details.
+const ProblemContentType = "application/problem+json"
+
+// Problem is an RFC 9457 problem details object.
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// loadMessage returns the message template, read from file if one is given.
+func loadMessage(message, file string) (string, error) {
+	if file == "" {
+		return message, nil
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// writeTemplated writes a response whose header values and body are rendered through Caddy's replacer, so
+// placeholders such as {http.request.remote.host} and {http.vars.defender_group} can be used.
+// Clients preferring JSON get the body as the detail of an RFC 9457 problem.
+func writeTemplated(w http.ResponseWriter, r *http.Request, code int, headers map[string]string, body string) error {
+	repl, ok := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+	if !ok {
+		repl = caddy.NewReplacer()
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for name, value := range headers {
+		w.Header().Set(name, repl.ReplaceKnown(value, ""))
+	}
+	body = repl.ReplaceKnown(body, "")
+
+	if prefersProblem(r.Header.Get("Accept")) {
+		problem, err := json.Marshal(Problem{
+			Type:   "about:blank",
+			Title:  http.StatusText(code),
+			Status: code,
+			Detail: body,
+		})
+		if err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", ProblemContentType)
+		body = string(problem)
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(code)
+	_, err := w.Write([]byte(body))
+	return err
+}
+
+// prefersProblem reports whether an Accept header prefers JSON over other explicitly listed media types.
+// Wildcards don't count as a preference, so browsers and clients without an Accept header get text.
+func prefersProblem(accept string) bool {
+	var jsonQ, otherQ float64
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		switch {
+		case mediaType == ProblemContentType, mediaType == "application/json",
+			strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json"):
+			jsonQ = max(jsonQ, q)
+		case strings.HasSuffix(mediaType, "/*"):
+		default:
+			otherQ = max(otherQ, q)
+		}
+	}
+	return jsonQ > 0 && jsonQ >= otherQ
+}
@@ -0,0 +1,138 @@
+package responders
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/stretchr/testify/require"
+)
+
+// newTemplateRequest returns a matched request with Caddy's replacer and vars set up as in a running server.
+func newTemplateRequest(accept string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/secret", nil)
+	req.RemoteAddr = "192.0.2.10:1234"
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	req = caddyhttp.PrepareRequest(req, caddy.NewReplacer(), nil, nil)
+	caddyhttp.SetVar(req.Context(), GroupVarKey, "openai")
+	return req
+}
+
+func TestBlockResponder(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		r := &BlockResponder{}
+		require.NoError(t, r.Provision(caddy.Context{}))
+
+		rec := httptest.NewRecorder()
+		require.NoError(t, r.ServeHTTP(rec, newTemplateRequest(""), nil))
+		require.Equal(t, http.StatusForbidden, rec.Code)
+		require.Equal(t, "text/plain; charset=utf-8", rec.Header().Get("Content-Type"))
+		require.Equal(t, "Access denied", rec.Body.String())
+	})
+
+	t.Run("Status, headers and placeholders", func(t *testing.T) {
+		r := &BlockResponder{
+			ResponseCode: http.StatusUnavailableForLegalReasons,
+			Headers: map[string]string{
+				"Content-Type":      "text/html",
+				"X-Defender-Group":  "{http.vars.defender_group}",
+				"X-Defender-Client": "{http.request.remote.host}",
+			},
+			Message: "<p>{http.request.remote.host} from {http.vars.defender_group} may not see {http.request.uri.path}</p>",
+		}
+		require.NoError(t, r.Provision(caddy.Context{}))
+
+		rec := httptest.NewRecorder()
+		require.NoError(t, r.ServeHTTP(rec, newTemplateRequest("text/html,*/*;q=0.8"), nil))
+		require.Equal(t, http.StatusUnavailableForLegalReasons, rec.Code)
+		require.Equal(t, "text/html", rec.Header().Get("Content-Type"))
+		require.Equal(t, "openai", rec.Header().Get("X-Defender-Group"))
+		require.Equal(t, "192.0.2.10", rec.Header().Get("X-Defender-Client"))
+		require.Equal(t, "<p>192.0.2.10 from openai may not see /secret</p>", rec.Body.String())
+	})
+
+	t.Run("Problem details for API clients", func(t *testing.T) {
+		r := &BlockResponder{Message: "Blocked {http.vars.defender_group}"}
+		require.NoError(t, r.Provision(caddy.Context{}))
+
+		rec := httptest.NewRecorder()
+		require.NoError(t, r.ServeHTTP(rec, newTemplateRequest("application/json"), nil))
+		require.Equal(t, http.StatusForbidden, rec.Code)
+		require.Equal(t, ProblemContentType, rec.Header().Get("Content-Type"))
+
+		var problem Problem
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &problem))
+		require.Equal(t, Problem{
+			Type:   "about:blank",
+			Title:  "Forbidden",
+			Status: http.StatusForbidden,
+			Detail: "Blocked openai",
+		}, problem)
+	})
+}
+
+func TestCustomResponder(t *testing.T) {
+	t.Run("Message", func(t *testing.T) {
+		r := &CustomResponder{Message: "Hello {http.vars.defender_group}"}
+		require.NoError(t, r.Provision(caddy.Context{}))
+
+		rec := httptest.NewRecorder()
+		require.NoError(t, r.ServeHTTP(rec, newTemplateRequest(""), nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.Equal(t, "Hello openai", rec.Body.String())
+	})
+
+	t.Run("Message file", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "blocked.html")
+		require.NoError(t, os.WriteFile(file, []byte("<h1>{http.vars.defender_group}</h1>"), 0o600))
+
+		r := &CustomResponder{
+			ResponseCode: http.StatusTooManyRequests,
+			Headers:      map[string]string{"Content-Type": "text/html"},
+			MessageFile:  file,
+		}
+		require.NoError(t, r.Provision(caddy.Context{}))
+
+		rec := httptest.NewRecorder()
+		require.NoError(t, r.ServeHTTP(rec, newTemplateRequest(""), nil))
+		require.Equal(t, http.StatusTooManyRequests, rec.Code)
+		require.Equal(t, "<h1>openai</h1>", rec.Body.String())
+	})
+
+	t.Run("Missing message file", func(t *testing.T) {
+		r := &CustomResponder{MessageFile: filepath.Join(t.TempDir(), "missing.html")}
+		require.Error(t, r.Provision(caddy.Context{}))
+	})
+}
+
+func TestPrefersProblem(t *testing.T) {
+	tests := []struct {
+		accept   string
+		expected bool
+	}{
+		{accept: "", expected: false},
+		{accept: "*/*", expected: false},
+		{accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", expected: false},
+		{accept: "application/json", expected: true},
+		{accept: "application/problem+json", expected: true},
+		{accept: "application/vnd.api+json", expected: true},
+		{accept: "application/json, text/plain;q=0.5", expected: true},
+		{accept: "text/plain, application/json;q=0.5", expected: false},
+		{accept: "application/json;q=0", expected: false},
+		{accept: "application/json, */*", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			require.Equal(t, tt.expected, prefersProblem(tt.accept))
+		})
+	}
+}
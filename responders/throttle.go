@@ -0,0 +1,56 @@
+package responders
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/jasonlovesdoggo/caddy-defender/pacing"
+)
+
+// ThrottleConfig holds the throttle responder's configuration.
+type ThrottleConfig struct {
+	// BytesPerSecond is the rate the response is written to the client at.
+	// Default: 0 (unlimited)
+	BytesPerSecond int `json:"bytes_per_second,omitempty"`
+	// Delay is how long to wait before the request is passed on.
+	// Default: 0 (no delay)
+	Delay time.Duration `json:"delay,omitempty"`
+}
+
+// Validate ensures the throttle configuration is valid.
+func (c *ThrottleConfig) Validate() error {
+	if c.BytesPerSecond < 0 || c.Delay < 0 {
+		return errors.New("throttle bytes_per_second and delay must not be negative")
+	}
+	if c.BytesPerSecond == 0 && c.Delay == 0 {
+		return errors.New("throttle responder requires bytes_per_second or delay")
+	}
+	return nil
+}
+
+// ThrottleResponder passes requests on to the next handler after a delay and writes the real response at a reduced
+// rate, so deprioritized clients still get correct content but it costs them time.
+type ThrottleResponder struct {
+	Config *ThrottleConfig
+}
+
+func (t *ThrottleResponder) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	if t.Config.Delay > 0 {
+		timer := time.NewTimer(t.Config.Delay)
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			timer.Stop()
+			return r.Context().Err()
+		}
+	}
+
+	if t.Config.BytesPerSecond > 0 {
+		// Each response gets its own limiter
+		w = pacing.NewWriter(r.Context(), w, pacing.NewLimiter(t.Config.BytesPerSecond))
+	}
+
+	return next.ServeHTTP(w, r)
+}
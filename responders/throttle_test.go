@@ -0,0 +1,95 @@
+package responders
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThrottleConfigValidate(t *testing.T) {
+	require.NoError(t, (&ThrottleConfig{BytesPerSecond: 100}).Validate())
+	require.NoError(t, (&ThrottleConfig{Delay: time.Second}).Validate())
+	require.ErrorContains(t, (&ThrottleConfig{}).Validate(), "requires bytes_per_second or delay")
+	require.ErrorContains(t, (&ThrottleConfig{Delay: -time.Second}).Validate(), "must not be negative")
+}
+
+func TestThrottleResponder(t *testing.T) {
+	t.Run("Delays and paces the real response", func(t *testing.T) {
+		r := &ThrottleResponder{Config: &ThrottleConfig{BytesPerSecond: 1000, Delay: 200 * time.Millisecond}}
+		content := bytes.Repeat([]byte("x"), 300)
+		next := caddyhttp.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) error {
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusTeapot)
+			_, err := w.Write(content)
+			return err
+		})
+
+		rec := httptest.NewRecorder()
+		start := time.Now()
+		require.NoError(t, r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil), next))
+
+		// 200ms delay, then 300 bytes at 1000 B/s with an initial burst of 100 bytes
+		require.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+		require.Equal(t, http.StatusTeapot, rec.Code)
+		require.Equal(t, "text/plain", rec.Header().Get("Content-Type"))
+		require.Equal(t, content, rec.Body.Bytes())
+	})
+
+	t.Run("Cancelled during delay", func(t *testing.T) {
+		r := &ThrottleResponder{Config: &ThrottleConfig{Delay: time.Minute}}
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		ctx, cancel := context.WithCancel(req.Context())
+		cancel()
+
+		err := r.ServeHTTP(httptest.NewRecorder(), req.WithContext(ctx), caddyhttp.HandlerFunc(
+			func(http.ResponseWriter, *http.Request) error {
+				t.Error("request must not be passed on")
+				return nil
+			}))
+		require.Error(t, err)
+	})
+
+	t.Run("HTTP/2 streaming", func(t *testing.T) {
+		r := &ThrottleResponder{Config: &ThrottleConfig{BytesPerSecond: 1000}}
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			err := r.ServeHTTP(w, req, caddyhttp.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) error {
+				// Upstream handlers rely on ResponseController through the wrapped writer
+				if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Minute)); err != nil {
+					return err
+				}
+				_, err := w.Write(bytes.Repeat([]byte("x"), 500))
+				return err
+			}))
+			if err != nil {
+				t.Error(err)
+			}
+		}))
+		server.EnableHTTP2 = true
+		server.StartTLS()
+		defer server.Close()
+
+		resp, err := server.Client().Get(server.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, 2, resp.ProtoMajor)
+
+		// The first chunk arrives long before the whole response is paced out
+		start := time.Now()
+		first := make([]byte, 100)
+		_, err = io.ReadFull(resp.Body, first)
+		require.NoError(t, err)
+		require.Less(t, time.Since(start), 200*time.Millisecond)
+
+		rest, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Len(t, rest, 400)
+		require.GreaterOrEqual(t, time.Since(start), 300*time.Millisecond)
+	})
+}